@@ -97,6 +97,26 @@ var _ = Describe("FileWriter", func() {
 
 	})
 
+	It("Should overwrite the content of the file when append mode is disabled", func() {
+		file := cloudinit.Files{
+			Path:    path.Join(workDir, "file4.txt"),
+			Content: "short",
+		}
+
+		err := cloudinit.FileWriter{}.MkdirIfNotExists(workDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = os.WriteFile(file.Path, []byte("some-longer-file-content"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = cloudinit.FileWriter{}.WriteToFile(&file)
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer, err := os.ReadFile(file.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(buffer)).To(Equal(file.Content))
+	})
+
 	It("should return error with invalid owner format", func() {
 		file := cloudinit.Files{
 			Path:        path.Join(workDir, "file1.txt"),
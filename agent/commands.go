@@ -0,0 +1,217 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/cloudinit"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/reconciler"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newRunCommand(cfg *agentConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "run",
+		Short: "Register the host and start reconciling its ByoHost (default)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAgent(cfg)
+		},
+	}
+}
+
+func newRegisterCommand(cfg *agentConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "register",
+		Short: "Register the host with the management cluster and exit",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostName, err := resolveHostName(cfg)
+			if err != nil {
+				return err
+			}
+			if _, _, err = registerHost(cfg, newHostLabeler(cfg, hostName)); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "ByoHost %s/%s registered\n", cfg.namespace, hostName)
+			return nil
+		},
+	}
+}
+
+func newDeregisterCommand(cfg *agentConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "deregister",
+		Short: "Remove the ByoHost of this host from the management cluster",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.TODO()
+			byoHost, k8sClient, err := getLocalByoHost(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			if byoHost.Status.MachineRef != nil {
+				return fmt.Errorf("ByoHost %s is attached to %s %s/%s, release it before deregistering",
+					byoHost.Name, byoHost.Status.MachineRef.Kind, byoHost.Status.MachineRef.Namespace, byoHost.Status.MachineRef.Name)
+			}
+			if err = k8sClient.Delete(ctx, byoHost); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("error deleting ByoHost %s: %v", byoHost.Name, err)
+			}
+			if err = registration.RemoveMovedNamespace(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "ByoHost %s/%s deregistered\n", byoHost.Namespace, byoHost.Name)
+			return nil
+		},
+	}
+}
+
+func newStatusCommand(cfg *agentConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the ByoHost of this host and its conditions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			byoHost, _, err := getLocalByoHost(context.TODO(), cfg)
+			if err != nil {
+				return err
+			}
+			printStatus(cmd, byoHost)
+			return nil
+		},
+	}
+}
+
+func printStatus(cmd *cobra.Command, byoHost *infrastructurev1beta1.ByoHost) {
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "ByoHost:\t%s/%s\n", byoHost.Namespace, byoHost.Name)
+	if byoHost.Status.MachineRef != nil {
+		fmt.Fprintf(out, "Attached to:\t%s %s/%s\n", byoHost.Status.MachineRef.Kind, byoHost.Status.MachineRef.Namespace, byoHost.Status.MachineRef.Name)
+	} else {
+		fmt.Fprintf(out, "Attached to:\t<none>\n")
+	}
+	fmt.Fprintln(out)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0) //nolint: gomnd
+	fmt.Fprintln(w, "TYPE\tSTATUS\tSEVERITY\tREASON\tLAST TRANSITION\tMESSAGE")
+	for _, c := range byoHost.Status.Conditions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Type, c.Status, c.Severity, c.Reason, c.LastTransitionTime.UTC().Format("2006-01-02T15:04:05Z"), c.Message)
+	}
+	_ = w.Flush()
+}
+
+func newResetCommand(cfg *agentConfig) *cobra.Command {
+	var force bool
+	resetCmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Run kubeadm reset and uninstall the Kubernetes components from this host",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.TODO()
+			byoHost, k8sClient, err := getLocalByoHost(ctx, cfg)
+			if err != nil {
+				// reset is also meant for hosts that can no longer reach the management cluster
+				logger.Error(err, "unable to fetch ByoHost, only the local node will be reset")
+				byoHost = nil
+			}
+			if byoHost != nil && byoHost.Status.MachineRef != nil && !force {
+				return fmt.Errorf("ByoHost %s is attached to %s %s/%s, use --force to reset it anyway",
+					byoHost.Name, byoHost.Status.MachineRef.Kind, byoHost.Status.MachineRef.Namespace, byoHost.Status.MachineRef.Name)
+			}
+			return resetHost(ctx, cfg, k8sClient, byoHost)
+		},
+	}
+	resetCmd.Flags().BoolVar(&force, "force", false, "Reset the host even if it is attached to a ByoMachine")
+	return resetCmd
+}
+
+// resetHost runs kubeadm reset and the uninstall script of the host and, when the ByoHost is
+// available, records on it that the host is no longer a Kubernetes node.
+func resetHost(ctx context.Context, cfg *agentConfig, k8sClient client.Client, byoHost *infrastructurev1beta1.ByoHost) error {
+	runner := cloudinit.CmdRunner{}
+	logger.Info("Running kubeadm reset")
+	if err := runner.RunCmd(ctx, reconciler.KubeadmResetCommand); err != nil {
+		return fmt.Errorf("failed to exec kubeadm reset: %v", err)
+	}
+	if byoHost == nil {
+		return nil
+	}
+
+	helper, err := patch.NewHelper(byoHost, k8sClient)
+	if err != nil {
+		return err
+	}
+	if cfg.skipInstallation {
+		logger.Info("Skipping uninstallation of k8s components")
+	} else if byoHost.Spec.UninstallationScript != nil {
+		logger.Info("Executing Uninstall script")
+		uninstallScript, err := cloudinit.TemplateParser{
+			Template: map[string]string{
+				"BundleDownloadPath": cfg.downloadPath,
+			},
+		}.ParseTemplate(*byoHost.Spec.UninstallationScript)
+		if err != nil {
+			return fmt.Errorf("unable to parse uninstall script: %v", err)
+		}
+		if err = runner.RunCmd(ctx, uninstallScript); err != nil {
+			return fmt.Errorf("error executing uninstall script: %v", err)
+		}
+		byoHost.Spec.UninstallationScript = nil
+		conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded, infrastructurev1beta1.K8sNodeAbsentReason, clusterv1.ConditionSeverityInfo, "")
+	}
+	conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.K8sNodeAbsentReason, clusterv1.ConditionSeverityInfo, "")
+	return helper.Patch(ctx, byoHost)
+}
+
+func newVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version of the agent",
+		Args:  cobra.NoArgs,
+		// the version does not depend on the agent configuration
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			printVersion()
+		},
+	}
+}
+
+func newPreflightCommand(cfg *agentConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "preflight",
+		Short: "Check that this host is ready to be registered and bootstrapped",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPreflightChecks(cmd.OutOrStdout(), cfg)
+		},
+	}
+}
+
+// getLocalByoHost fetches the ByoHost registered by this host
+func getLocalByoHost(ctx context.Context, cfg *agentConfig) (*infrastructurev1beta1.ByoHost, client.Client, error) {
+	hostName, err := resolveHostName(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, k8sClient, err := getClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	byoHost := &infrastructurev1beta1.ByoHost{}
+	if err = k8sClient.Get(ctx, types.NamespacedName{Name: hostName, Namespace: cfg.namespace}, byoHost); err != nil {
+		return nil, k8sClient, fmt.Errorf("error getting ByoHost %s in namespace %s: %v", hostName, cfg.namespace, err)
+	}
+	return byoHost, k8sClient, nil
+}
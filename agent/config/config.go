@@ -0,0 +1,155 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the version of the agent configuration file
+	APIVersion = "agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1"
+
+	// Kind is the kind of the agent configuration file
+	Kind = "AgentConfiguration"
+
+	// DefaultPath is where the agent looks for its configuration file when --config is not set
+	DefaultPath = "/etc/byoh/agent.yaml"
+
+	// MinCertExpirySeconds is the shortest certificate duration the kube-apiserver
+	// accepts in a CertificateSigningRequest
+	MinCertExpirySeconds = 600
+)
+
+// AgentConfiguration holds the settings of the host agent. Every field can
+// be overridden by the equivalent command line flag.
+type AgentConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Namespace in the management cluster where the host is registered
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Labels to attach to the ByoHost. Reloaded on SIGHUP.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// DownloadPath is the file system path to keep the downloads
+	// +optional
+	DownloadPath string `json:"downloadPath,omitempty"`
+
+	// SkipInstallation skips the installation of the kubernetes component binaries
+	// +optional
+	SkipInstallation *bool `json:"skipInstallation,omitempty"`
+
+	// BootstrapKubeconfig is the path to the bootstrap kubeconfig used for the bootstrap token workflow
+	// +optional
+	BootstrapKubeconfig string `json:"bootstrapKubeconfig,omitempty"`
+
+	// CertExpiryDuration is the duration (in seconds) for the expiration of the host certificates.
+	// Reloaded on SIGHUP.
+	// +optional
+	CertExpiryDuration *int64 `json:"certExpiryDuration,omitempty"`
+
+	// LabelRefreshInterval is how often the labels derived from the host facts
+	// are refreshed on the ByoHost, 0 to only refresh them when the agent starts
+	// +optional
+	LabelRefreshInterval *metav1.Duration `json:"labelRefreshInterval,omitempty"`
+
+	// FeatureGates enables or disables the alpha and beta features of the agent, e.g. CertificateRotation
+	// +optional
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+
+	// MetricsBindAddress is the TCP address the agent binds to for serving prometheus metrics
+	// +optional
+	MetricsBindAddress string `json:"metricsBindAddress,omitempty"`
+
+	// KeyDir is the directory of the client certificate and the keys of the host,
+	// defaults to the directory of the host kubeconfig
+	// +optional
+	KeyDir string `json:"keyDir,omitempty"`
+
+	// KeyAlgorithm is the algorithm of the private keys of the client certificates, RSA or ECDSA
+	// +optional
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+
+	// HostName is the name of the ByoHost, the common name of the client certificates and
+	// the Kubernetes node name of the host, defaults to its hostname. It is a Go template of
+	// the .Hostname, .ShortHostname, .MachineID and .ProductUUID of the host, normalized to
+	// a DNS-1123 subdomain, e.g. "{{.ShortHostname}}-{{.MachineID | trunc 8}}"
+	// +optional
+	HostName string `json:"hostName,omitempty"`
+}
+
+// Load reads the agent configuration file at path and validates it
+func Load(path string) (*AgentConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading agent configuration %s: %v", path, err)
+	}
+	agentConfig := &AgentConfiguration{}
+	if err = yaml.UnmarshalStrict(data, agentConfig); err != nil {
+		return nil, fmt.Errorf("error parsing agent configuration %s: %v", path, err)
+	}
+	if agentConfig.APIVersion != APIVersion || agentConfig.Kind != Kind {
+		return nil, fmt.Errorf("unsupported agent configuration %s %s, expected %s %s",
+			agentConfig.APIVersion, agentConfig.Kind, APIVersion, Kind)
+	}
+	if err = agentConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid agent configuration %s: %v", path, err)
+	}
+	return agentConfig, nil
+}
+
+// Validate checks the fields that are set on the configuration
+func (c *AgentConfiguration) Validate() error {
+	var allErrs field.ErrorList
+
+	if c.Namespace != "" {
+		for _, msg := range validation.IsDNS1123Label(c.Namespace) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("namespace"), c.Namespace, msg))
+		}
+	}
+
+	for key, value := range c.Labels {
+		for _, msg := range validation.IsQualifiedName(key) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("labels"), key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("labels").Key(key), value, msg))
+		}
+	}
+
+	if c.CertExpiryDuration != nil && *c.CertExpiryDuration < MinCertExpirySeconds {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("certExpiryDuration"), *c.CertExpiryDuration,
+			fmt.Sprintf("must be at least %d seconds", MinCertExpirySeconds)))
+	}
+
+	if c.LabelRefreshInterval != nil && c.LabelRefreshInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("labelRefreshInterval"), c.LabelRefreshInterval.Duration.String(),
+			"must not be negative"))
+	}
+
+	switch c.KeyAlgorithm {
+	case "", registration.KeyAlgorithmRSA, registration.KeyAlgorithmECDSA:
+	default:
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("keyAlgorithm"), c.KeyAlgorithm,
+			[]string{registration.KeyAlgorithmRSA, registration.KeyAlgorithmECDSA}))
+	}
+
+	if c.HostName != "" {
+		if _, err := registration.ParseHostNameTemplate(c.HostName); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("hostName"), c.HostName, err.Error()))
+		}
+	}
+
+	return allErrs.ToAggregate()
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/config"
+	"k8s.io/utils/pointer"
+)
+
+var _ = Describe("Agent configuration", func() {
+	var (
+		configFile string
+	)
+
+	BeforeEach(func() {
+		configFile = filepath.Join(GinkgoT().TempDir(), "agent.yaml")
+	})
+
+	writeConfig := func(content string) {
+		Expect(os.WriteFile(configFile, []byte(content), 0600)).To(Succeed())
+	}
+
+	Context("When the configuration file is valid", func() {
+		It("should load all the settings", func() {
+			writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+namespace: byoh-pool
+labels:
+  site: apac
+downloadPath: /var/lib/byoh/bundles
+skipInstallation: true
+bootstrapKubeconfig: /etc/byoh/bootstrap-kubeconfig.conf
+certExpiryDuration: 3600
+metricsBindAddress: "0"
+keyDir: /etc/byoh/pki
+keyAlgorithm: ECDSA
+hostName: "{{.ShortHostname}}-{{.MachineID | trunc 8}}"
+`)
+			agentConfig, err := config.Load(configFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(agentConfig.Namespace).To(Equal("byoh-pool"))
+			Expect(agentConfig.Labels).To(Equal(map[string]string{"site": "apac"}))
+			Expect(agentConfig.DownloadPath).To(Equal("/var/lib/byoh/bundles"))
+			Expect(agentConfig.SkipInstallation).To(Equal(pointer.Bool(true)))
+			Expect(agentConfig.BootstrapKubeconfig).To(Equal("/etc/byoh/bootstrap-kubeconfig.conf"))
+			Expect(agentConfig.CertExpiryDuration).To(Equal(pointer.Int64(3600)))
+			Expect(agentConfig.MetricsBindAddress).To(Equal("0"))
+			Expect(agentConfig.KeyDir).To(Equal("/etc/byoh/pki"))
+			Expect(agentConfig.KeyAlgorithm).To(Equal("ECDSA"))
+			Expect(agentConfig.HostName).To(Equal("{{.ShortHostname}}-{{.MachineID | trunc 8}}"))
+		})
+	})
+
+	Context("When the configuration file is not valid", func() {
+		It("should reject a missing file", func() {
+			_, err := config.Load(filepath.Join(GinkgoT().TempDir(), "missing.yaml"))
+			Expect(err).To(MatchError(ContainSubstring("error reading agent configuration")))
+		})
+
+		It("should reject an unknown version", func() {
+			writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1alpha1
+kind: AgentConfiguration
+`)
+			_, err := config.Load(configFile)
+			Expect(err).To(MatchError(ContainSubstring("unsupported agent configuration")))
+		})
+
+		It("should reject unknown fields", func() {
+			writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+namespaces: byoh-pool
+`)
+			_, err := config.Load(configFile)
+			Expect(err).To(MatchError(ContainSubstring("error parsing agent configuration")))
+		})
+
+		It("should reject invalid labels", func() {
+			writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+labels:
+  "bad key": value
+`)
+			_, err := config.Load(configFile)
+			Expect(err).To(MatchError(ContainSubstring("labels")))
+		})
+
+		It("should reject a too short certificate duration", func() {
+			writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+certExpiryDuration: 60
+`)
+			_, err := config.Load(configFile)
+			Expect(err).To(MatchError(ContainSubstring("certExpiryDuration")))
+		})
+
+		It("should reject an invalid namespace", func() {
+			writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+namespace: Not_A_Namespace
+`)
+			_, err := config.Load(configFile)
+			Expect(err).To(MatchError(ContainSubstring("namespace")))
+		})
+
+		It("should reject an unsupported key algorithm", func() {
+			writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+keyAlgorithm: DSA
+`)
+			_, err := config.Load(configFile)
+			Expect(err).To(MatchError(ContainSubstring("keyAlgorithm")))
+		})
+
+		It("should reject an invalid host name template", func() {
+			writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+hostName: "{{.Hostname"
+`)
+			_, err := config.Load(configFile)
+			Expect(err).To(MatchError(ContainSubstring("hostName")))
+		})
+	})
+})
@@ -0,0 +1,269 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	pflag "github.com/spf13/pflag"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/config"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/feature"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// agentSettings are the effective settings of the agent, resolved from the
+// command line flags and the agent configuration file
+type agentSettings struct {
+	namespace           string
+	labels              labelFlags
+	metricsBindAddress  string
+	downloadPath        string
+	skipInstallation    bool
+	bootstrapKubeConfig string
+	certExpiryDuration  int64
+	// labelRefreshInterval is how often the labels derived from the host facts are refreshed
+	labelRefreshInterval time.Duration
+	featureGates         map[string]bool
+	// keyDir is the directory of the client certificate and the keys of the host
+	keyDir       string
+	keyAlgorithm string
+	// hostName is the template of the name of the host, see registration.ResolveHostName
+	hostName string
+}
+
+// agentConfig holds the settings shared by all the agent subcommands
+type agentConfig struct {
+	agentSettings
+	configFile   string
+	printVersion bool
+
+	// flags and flagSettings keep what was passed on the command line,
+	// flags always take precedence over the configuration file
+	flags        *pflag.FlagSet
+	flagSettings agentSettings
+
+	// mu guards the mutable settings that are changed on SIGHUP
+	mu sync.RWMutex
+}
+
+func newAgentConfig() *agentConfig {
+	return &agentConfig{agentSettings: agentSettings{labels: make(labelFlags)}}
+}
+
+// configFilePath returns the configuration file to use, if any
+func (c *agentConfig) configFilePath() string {
+	if c.configFile != "" {
+		return c.configFile
+	}
+	if _, err := os.Stat(config.DefaultPath); err == nil {
+		return config.DefaultPath
+	}
+	return ""
+}
+
+// loadConfigFile resolves the settings of the agent from the parsed flags and the configuration file
+func (c *agentConfig) loadConfigFile(flags *pflag.FlagSet) error {
+	c.flags = flags
+	c.flagSettings = c.agentSettings
+	c.flagSettings.labels = make(labelFlags, len(c.labels))
+	for k, v := range c.labels {
+		c.flagSettings.labels[k] = v
+	}
+
+	settings, err := c.resolve()
+	if err != nil {
+		return err
+	}
+	c.agentSettings = settings
+	registration.KeyDir = settings.keyDir
+	// feature gates are only set when the agent starts
+	if len(settings.featureGates) > 0 {
+		if err = feature.MutableGates.SetFromMap(settings.featureGates); err != nil {
+			return fmt.Errorf("invalid featureGates in the agent configuration: %v", err)
+		}
+	}
+	return nil
+}
+
+// resolve applies the configuration file on top of the command line defaults
+func (c *agentConfig) resolve() (agentSettings, error) {
+	settings := c.flagSettings
+	settings.labels = make(labelFlags)
+	namespaceSet := c.flags.Changed("namespace")
+
+	if path := c.configFilePath(); path != "" {
+		fileConfig, err := config.Load(path)
+		if err != nil {
+			return agentSettings{}, err
+		}
+		if fileConfig.Namespace != "" && !namespaceSet {
+			settings.namespace = fileConfig.Namespace
+			namespaceSet = true
+		}
+		if fileConfig.MetricsBindAddress != "" && !c.flags.Changed("metricsbindaddress") {
+			settings.metricsBindAddress = fileConfig.MetricsBindAddress
+		}
+		if fileConfig.DownloadPath != "" && !c.flags.Changed("downloadpath") {
+			settings.downloadPath = fileConfig.DownloadPath
+		}
+		if fileConfig.SkipInstallation != nil && !c.flags.Changed("skip-installation") {
+			settings.skipInstallation = *fileConfig.SkipInstallation
+		}
+		if fileConfig.BootstrapKubeconfig != "" && !c.flags.Changed("bootstrap-kubeconfig") {
+			settings.bootstrapKubeConfig = fileConfig.BootstrapKubeconfig
+		}
+		if fileConfig.CertExpiryDuration != nil && !c.flags.Changed("certExpiryDuration") {
+			settings.certExpiryDuration = *fileConfig.CertExpiryDuration
+		}
+		if fileConfig.LabelRefreshInterval != nil && !c.flags.Changed("label-refresh-interval") {
+			settings.labelRefreshInterval = fileConfig.LabelRefreshInterval.Duration
+		}
+		if fileConfig.KeyDir != "" && !c.flags.Changed("key-dir") {
+			settings.keyDir = fileConfig.KeyDir
+		}
+		if fileConfig.KeyAlgorithm != "" && !c.flags.Changed("key-algorithm") {
+			settings.keyAlgorithm = fileConfig.KeyAlgorithm
+		}
+		if fileConfig.HostName != "" && !c.flags.Changed("host-name") {
+			settings.hostName = fileConfig.HostName
+		}
+		if fileConfig.FeatureGates != nil && !c.flags.Changed("feature-gates") {
+			settings.featureGates = fileConfig.FeatureGates
+		}
+		for k, v := range fileConfig.Labels {
+			settings.labels[k] = v
+		}
+	}
+	// --label flags are merged with the labels of the configuration file
+	for k, v := range c.flagSettings.labels {
+		settings.labels[k] = v
+	}
+	if !namespaceSet {
+		if namespace := kubeconfigNamespace(settings.bootstrapKubeConfig); namespace != "" {
+			settings.namespace = namespace
+		}
+	}
+	// a host moved to another namespace by an operator stays there until it is deregistered
+	movedNamespace, err := registration.LoadMovedNamespace()
+	if err != nil {
+		return agentSettings{}, err
+	}
+	if movedNamespace != "" {
+		settings.namespace = movedNamespace
+	}
+
+	return settings, settings.validate()
+}
+
+// kubeconfigNamespace returns the namespace the host was bootstrapped for, i.e. the one of the
+// context of the host kubeconfig or, before the bootstrap, of the bootstrap kubeconfig
+func kubeconfigNamespace(bootstrapKubeconfig string) string {
+	for _, path := range []string{registration.GetBYOHConfigPath(), bootstrapKubeconfig} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if namespace, err := registration.KubeconfigNamespace(path); err == nil {
+			return namespace
+		}
+	}
+	return ""
+}
+
+func (s *agentSettings) validate() error {
+	return (&config.AgentConfiguration{
+		Namespace:            s.namespace,
+		Labels:               s.labels,
+		CertExpiryDuration:   &s.certExpiryDuration,
+		LabelRefreshInterval: &metav1.Duration{Duration: s.labelRefreshInterval},
+		KeyAlgorithm:         s.keyAlgorithm,
+		HostName:             s.hostName,
+	}).Validate()
+}
+
+// reload re-reads the configuration file and applies the settings that can
+// be changed while the agent is running, i.e. labels and certExpiryDuration.
+// It returns true if the host labels changed.
+func (c *agentConfig) reload() (bool, error) {
+	if c.configFilePath() == "" {
+		return false, errors.New("no agent configuration file to reload")
+	}
+	settings, err := c.resolve()
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	immutable := c.agentSettings
+	immutable.labels, immutable.certExpiryDuration = settings.labels, settings.certExpiryDuration
+	if !reflect.DeepEqual(immutable, settings) {
+		logger.Info("only labels and certExpiryDuration are reloaded, restart the agent to apply the other changes")
+	}
+	labelsChanged := !reflect.DeepEqual(c.labels, settings.labels)
+	c.labels = settings.labels
+	c.certExpiryDuration = settings.certExpiryDuration
+	return labelsChanged, nil
+}
+
+// hostLabels returns the labels the agent attaches to its ByoHost
+func (c *agentConfig) hostLabels() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	labels := make(map[string]string, len(c.labels))
+	for k, v := range c.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// certExpiry returns the duration (in seconds) of the host certificates
+func (c *agentConfig) certExpiry() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.certExpiryDuration
+}
+
+// watchConfigReload reloads the agent configuration on SIGHUP, re-applies
+// the labels to the ByoHost and the certificate duration to the next
+// certificate renewals until ctx is done
+func watchConfigReload(ctx context.Context, cfg *agentConfig, labeler *hostLabeler, certManager *registration.CertificateManager) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			logger.Info("SIGHUP received, reloading agent configuration")
+			labelsChanged, err := cfg.reload()
+			if err != nil {
+				logger.Error(err, "failed to reload agent configuration, keeping the current one")
+				continue
+			}
+			if certManager != nil {
+				certManager.SetCertificateLifetime(cfg.certExpiry())
+			}
+			if !labelsChanged {
+				continue
+			}
+			if err = labeler.sync(ctx); err != nil {
+				logger.Error(err, "failed to update ByoHost labels")
+			}
+		}
+	}
+}
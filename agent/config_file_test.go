@@ -0,0 +1,188 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint: nolintlint,testpackage
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	pflag "github.com/spf13/pflag"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
+)
+
+var _ = Describe("Agent configuration file", func() {
+	var (
+		cfg        *agentConfig
+		flags      *pflag.FlagSet
+		configFile string
+	)
+
+	writeConfig := func(content string) {
+		Expect(os.WriteFile(configFile, []byte(content), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		configFile = filepath.Join(GinkgoT().TempDir(), "agent.yaml")
+		cfg = newAgentConfig()
+		flags = pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flags.StringVar(&cfg.configFile, "config", "", "")
+		flags.StringVar(&cfg.namespace, "namespace", "default", "")
+		flags.Int64Var(&cfg.certExpiryDuration, "certExpiryDuration", 86400, "")
+		flags.Var(&cfg.labels, "label", "")
+		flags.StringVar(&cfg.metricsBindAddress, "metricsbindaddress", ":8080", "")
+		flags.StringVar(&cfg.downloadPath, "downloadpath", "/var/lib/byoh/bundles", "")
+		flags.BoolVar(&cfg.skipInstallation, "skip-installation", false, "")
+		flags.StringVar(&cfg.bootstrapKubeConfig, "bootstrap-kubeconfig", "", "")
+		flags.DurationVar(&cfg.labelRefreshInterval, "label-refresh-interval", 10*time.Minute, "")
+		flags.StringVar(&cfg.keyDir, "key-dir", "", "")
+		flags.StringVar(&cfg.keyAlgorithm, "key-algorithm", registration.KeyAlgorithmRSA, "")
+		flags.StringVar(&cfg.hostName, "host-name", "", "")
+
+		writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+namespace: byoh-pool
+downloadPath: /opt/byoh
+certExpiryDuration: 3600
+labelRefreshInterval: 5m
+labels:
+  site: apac
+  rack: r1
+`)
+	})
+
+	It("should apply the configuration file to the flags that are not set", func() {
+		Expect(flags.Parse([]string{"--config", configFile, "--downloadpath", "/tmp/bundles"})).To(Succeed())
+		Expect(cfg.loadConfigFile(flags)).To(Succeed())
+
+		Expect(cfg.namespace).To(Equal("byoh-pool"))
+		Expect(cfg.downloadPath).To(Equal("/tmp/bundles"))
+		Expect(cfg.certExpiry()).To(Equal(int64(3600)))
+		Expect(cfg.metricsBindAddress).To(Equal(":8080"))
+		Expect(cfg.labelRefreshInterval).To(Equal(5 * time.Minute))
+	})
+
+	It("should use the key directory of the configuration file", func() {
+		writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+keyDir: /etc/byoh/pki
+keyAlgorithm: ECDSA
+`)
+		Expect(flags.Parse([]string{"--config", configFile})).To(Succeed())
+		Expect(cfg.loadConfigFile(flags)).To(Succeed())
+		defer func() { registration.KeyDir = "" }()
+
+		Expect(cfg.keyAlgorithm).To(Equal(registration.KeyAlgorithmECDSA))
+		Expect(registration.GetKeyDir()).To(Equal("/etc/byoh/pki"))
+	})
+
+	It("should reject an unsupported key algorithm flag", func() {
+		Expect(flags.Parse([]string{"--config", configFile, "--key-algorithm", "DSA"})).To(Succeed())
+		Expect(cfg.loadConfigFile(flags)).To(MatchError(ContainSubstring("keyAlgorithm")))
+	})
+
+	It("should let the host name flag override the configuration file", func() {
+		writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+hostName: "{{.ShortHostname}}"
+`)
+		Expect(flags.Parse([]string{"--config", configFile})).To(Succeed())
+		Expect(cfg.loadConfigFile(flags)).To(Succeed())
+		Expect(cfg.hostName).To(Equal("{{.ShortHostname}}"))
+
+		Expect(flags.Parse([]string{"--host-name", "Worker-01"})).To(Succeed())
+		Expect(cfg.loadConfigFile(flags)).To(Succeed())
+		Expect(cfg.hostName).To(Equal("Worker-01"))
+	})
+
+	It("should merge the label flags with the labels of the configuration file", func() {
+		Expect(flags.Parse([]string{"--config", configFile, "--label", "site=emea,cores=2"})).To(Succeed())
+		Expect(cfg.loadConfigFile(flags)).To(Succeed())
+
+		Expect(cfg.hostLabels()).To(Equal(map[string]string{"site": "emea", "rack": "r1", "cores": "2"}))
+	})
+
+	It("should reject invalid flag values", func() {
+		Expect(flags.Parse([]string{"--config", configFile, "--label", "bad key=value"})).To(Succeed())
+		Expect(cfg.loadConfigFile(flags)).To(MatchError(ContainSubstring("labels")))
+	})
+
+	It("should only reload the mutable settings", func() {
+		Expect(flags.Parse([]string{"--config", configFile})).To(Succeed())
+		Expect(cfg.loadConfigFile(flags)).To(Succeed())
+
+		writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+namespace: another-pool
+certExpiryDuration: 7200
+labels:
+  site: emea
+`)
+		labelsChanged, err := cfg.reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labelsChanged).To(BeTrue())
+		Expect(cfg.hostLabels()).To(Equal(map[string]string{"site": "emea"}))
+		Expect(cfg.certExpiry()).To(Equal(int64(7200)))
+		Expect(cfg.namespace).To(Equal("byoh-pool"))
+	})
+
+	Context("When the namespace is not configured", func() {
+		var bootstrapKubeconfig string
+
+		BeforeEach(func() {
+			writeConfig(`apiVersion: agent.byoh.infrastructure.cluster.x-k8s.io/v1beta1
+kind: AgentConfiguration
+`)
+			registration.ConfigPath = filepath.Join(GinkgoT().TempDir(), "config")
+			bootstrapKubeconfig = filepath.Join(GinkgoT().TempDir(), "bootstrap-kubeconfig")
+			Expect(os.WriteFile(bootstrapKubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://cluster-a.com
+  name: cluster-a
+contexts:
+- context:
+    cluster: cluster-a
+    namespace: byoh-pool
+    user: user-a
+  name: context-a
+current-context: context-a
+users:
+- name: user-a
+  user:
+    token: abcdef.0123456789abcdef
+`), 0600)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			registration.ConfigPath = ""
+		})
+
+		It("should use the namespace of the bootstrap kubeconfig context", func() {
+			Expect(flags.Parse([]string{"--config", configFile, "--bootstrap-kubeconfig", bootstrapKubeconfig})).To(Succeed())
+			Expect(cfg.loadConfigFile(flags)).To(Succeed())
+			Expect(cfg.namespace).To(Equal("byoh-pool"))
+		})
+
+		It("should prefer the namespace flag", func() {
+			Expect(flags.Parse([]string{"--config", configFile, "--bootstrap-kubeconfig", bootstrapKubeconfig, "--namespace", "default"})).To(Succeed())
+			Expect(cfg.loadConfigFile(flags)).To(Succeed())
+			Expect(cfg.namespace).To(Equal("default"))
+		})
+	})
+
+	It("should keep the current settings if the configuration file became invalid", func() {
+		Expect(flags.Parse([]string{"--config", configFile})).To(Succeed())
+		Expect(cfg.loadConfigFile(flags)).To(Succeed())
+
+		writeConfig(`kind: SomethingElse`)
+		_, err := cfg.reload()
+		Expect(err).To(HaveOccurred())
+		Expect(cfg.hostLabels()).To(Equal(map[string]string{"site": "apac", "rack": "r1"}))
+	})
+})
@@ -19,15 +19,27 @@ var _ = Describe("Help flag for host agent", func() {
 			expectedOptions = []string{
 				"--bootstrap-kubeconfig string",
 				"--certExpiryDuration int",
+				"--config string",
 				"--downloadpath string",
 				"--kubeconfig string",
 				"--label labelFlags",
+				"--label-refresh-interval duration",
 				"--metricsbindaddress string",
 				"--namespace string",
 				"--skip-installation",
 				"--version",
 				"-v, --v",
 				"--feature-gates mapStringBool",
+				"-h, --help",
+			}
+			expectedCommands = []string{
+				"run",
+				"register",
+				"deregister",
+				"status",
+				"reset",
+				"version",
+				"preflight",
 			}
 		)
 
@@ -37,7 +49,7 @@ var _ = Describe("Help flag for host agent", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(session, "5s").Should(gexec.Exit())
 
-			output := string(session.Err.Contents())
+			output := string(session.Out.Contents())
 			for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
 				line = strings.TrimSpace(line)
 				if !strings.HasPrefix(line, "-") {
@@ -51,5 +63,16 @@ var _ = Describe("Help flag for host agent", func() {
 
 		})
 
+		It("should list the agent subcommands", func() {
+			command := exec.Command(pathToHostAgentBinary, "--help")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, "5s").Should(gexec.Exit(0))
+
+			output := string(session.Out.Contents())
+			for _, subcommand := range expectedCommands {
+				Expect(output).To(MatchRegexp(`(?m)^\s+%s\s`, subcommand))
+			}
+		})
 	})
 })
@@ -0,0 +1,78 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
+)
+
+// hostLabeler keeps the ByoHost labels in sync with the labels the agent is
+// configured with and the labels derived from the host facts
+type hostLabeler struct {
+	cfg      *agentConfig
+	hostName string
+	discover func() (*registration.HostFacts, error)
+
+	// mu serializes the periodic syncs with the ones triggered by SIGHUP
+	mu sync.Mutex
+}
+
+func newHostLabeler(cfg *agentConfig, hostName string) *hostLabeler {
+	return &hostLabeler{
+		cfg:      cfg,
+		hostName: hostName,
+		discover: func() (*registration.HostFacts, error) {
+			return registration.LocalHostRegistrar.DiscoverHostFacts()
+		},
+	}
+}
+
+// desiredLabels returns the discovered labels overridden by the configured ones
+func (l *hostLabeler) desiredLabels() map[string]string {
+	labels := make(map[string]string)
+	facts, err := l.discover()
+	if err != nil {
+		logger.Error(err, "failed to discover host facts, skipping the fact labels")
+	} else {
+		for k, v := range facts.Labels() {
+			labels[k] = v
+		}
+	}
+	for k, v := range l.cfg.hostLabels() {
+		labels[k] = v
+	}
+	return labels
+}
+
+// sync applies the desired labels to the ByoHost, removing the ones the
+// agent set before that are no longer desired
+func (l *hostLabeler) sync(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return registration.LocalHostRegistrar.UpdateLabels(ctx, l.hostName, registration.LocalHostRegistrar.Namespace(), l.desiredLabels())
+}
+
+// start syncs the labels every interval until ctx is done, so that changes of
+// the host facts (e.g. a GPU added) are reflected on the ByoHost
+func (l *hostLabeler) start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.sync(ctx); err != nil {
+				logger.Error(err, "failed to sync ByoHost labels")
+			}
+		}
+	}
+}
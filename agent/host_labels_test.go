@@ -0,0 +1,43 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint: nolintlint,testpackage
+package main
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
+)
+
+var _ = Describe("Host labeler", func() {
+	var labeler *hostLabeler
+
+	BeforeEach(func() {
+		cfg := newAgentConfig()
+		cfg.labels = labelFlags{"site": "apac", registration.GPULabel: "false"}
+		labeler = newHostLabeler(cfg, "test-host")
+	})
+
+	It("should merge the fact labels with the configured labels", func() {
+		labeler.discover = func() (*registration.HostFacts, error) {
+			return &registration.HostFacts{Architecture: "arm64", CPUs: 2, GPUVendors: []string{"nvidia"}}, nil
+		}
+		Expect(labeler.desiredLabels()).To(Equal(map[string]string{
+			"site":                     "apac",
+			registration.ArchLabel:     "arm64",
+			registration.CPUCountLabel: "2-3",
+			registration.GPULabel:      "false",
+			registration.GPUVendorLabelPrefix + "nvidia": "true",
+		}))
+	})
+
+	It("should keep the configured labels when the facts cannot be discovered", func() {
+		labeler.discover = func() (*registration.HostFacts, error) {
+			return nil, errors.New("no /proc")
+		}
+		Expect(labeler.desiredLabels()).To(Equal(map[string]string{"site": "apac", registration.GPULabel: "false"}))
+	})
+})
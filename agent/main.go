@@ -4,9 +4,6 @@
 package main
 
 import (
-	"context"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
@@ -15,12 +12,16 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
 	pflag "github.com/spf13/pflag"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/cloudinit"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/config"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/reconciler"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/version"
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/encryption"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/hostidentity"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/feature"
 	certv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -81,114 +82,183 @@ func (l *labelFlags) Set(value string) error {
 	}
 }
 
-func setupflags() {
+// Type implements pflag.Value interface
+func (l *labelFlags) Type() string {
+	return "labelFlags"
+}
+
+func setupflags(flags *pflag.FlagSet, cfg *agentConfig) {
 	klog.InitFlags(nil)
 	// clear any discard loggers set by dependecies
 	klog.ClearLogger()
 
-	flag.StringVar(&namespace, "namespace", "default", "Namespace in the management cluster where you would like to register this host")
-	flag.Int64Var(&certExpiryDuration, "certExpiryDuration", registration.ExpirationSeconds, "Duration (in seconds) for the expiration of the host certificates")
-	flag.Var(&labels, "label", "labels to attach to the ByoHost CR in the form labelname=labelVal for e.g. '--label site=apac --label cores=2'")
-	flag.StringVar(&metricsbindaddress, "metricsbindaddress", ":8080", "metricsbindaddress is the TCP address that the controller should bind to for serving prometheus metrics.It can be set to \"0\" to disable the metrics serving")
-	flag.StringVar(&downloadpath, "downloadpath", "/var/lib/byoh/bundles", "File System path to keep the downloads")
-	flag.BoolVar(&skipInstallation, "skip-installation", false, "If you want to skip installation of the kubernetes component binaries")
-	flag.BoolVar(&printVersion, "version", false, "Print the version of the agent")
-	flag.StringVar(&bootstrapKubeConfig, "bootstrap-kubeconfig", "", "Provide bootstrap kubeconfig for bootstrap token workflow")
+	flags.StringVar(&cfg.configFile, "config", "", fmt.Sprintf("Path to the agent configuration file, flags override its settings (default %q if it exists)", config.DefaultPath))
+	flags.StringVar(&cfg.namespace, "namespace", "default", "Namespace in the management cluster where you would like to register this host, defaults to the namespace of the kubeconfig context")
+	flags.Int64Var(&cfg.certExpiryDuration, "certExpiryDuration", registration.ExpirationSeconds, "Duration (in seconds) for the expiration of the host certificates")
+	flags.Var(&cfg.labels, "label", "labels to attach to the ByoHost CR in the form labelname=labelVal for e.g. '--label site=apac --label cores=2'")
+	flags.StringVar(&cfg.metricsBindAddress, "metricsbindaddress", ":8080", "metricsbindaddress is the TCP address that the controller should bind to for serving prometheus metrics.It can be set to \"0\" to disable the metrics serving")
+	flags.StringVar(&cfg.downloadPath, "downloadpath", "/var/lib/byoh/bundles", "File System path to keep the downloads")
+	flags.BoolVar(&cfg.skipInstallation, "skip-installation", false, "If you want to skip installation of the kubernetes component binaries")
+	flags.BoolVar(&cfg.printVersion, "version", false, "Print the version of the agent")
+	flags.StringVar(&cfg.bootstrapKubeConfig, "bootstrap-kubeconfig", "", "Provide bootstrap kubeconfig for bootstrap token workflow")
+	flags.DurationVar(&cfg.labelRefreshInterval, "label-refresh-interval", 10*time.Minute, "Interval at which the labels derived from the host facts are refreshed on the ByoHost, 0 to only refresh them on start") //nolint: gomnd
+	flags.StringVar(&cfg.keyDir, "key-dir", "", "Directory of the client certificate and the keys of the host, created with 0700 permissions (defaults to the directory of the host kubeconfig)")
+	flags.StringVar(&cfg.keyAlgorithm, "key-algorithm", registration.KeyAlgorithmRSA, "Algorithm of the private keys of the client certificates, RSA or ECDSA")
+	flags.StringVar(&cfg.hostName, "host-name", "", "Name of the ByoHost, also the common name of the client certificates and the node name of the host, defaults to the hostname. "+
+		"A Go template of the .Hostname, .ShortHostname, .MachineID and .ProductUUID of the host, e.g. '{{.ShortHostname}}-{{.MachineID | trunc 8}}', normalized to a DNS-1123 subdomain")
 
-	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	flags.AddGoFlagSet(flag.CommandLine)
 	hiddenFlags := []string{"log-flush-frequency", "alsologtostderr", "log-backtrace-at", "log-dir", "logtostderr", "stderrthreshold", "vmodule", "azure-container-registry-config",
 		"log_backtrace_at", "log_dir", "log_file", "log_file_max_size", "add_dir_header", "skip_headers", "skip_log_headers", "one_output", "kubeconfig"}
 	for _, hiddenFlag := range hiddenFlags {
-		_ = pflag.CommandLine.MarkHidden(hiddenFlag)
+		_ = flags.MarkHidden(hiddenFlag)
 	}
-	feature.MutableGates.AddFlag(pflag.CommandLine)
+	feature.MutableGates.AddFlag(flags)
 }
 
-func setupTemplateParser() *cloudinit.TemplateParser {
-	var templateParser *cloudinit.TemplateParser
-	if registration.LocalHostRegistrar.ByoHostInfo.DefaultNetworkInterfaceName == "" {
-		templateParser = nil
-	} else {
-		templateParser = &cloudinit.TemplateParser{
-			Template: registration.HostInfo{
-				DefaultNetworkInterfaceName: registration.LocalHostRegistrar.ByoHostInfo.DefaultNetworkInterfaceName,
-			},
-		}
+// newRootCommand returns the agent command. Running it without a subcommand
+// is the same as "run" so that existing unit files keep working.
+func newRootCommand(cfg *agentConfig) *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:           "byoh-hostagent",
+		Short:         "Registers this host with a BYOH management cluster and bootstraps it as a Kubernetes node",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return cfg.loadConfigFile(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.printVersion {
+				printVersion()
+				return nil
+			}
+			return runAgent(cfg)
+		},
 	}
-	return templateParser
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	setupflags(rootCmd.PersistentFlags(), cfg)
+
+	rootCmd.AddCommand(
+		newRunCommand(cfg),
+		newRegisterCommand(cfg),
+		newDeregisterCommand(cfg),
+		newStatusCommand(cfg),
+		newResetCommand(cfg),
+		newVersionCommand(),
+		newPreflightCommand(cfg),
+	)
+	return rootCmd
 }
 
 var (
-	namespace           string
-	scheme              *runtime.Scheme
-	labels              = make(labelFlags)
-	metricsbindaddress  string
-	downloadpath        string
-	skipInstallation    bool
-	printVersion        bool
-	bootstrapKubeConfig string
-	certExpiryDuration  int64
+	scheme = runtime.NewScheme()
+	logger = klogr.New()
 )
 
-// TODO - fix logging
-func main() {
-	setupflags()
-	pflag.Parse()
-	if printVersion {
-		info := version.Get()
-		fmt.Printf("byoh-hostagent version: %#v\n", info)
-		return
-	}
-	scheme = runtime.NewScheme()
+func init() {
 	_ = infrastructurev1beta1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
 	_ = clusterv1.AddToScheme(scheme)
 	_ = certv1.AddToScheme(scheme)
+}
 
-	logger := klogr.New()
+// TODO - fix logging
+func main() {
+	cfg := newAgentConfig()
+	rootCmd := newRootCommand(cfg)
 	ctrl.SetLogger(logger)
-	hostName, err := os.Hostname()
-	if err != nil {
-		logger.Error(err, "could not determine hostname")
-		return
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
+}
 
-	_, err = os.Stat(registration.GetBYOHConfigPath())
+func printVersion() {
+	info := version.Get()
+	fmt.Printf("byoh-hostagent version: %#v\n", info)
+}
+
+// registerHost makes sure the host has a kubeconfig for the management cluster,
+// running the bootstrap flow if needed, and then registers the ByoHost and syncs its labels.
+func registerHost(cfg *agentConfig, labeler *hostLabeler) (*rest.Config, client.Client, error) {
+	hostName := labeler.hostName
+	_, err := os.Stat(registration.GetBYOHConfigPath())
 	// Enable bootstrap flow if --bootstrap-kubeconfig is provided
 	// and config doesn't already exists in ~/.byoh/
-	if bootstrapKubeConfig != "" && errors.Is(err, os.ErrNotExist) {
-		if err = handleBootstrapFlow(logger, hostName); err != nil {
-			logger.Error(err, "bootstrap flow failed")
-			os.Exit(1)
+	if cfg.bootstrapKubeConfig != "" && errors.Is(err, os.ErrNotExist) {
+		if err = handleBootstrapFlow(logger, cfg, hostName); err != nil {
+			return nil, nil, fmt.Errorf("bootstrap flow failed: %v", err)
 		}
 	}
 	// Handle restart flow or if the ~/.byoh/config already exists
-	config := getConfig(logger)
-	k8sClient := getClient(logger, config)
-	registration.LocalHostRegistrar = &registration.HostRegistrar{K8sClient: k8sClient}
-	err = registration.LocalHostRegistrar.Register(hostName, namespace, labels)
+	config, k8sClient, err := getClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptionKey, err := encryption.LoadOrGenerateKeyFile(registration.GetEncryptionKeyPath())
+	if err != nil {
+		return nil, nil, err
+	}
+	registration.LocalHostRegistrar = &registration.HostRegistrar{
+		K8sClient:     k8sClient,
+		EncryptionKey: encryptionKey,
+		HostIdentity:  hostidentity.Collect(os.ReadFile),
+	}
+	err = registration.LocalHostRegistrar.Register(hostName, cfg.namespace, labeler.desiredLabels())
 	if err != nil {
-		logger.Error(err, "error registering host %s registration in namespace %s", hostName, namespace)
-		return
+		return nil, nil, fmt.Errorf("error registering host %s in namespace %s: %v", hostName, cfg.namespace, err)
 	}
+	return config, k8sClient, nil
+}
 
-	// Start certificate rotation goroutine.
-	// This is behind a feature flag for now. Set 'CERTIFICATE_ROTATION=true' to enable it.
-	if os.Getenv("CERTIFICATE_ROTATION") == "true" {
-		go func() {
-			err = certificateRotation(logger, hostName, config)
-			if err != nil {
-				logger.Error(err, "certificate rotation failed")
-				return
-			}
-		}()
+// resolveHostName returns the name of this host, see registration.ResolveHostName
+func resolveHostName(cfg *agentConfig) (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("could not determine hostname: %v", err)
+	}
+	return registration.ResolveHostName(cfg.hostName, registration.NewHostNameData(hostname, hostidentity.Collect(os.ReadFile)))
+}
+
+func runAgent(cfg *agentConfig) error {
+	hostName, err := resolveHostName(cfg)
+	if err != nil {
+		return err
+	}
+
+	labeler := newHostLabeler(cfg, hostName)
+	config, k8sClient, err := registerHost(cfg, labeler)
+	if err != nil {
+		return err
 	}
 
+	var certManager *registration.CertificateManager
+	if feature.Gates.Enabled(feature.CertificateRotation) {
+		certManager, err = registration.NewCertificateManager(logger, config, registration.GetBYOHConfigPath(), hostName, cfg.certExpiry())
+		if err != nil {
+			return fmt.Errorf("unable to set up certificate rotation: %v", err)
+		}
+		certManager.KeyAlgorithm = cfg.keyAlgorithm
+		certManager.HostIdentity = registration.LocalHostRegistrar.HostIdentity
+		// clients created from now on present the renewed certificates
+		if k8sClient, err = client.New(config, client.Options{Scheme: scheme}); err != nil {
+			return fmt.Errorf("k8s client creation failed: %v", err)
+		}
+		registration.LocalHostRegistrar.K8sClient = k8sClient
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	go watchConfigReload(ctx, cfg, labeler, certManager)
+	go labeler.start(ctx, cfg.labelRefreshInterval)
+
 	mgr, err := ctrl.NewManager(config, ctrl.Options{
-		Scheme:    scheme,
-		Namespace: namespace,
+		Scheme: scheme,
 		// this enables filtered watch of ByoHost based on the host name
-		// only ByoHost running for this host will be cached
+		// only ByoHost running for this host will be cached, in all the
+		// namespaces so that the host can be moved to another namespace; the
+		// byohost-editor-role ClusterRole of the byoh:hosts group grants the
+		// cluster-wide list and watch of ByoHosts this needs, and nothing else is cached
 		NewCache: cache.BuilderWithOptions(cache.Options{
 			SelectorsByObject: cache.SelectorsByObject{
 				&infrastructurev1beta1.ByoHost{}: {
@@ -197,45 +267,62 @@ func main() {
 			},
 		},
 		),
-		MetricsBindAddress: metricsbindaddress,
+		MetricsBindAddress: cfg.metricsBindAddress,
 	})
 	if err != nil {
-		logger.Error(err, "unable to start manager")
-		return
+		return fmt.Errorf("unable to start manager: %v", err)
 	}
 
-	if skipInstallation {
+	if cfg.skipInstallation {
 		logger.Info("skip-installation flag set, skipping installer initialisation")
 	}
 	hostReconciler := &reconciler.HostReconciler{
 		Client:              k8sClient,
 		CmdRunner:           cloudinit.CmdRunner{},
 		FileWriter:          cloudinit.FileWriter{},
-		TemplateParser:      setupTemplateParser(),
+		TemplateParser:      registration.LocalHostRegistrar,
 		Recorder:            mgr.GetEventRecorderFor("hostagent-controller"),
-		SkipK8sInstallation: skipInstallation,
-		DownloadPath:        downloadpath,
+		SkipK8sInstallation: cfg.skipInstallation,
+		DownloadPath:        cfg.downloadPath,
+		DecryptionKey:       registration.LocalHostRegistrar.EncryptionKey,
+		NamespaceMover:      registration.LocalHostRegistrar,
+	}
+	if err = hostReconciler.SetupWithManager(ctx, mgr); err != nil {
+		return fmt.Errorf("unable to create controller: %v", err)
 	}
-	if err = hostReconciler.SetupWithManager(context.TODO(), mgr); err != nil {
-		logger.Error(err, "unable to create controller")
-		return
+	networkWatcher := &registration.NetworkWatcher{
+		Registrar:    registration.LocalHostRegistrar,
+		HostName:     hostName,
+		Recorder:     mgr.GetEventRecorderFor("hostagent-controller"),
+		ResyncPeriod: registration.DefaultNetworkResyncPeriod,
 	}
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-		logger.Error(err, "problem running manager")
-		return
+	if err = mgr.Add(networkWatcher); err != nil {
+		return fmt.Errorf("unable to add network watcher: %v", err)
 	}
+	if certManager != nil {
+		if err = mgr.Add(certManager); err != nil {
+			return fmt.Errorf("unable to add certificate manager: %v", err)
+		}
+	}
+	if err := mgr.Start(ctx); err != nil {
+		return fmt.Errorf("problem running manager: %v", err)
+	}
+	return nil
 }
 
-func handleBootstrapFlow(logger logr.Logger, hostName string) error {
+func handleBootstrapFlow(logger logr.Logger, cfg *agentConfig, hostName string) error {
 	logger.Info("initiated bootstrap kubeconfig flow")
-	bootstrapClientConfig, err := registration.LoadRESTClientConfig(bootstrapKubeConfig)
+	bootstrapClientConfig, err := registration.LoadRESTClientConfig(cfg.bootstrapKubeConfig)
 	if err != nil {
 		return fmt.Errorf("client config load failed: %v", err)
 	}
-	byohCSR, err := registration.NewByohCSR(bootstrapClientConfig, logger, certExpiryDuration)
+	byohCSR, err := registration.NewByohCSR(bootstrapClientConfig, logger, cfg.certExpiry())
 	if err != nil {
 		return fmt.Errorf("ByohCSR intialization failed: %v", err)
 	}
+	byohCSR.Namespace = cfg.namespace
+	byohCSR.KeyAlgorithm = cfg.keyAlgorithm
+	byohCSR.HostIdentity = hostidentity.Collect(os.ReadFile)
 	err = byohCSR.BootstrapKubeconfig(hostName)
 	if err != nil {
 		return fmt.Errorf("kubeconfig generation failed: %v", err)
@@ -243,60 +330,15 @@ func handleBootstrapFlow(logger logr.Logger, hostName string) error {
 	return nil
 }
 
-func certificateRotation(logger logr.Logger, hostName string, config *rest.Config) error {
-	var pollDuration = 5 * time.Second
-	for {
-		if err := certRotation(logger, hostName, config); err != nil {
-			return err
-		}
-		// Poll after every few seconds
-		time.Sleep(pollDuration)
-	}
-}
-
-func certRotation(logger logr.Logger, hostName string, config *rest.Config) error {
-	block, _ := pem.Decode(config.CertData)
-	if block == nil || block.Type != "CERTIFICATE" {
-		logger.Info("failed to decode PEM block containing certificate")
-		return nil
-	}
-
-	cert, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		logger.Error(err, "Certificate parse failed")
-		return err
-	}
-
-	totalTimeCert := cert.NotAfter.Sub(cert.NotBefore)
-
-	// if less than 20% time left, renew the certs.
-	// https://github.com/kubernetes-sigs/cluster-api/blob/main/docs/proposals/20210222-kubelet-authentication.md#kubelet-authenticator-flow
-	if time.Now().After(cert.NotAfter.Add(totalTimeCert / -5)) {
-		logger.Info("certificate expiration time left is less than 20%, renewing")
-		if err = handleBootstrapFlow(logger, hostName); err != nil {
-			logger.Error(err, "bootstrap flow failed")
-		}
-	} else {
-		logger.Info("certificate are valid", "will be renewed after", cert.NotAfter.Add(totalTimeCert/-5))
-	}
-	return nil
-}
-
-func getConfig(logger logr.Logger) *rest.Config {
+// getClient loads the host kubeconfig from ~/.byoh/config and returns a client for the management cluster
+func getClient() (*rest.Config, client.Client, error) {
 	config, err := registration.LoadRESTClientConfig(registration.GetBYOHConfigPath())
 	if err != nil {
-		logger.Error(err, "client config load failed")
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("client config load failed: %v", err)
 	}
-	return config
-}
-
-func getClient(logger logr.Logger, config *rest.Config) client.Client {
 	k8sClient, err := client.New(config, client.Options{Scheme: scheme})
 	if err != nil {
-		logger.Error(err, "k8s client creation failed")
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("k8s client creation failed: %v", err)
 	}
-
-	return k8sClient
+	return config, k8sClient, nil
 }
@@ -0,0 +1,129 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
+	"k8s.io/client-go/discovery"
+)
+
+// preflightCheck is a single check run by the preflight subcommand
+type preflightCheck struct {
+	name  string
+	check func(cfg *agentConfig) error
+}
+
+var preflightChecks = []preflightCheck{
+	{name: "Hostname", check: checkHostname},
+	{name: "RootUser", check: checkRootUser},
+	{name: "Swap", check: checkSwap},
+	{name: "Kubeconfig", check: checkKubeconfig},
+	{name: "ManagementCluster", check: checkManagementCluster},
+	{name: "K8sComponents", check: checkK8sComponents},
+}
+
+// runPreflightChecks runs all the checks and reports the result of each of them,
+// an error is returned if any of the checks failed
+func runPreflightChecks(out io.Writer, cfg *agentConfig) error {
+	failed := 0
+	for _, c := range preflightChecks {
+		if err := c.check(cfg); err != nil {
+			failed++
+			fmt.Fprintf(out, "[FAIL] %s: %v\n", c.name, err)
+			continue
+		}
+		fmt.Fprintf(out, "[PASS] %s\n", c.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d preflight checks failed", failed, len(preflightChecks))
+	}
+	return nil
+}
+
+func checkHostname(cfg *agentConfig) error {
+	_, err := resolveHostName(cfg)
+	return err
+}
+
+func checkRootUser(_ *agentConfig) error {
+	if os.Geteuid() != 0 {
+		return errors.New("kubeadm requires the agent to run as root")
+	}
+	return nil
+}
+
+func checkSwap(_ *agentConfig) error {
+	f, err := os.Open("/proc/swaps")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	// the first line of /proc/swaps is a header
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+	}
+	if lines > 1 {
+		return errors.New("swap is enabled, kubelet requires swap to be disabled")
+	}
+	return scanner.Err()
+}
+
+func checkKubeconfig(cfg *agentConfig) error {
+	if _, err := os.Stat(registration.GetBYOHConfigPath()); err == nil {
+		return nil
+	}
+	if cfg.bootstrapKubeConfig == "" {
+		return fmt.Errorf("%s does not exist and --bootstrap-kubeconfig is not set", registration.GetBYOHConfigPath())
+	}
+	_, err := registration.LoadRESTClientConfig(cfg.bootstrapKubeConfig)
+	return err
+}
+
+func checkManagementCluster(cfg *agentConfig) error {
+	kubeconfigPath := registration.GetBYOHConfigPath()
+	if _, err := os.Stat(kubeconfigPath); err != nil {
+		kubeconfigPath = cfg.bootstrapKubeConfig
+	}
+	if kubeconfigPath == "" {
+		return errors.New("no kubeconfig available")
+	}
+	config, err := registration.LoadRESTClientConfig(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	if _, err = discoveryClient.ServerVersion(); err != nil {
+		return fmt.Errorf("%s is not reachable: %v", config.Host, err)
+	}
+	return nil
+}
+
+func checkK8sComponents(cfg *agentConfig) error {
+	if !cfg.skipInstallation {
+		// the installer downloads the components into the download path
+		return os.MkdirAll(cfg.downloadPath, 0750) //nolint: gomnd
+	}
+	for _, binary := range []string{"kubeadm", "kubelet"} {
+		if _, err := exec.LookPath(binary); err != nil {
+			return fmt.Errorf("--skip-installation is set but %s is not installed", binary)
+		}
+	}
+	return nil
+}
@@ -5,7 +5,9 @@ package reconciler
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
+	"net"
 	"os"
 
 	"github.com/pkg/errors"
@@ -25,6 +27,7 @@ import (
 
 	"github.com/kube-vip/kube-vip/pkg/vip"
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/encryption"
 )
 
 // HostReconciler encapsulates the data/logic needed to reconcile a ByoHost
@@ -36,18 +39,45 @@ type HostReconciler struct {
 	Recorder            record.EventRecorder
 	SkipK8sInstallation bool
 	DownloadPath        string
+	// DecryptionKey decrypts the bootstrap data encrypted to the public key of the host
+	DecryptionKey *rsa.PrivateKey
+	// NamespaceMover moves the host to the namespace an operator sets in the MoveToNamespaceAnnotation,
+	// the ByoHosts of the host in other namespaces than the one it is registered in are ignored
+	NamespaceMover NamespaceMover
+	// MaxBootstrapAttempts is the number of consecutive failures after which the agent gives up bootstrapping
+	// the k8s node, DefaultMaxBootstrapAttempts if zero
+	MaxBootstrapAttempts int32
+}
+
+// NamespaceMover moves the registration of the host to another namespace
+type NamespaceMover interface {
+	// Namespace returns the namespace the host is registered in
+	Namespace() string
+	// MoveToNamespace registers the host in namespace and deletes byoHost
+	MoveToNamespace(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost, namespace string) error
 }
 
 const (
 	bootstrapSentinelFile = "/run/cluster-api/bootstrap-success.complete"
 	// KubeadmResetCommand is the command to run to force reset/remove nodes' local file system of the files created by kubeadm
 	KubeadmResetCommand = "kubeadm reset --force"
+	// DefaultMaxBootstrapAttempts is the default number of consecutive failures after which the agent gives up
+	// bootstrapping the k8s node
+	DefaultMaxBootstrapAttempts = 5
 )
 
+// errInstallScriptFailed is returned when the install script of the k8s components failed, such failures
+// count towards MaxBootstrapAttempts like the failures of the bootstrap itself
+var errInstallScriptFailed = errors.New("install script execution failed")
+
 // Reconcile handles events for the ByoHost that is registered by this agent process
 func (r *HostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
 	logger := ctrl.LoggerFrom(ctx)
 	logger.Info("Reconcile request received")
+	if r.NamespaceMover != nil && req.Namespace != r.NamespaceMover.Namespace() {
+		logger.Info("ByoHost is not in the namespace the host is registered in, ignoring it")
+		return ctrl.Result{}, nil
+	}
 
 	// Fetch the ByoHost instance
 	byoHost := &infrastructurev1beta1.ByoHost{}
@@ -56,6 +86,9 @@ func (r *HostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctr
 		logger.Error(err, "error getting ByoHost")
 		return ctrl.Result{}, err
 	}
+	if namespace, ok := byoHost.Annotations[infrastructurev1beta1.MoveToNamespaceAnnotation]; ok && r.NamespaceMover != nil {
+		return ctrl.Result{}, r.moveToNamespace(ctx, byoHost, namespace)
+	}
 	helper, _ := patch.NewHelper(byoHost, r.Client)
 	defer func() {
 		err = helper.Patch(ctx, byoHost)
@@ -83,10 +116,44 @@ func (r *HostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctr
 	return r.reconcileNormal(ctx, byoHost)
 }
 
+// moveToNamespace moves the idle host to namespace. The move of a host attached in the meantime
+// or claimed as a load balancer host in the meantime is cancelled by removing the MoveToNamespaceAnnotation.
+func (r *HostReconciler) moveToNamespace(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost, namespace string) error {
+	logger := ctrl.LoggerFrom(ctx)
+	loadBalancer := byoHost.Labels[infrastructurev1beta1.LoadBalancerHostLabel]
+	if byoHost.Status.MachineRef != nil || loadBalancer != "" {
+		logger.Info("ByoHost is in use, cancelling its move", "namespace", namespace)
+		if byoHost.Status.MachineRef != nil {
+			r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "MoveToNamespaceCancelled", "ByoHost is attached to %s %s/%s, not moving it to namespace %s",
+				byoHost.Status.MachineRef.Kind, byoHost.Status.MachineRef.Namespace, byoHost.Status.MachineRef.Name, namespace)
+		} else {
+			r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "MoveToNamespaceCancelled", "ByoHost serves the load balancer of ByoCluster %s, not moving it to namespace %s",
+				loadBalancer, namespace)
+		}
+		helper, err := patch.NewHelper(byoHost, r.Client)
+		if err != nil {
+			return err
+		}
+		delete(byoHost.Annotations, infrastructurev1beta1.MoveToNamespaceAnnotation)
+		return helper.Patch(ctx, byoHost)
+	}
+
+	logger.Info("Moving ByoHost", "namespace", namespace)
+	if err := r.NamespaceMover.MoveToNamespace(ctx, byoHost, namespace); err != nil {
+		r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "MoveToNamespaceFailed", "moving the host to namespace %s failed: %v", namespace, err)
+		return err
+	}
+	r.Recorder.Eventf(byoHost, corev1.EventTypeNormal, "MovedToNamespace", "host moved to namespace %s", namespace)
+	return nil
+}
+
 func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) (ctrl.Result, error) {
 	logger := ctrl.LoggerFrom(ctx)
 	logger = logger.WithValues("ByoHost", byoHost.Name)
 	logger.Info("reconcile normal")
+	if byoHost.Spec.LoadBalancerSecret != nil || conditions.Has(byoHost, infrastructurev1beta1.LoadBalancerConfigured) {
+		return r.reconcileLoadBalancer(ctx, byoHost)
+	}
 	if byoHost.Status.MachineRef == nil {
 		logger.Info("Machine ref not yet set")
 		conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.WaitingForMachineRefReason, clusterv1.ConditionSeverityInfo, "")
@@ -99,7 +166,15 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 		return ctrl.Result{}, nil
 	}
 
+	if err := r.addSecondaryIPAddresses(ctx, byoHost); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if !conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded) {
+		if conditions.GetReason(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded) == infrastructurev1beta1.K8sNodeBootstrapRetriesExhaustedReason {
+			logger.Info("gave up bootstrapping the k8s node", "failures", byoHost.Status.BootstrapFailures)
+			return ctrl.Result{}, nil
+		}
 		bootstrapScript, err := r.getBootstrapScript(ctx, byoHost.Spec.BootstrapSecret.Name, byoHost.Spec.BootstrapSecret.Namespace)
 		if err != nil {
 			logger.Error(err, "error getting bootstrap script")
@@ -116,6 +191,10 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 				return ctrl.Result{}, nil
 			}
 			err = r.executeInstallerController(ctx, byoHost)
+			if errors.Is(err, errInstallScriptFailed) {
+				conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.K8sComponentsInstallationFailedReason, clusterv1.ConditionSeverityError, "")
+				return r.bootstrapFailed(byoHost, err)
+			}
 			if err != nil {
 				return ctrl.Result{}, err
 			}
@@ -130,7 +209,7 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 			logger.Error(err, "error cleaning up k8s directories, please delete it manually for reconcile to proceed.")
 			r.Recorder.Event(byoHost, corev1.EventTypeWarning, "CleanK8sDirectoriesFailed", "clean k8s directories failed")
 			conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.CleanK8sDirectoriesFailedReason, clusterv1.ConditionSeverityError, "")
-			return ctrl.Result{}, err
+			return r.bootstrapFailed(byoHost, err)
 		}
 
 		err = r.bootstrapK8sNode(ctx, bootstrapScript, byoHost)
@@ -139,16 +218,36 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 			r.Recorder.Event(byoHost, corev1.EventTypeWarning, "BootstrapK8sNodeFailed", "k8s Node Bootstrap failed")
 			_ = r.resetNode(ctx, byoHost)
 			conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.CloudInitExecutionFailedReason, clusterv1.ConditionSeverityError, "")
-			return ctrl.Result{}, err
+			return r.bootstrapFailed(byoHost, err)
 		}
 		logger.Info("k8s node successfully bootstrapped")
 		r.Recorder.Event(byoHost, corev1.EventTypeNormal, "BootstrapK8sNodeSucceeded", "k8s Node Bootstraped")
 		conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+		byoHost.Status.BootstrapFailures = 0
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// bootstrapFailed counts a failed attempt to install the k8s components or bootstrap the k8s node, the error is returned so that the
+// bootstrap is retried until the agent failed MaxBootstrapAttempts times in a row. The agent then gives
+// up with the K8sNodeBootstrapRetriesExhaustedReason until the host is detached.
+func (r *HostReconciler) bootstrapFailed(byoHost *infrastructurev1beta1.ByoHost, err error) (ctrl.Result, error) {
+	byoHost.Status.BootstrapFailures++
+	maxAttempts := r.MaxBootstrapAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxBootstrapAttempts
+	}
+	if byoHost.Status.BootstrapFailures < maxAttempts {
+		return ctrl.Result{}, err
+	}
+	reason := conditions.GetReason(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+	r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "BootstrapK8sNodeRetriesExhausted", "k8s Node Bootstrap failed %d times, giving up", byoHost.Status.BootstrapFailures)
+	conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.K8sNodeBootstrapRetriesExhaustedReason, clusterv1.ConditionSeverityError,
+		"%s %d times in a row, last error: %v", reason, byoHost.Status.BootstrapFailures, err)
+	return ctrl.Result{}, nil
+}
+
 func (r *HostReconciler) executeInstallerController(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
 	logger := ctrl.LoggerFrom(ctx)
 	secret := &corev1.Secret{}
@@ -172,7 +271,7 @@ func (r *HostReconciler) executeInstallerController(ctx context.Context, byoHost
 		logger.Error(err, "error executing installation script")
 		r.Recorder.Event(byoHost, corev1.EventTypeWarning, "InstallScriptExecutionFailed", "install script execution failed")
 		conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded, infrastructurev1beta1.K8sComponentsInstallationFailedReason, clusterv1.ConditionSeverityInfo, "")
-		return err
+		return fmt.Errorf("%w: %v", errInstallScriptFailed, err)
 	}
 	return nil
 }
@@ -188,8 +287,19 @@ func (r *HostReconciler) getBootstrapScript(ctx context.Context, dataSecretName,
 		return "", err
 	}
 
-	bootstrapSecret := string(secret.Data["value"])
-	return bootstrapSecret, nil
+	encrypted, ok := secret.Data[infrastructurev1beta1.EncryptedBootstrapDataKey]
+	if !ok {
+		bootstrapSecret := string(secret.Data["value"])
+		return bootstrapSecret, nil
+	}
+	if r.DecryptionKey == nil {
+		return "", fmt.Errorf("bootstrap secret %s is encrypted, but the host has no encryption key", dataSecretName)
+	}
+	bootstrapSecret, err := encryption.Decrypt(r.DecryptionKey, encrypted)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt bootstrap secret %s: %v", dataSecretName, err)
+	}
+	return string(bootstrapSecret), nil
 }
 
 func (r *HostReconciler) parseScript(ctx context.Context, script string) (string, error) {
@@ -287,8 +397,14 @@ func (r *HostReconciler) hostCleanUp(ctx context.Context, byoHost *infrastructur
 		return err
 	}
 
+	err = r.deleteSecondaryIPAddresses(ctx, byoHost)
+	if err != nil {
+		return err
+	}
+
 	byoHost.Spec.InstallationSecret = nil
 	byoHost.Spec.UninstallationScript = nil
+	byoHost.Status.BootstrapFailures = 0
 	r.removeAnnotations(ctx, byoHost)
 	conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.K8sNodeAbsentReason, clusterv1.ConditionSeverityInfo, "")
 	return nil
@@ -333,7 +449,7 @@ func (r *HostReconciler) deleteEndpointIP(ctx context.Context, byoHost *infrastr
 	logger := ctrl.LoggerFrom(ctx)
 	logger.Info("Removing network endpoints")
 	if IP, ok := byoHost.Annotations[infrastructurev1beta1.EndPointIPAnnotation]; ok {
-		network, err := vip.NewConfig(IP, registration.LocalHostRegistrar.ByoHostInfo.DefaultNetworkInterfaceName, "", false, 0)
+		network, err := vip.NewConfig(IP, registration.LocalHostRegistrar.DefaultNetworkInterface(), "", false, 0)
 		if err == nil {
 			err := network.DeleteIP()
 			if err != nil {
@@ -344,6 +460,87 @@ func (r *HostReconciler) deleteEndpointIP(ctx context.Context, byoHost *infrastr
 	return nil
 }
 
+// addSecondaryIPAddresses configures the secondary IP addresses of the host that are missing from its network status
+func (r *HostReconciler) addSecondaryIPAddresses(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	logger := ctrl.LoggerFrom(ctx)
+	for _, address := range byoHost.Spec.SecondaryIPAddresses {
+		networkInterface := secondaryIPAddressInterface(byoHost, address)
+		if hasIPAddress(byoHost, networkInterface, address.Address) {
+			continue
+		}
+		logger.Info("Adding secondary IP address", "address", address.Address, "interface", networkInterface)
+		network, err := secondaryIPAddressConfig(networkInterface, address.Address)
+		if err == nil {
+			err = network.AddIP()
+		}
+		if err != nil {
+			r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "AddIPAddressFailed", "adding IP address %s to interface %s failed: %v", address.Address, networkInterface, err)
+			return err
+		}
+		r.Recorder.Eventf(byoHost, corev1.EventTypeNormal, "IPAddressAdded", "IP address %s added to interface %s", address.Address, networkInterface)
+	}
+	return nil
+}
+
+// deleteSecondaryIPAddresses removes the secondary IP addresses of the host once it is released
+func (r *HostReconciler) deleteSecondaryIPAddresses(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	logger := ctrl.LoggerFrom(ctx)
+	for _, address := range byoHost.Spec.SecondaryIPAddresses {
+		logger.Info("Removing secondary IP address", "address", address.Address)
+		network, err := secondaryIPAddressConfig(secondaryIPAddressInterface(byoHost, address), address.Address)
+		if err == nil {
+			if err := network.DeleteIP(); err != nil {
+				return err
+			}
+		}
+	}
+	byoHost.Spec.SecondaryIPAddresses = nil
+	return nil
+}
+
+// secondaryIPAddressInterface returns the network interface of the secondary IP address, the default
+// network interface reported in the network status of the host if the address does not set it
+func secondaryIPAddressInterface(byoHost *infrastructurev1beta1.ByoHost, address infrastructurev1beta1.HostIPAddress) string {
+	if address.Interface != "" {
+		return address.Interface
+	}
+	for _, network := range byoHost.Status.Network {
+		if network.IsDefault {
+			return network.NetworkInterfaceName
+		}
+	}
+	return ""
+}
+
+// secondaryIPAddressConfig returns the network configuration of the address with its prefix length on the interface
+func secondaryIPAddressConfig(networkInterface, address string) (vip.Network, error) {
+	ip, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return nil, err
+	}
+	prefix, _ := ipNet.Mask.Size()
+	return vip.NewConfig(ip.String(), networkInterface, fmt.Sprintf("/%d", prefix), false, 0)
+}
+
+// hasIPAddress returns whether the network status of the host reports the address on the interface
+func hasIPAddress(byoHost *infrastructurev1beta1.ByoHost, networkInterface, address string) bool {
+	ip, _, err := net.ParseCIDR(address)
+	if err != nil {
+		return false
+	}
+	for _, network := range byoHost.Status.Network {
+		if network.NetworkInterfaceName != networkInterface {
+			continue
+		}
+		for _, addr := range network.IPAddrs {
+			if other, _, err := net.ParseCIDR(addr); err == nil && other.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (r *HostReconciler) removeAnnotations(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) {
 	logger := ctrl.LoggerFrom(ctx)
 	logger.Info("Removing annotations")
@@ -0,0 +1,76 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package reconciler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/cloudinit"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// HAProxyReloadCommand is the command to run to apply the HAProxy configuration of a load balancer host
+	HAProxyReloadCommand = "systemctl reload-or-restart haproxy"
+	// HAProxyStopCommand is the command to run once the host does not serve a load balancer anymore
+	HAProxyStopCommand = "systemctl stop haproxy"
+)
+
+// HAProxyConfigPath is the path of the HAProxy configuration of a load balancer host
+var HAProxyConfigPath = "/etc/haproxy/haproxy.cfg"
+
+// reconcileLoadBalancer configures HAProxy with the configuration of the load balancer secret of the host,
+// and stops HAProxy once the secret is cleared. HAProxy is only reloaded when its configuration changes.
+func (r *HostReconciler) reconcileLoadBalancer(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) (ctrl.Result, error) {
+	logger := ctrl.LoggerFrom(ctx)
+
+	if byoHost.Spec.LoadBalancerSecret == nil {
+		logger.Info("Stopping the load balancer")
+		if err := r.CmdRunner.RunCmd(ctx, HAProxyStopCommand); err != nil {
+			r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "StopLoadBalancerFailed", "stopping HAProxy failed: %v", err)
+			return ctrl.Result{}, err
+		}
+		conditions.Delete(byoHost, infrastructurev1beta1.LoadBalancerConfigured)
+		r.Recorder.Event(byoHost, corev1.EventTypeNormal, "LoadBalancerStopped", "HAProxy stopped")
+		return ctrl.Result{}, nil
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: byoHost.Spec.LoadBalancerSecret.Name, Namespace: byoHost.Spec.LoadBalancerSecret.Namespace}, secret)
+	if err != nil {
+		logger.Error(err, "error getting the load balancer secret")
+		r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "ReadLoadBalancerSecretFailed", "load balancer secret %s not found", byoHost.Spec.LoadBalancerSecret.Name)
+		return ctrl.Result{}, err
+	}
+	config := secret.Data[infrastructurev1beta1.HAProxyConfigKey]
+	if current, err := os.ReadFile(HAProxyConfigPath); err == nil && string(current) == string(config) &&
+		conditions.IsTrue(byoHost, infrastructurev1beta1.LoadBalancerConfigured) {
+		return ctrl.Result{}, nil
+	}
+
+	logger.Info("Configuring the load balancer", "secret", byoHost.Spec.LoadBalancerSecret.Name)
+	err = r.FileWriter.MkdirIfNotExists(filepath.Dir(HAProxyConfigPath))
+	if err == nil {
+		err = r.FileWriter.WriteToFile(&cloudinit.Files{Path: HAProxyConfigPath, Permissions: "0644", Content: string(config)})
+	}
+	if err == nil {
+		err = r.CmdRunner.RunCmd(ctx, HAProxyReloadCommand)
+	}
+	if err != nil {
+		logger.Error(err, "error configuring the load balancer")
+		r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "ConfigureLoadBalancerFailed", "configuring HAProxy failed: %v", err)
+		conditions.MarkFalse(byoHost, infrastructurev1beta1.LoadBalancerConfigured, infrastructurev1beta1.LoadBalancerConfigurationFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Event(byoHost, corev1.EventTypeNormal, "LoadBalancerConfigured", "HAProxy configured")
+	conditions.MarkTrue(byoHost, infrastructurev1beta1.LoadBalancerConfigured)
+	return ctrl.Result{}, nil
+}
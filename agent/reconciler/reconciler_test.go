@@ -5,14 +5,18 @@ package reconciler_test
 
 import (
 	"context"
+	"crypto/rsa"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/cloudinit/cloudinitfakes"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/reconciler"
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/encryption"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/builder"
 	eventutils "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/utils/events"
 	corev1 "k8s.io/api/core/v1"
@@ -95,6 +99,122 @@ var _ = Describe("Byohost Agent Tests", func() {
 			}))
 		})
 
+		Context("When an operator moves the host to another namespace", func() {
+			var mover *fakeNamespaceMover
+
+			BeforeEach(func() {
+				mover = &fakeNamespaceMover{namespace: ns}
+				hostReconciler.NamespaceMover = mover
+				byoHost.Annotations = map[string]string{infrastructurev1beta1.MoveToNamespaceAnnotation: "tenant-a"}
+				Expect(patchHelper.Patch(ctx, byoHost)).NotTo(HaveOccurred())
+			})
+
+			It("should move the idle host", func() {
+				_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+				Expect(reconcilerErr).ToNot(HaveOccurred())
+
+				Expect(mover.movedTo).To(Equal("tenant-a"))
+				Expect(eventutils.CollectEvents(recorder.Events)).To(ConsistOf("Normal MovedToNamespace host moved to namespace tenant-a"))
+			})
+
+			It("should cancel the move of an attached host", func() {
+				byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: ns, Name: "test-byomachine"}
+				Expect(patchHelper.Patch(ctx, byoHost)).NotTo(HaveOccurred())
+
+				_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+				Expect(reconcilerErr).ToNot(HaveOccurred())
+
+				Expect(mover.movedTo).To(BeEmpty())
+				updatedByoHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+				Expect(updatedByoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.MoveToNamespaceAnnotation))
+				Expect(eventutils.CollectEvents(recorder.Events)).To(ConsistOf(
+					"Warning MoveToNamespaceCancelled ByoHost is attached to ByoMachine default/test-byomachine, not moving it to namespace tenant-a"))
+			})
+
+			It("should cancel the move of a load balancer host", func() {
+				byoHost.Labels = map[string]string{infrastructurev1beta1.LoadBalancerHostLabel: "default.test-cluster"}
+				Expect(patchHelper.Patch(ctx, byoHost)).NotTo(HaveOccurred())
+
+				_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+				Expect(reconcilerErr).ToNot(HaveOccurred())
+
+				Expect(mover.movedTo).To(BeEmpty())
+				Expect(eventutils.CollectEvents(recorder.Events)).To(ConsistOf(
+					"Warning MoveToNamespaceCancelled ByoHost serves the load balancer of ByoCluster default.test-cluster, not moving it to namespace tenant-a"))
+			})
+
+			It("should ignore the ByoHosts of the other namespaces", func() {
+				mover.namespace = "tenant-a"
+
+				_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+				Expect(reconcilerErr).ToNot(HaveOccurred())
+				Expect(mover.movedTo).To(BeEmpty())
+			})
+		})
+
+		Context("When the host serves a load balancer", func() {
+			var loadBalancerSecret *corev1.Secret
+
+			BeforeEach(func() {
+				reconciler.HAProxyConfigPath = filepath.Join(GinkgoT().TempDir(), "haproxy.cfg")
+				loadBalancerSecret = builder.Secret(ns, "test-cluster-haproxy").
+					WithKeyData(infrastructurev1beta1.HAProxyConfigKey, "frontend control-plane").
+					Build()
+				Expect(k8sClient.Create(ctx, loadBalancerSecret)).NotTo(HaveOccurred())
+
+				byoHost.Spec.LoadBalancerSecret = &corev1.ObjectReference{Kind: "Secret", Namespace: ns, Name: loadBalancerSecret.Name}
+				Expect(patchHelper.Patch(ctx, byoHost)).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				Expect(k8sClient.Delete(ctx, loadBalancerSecret)).NotTo(HaveOccurred())
+			})
+
+			It("should write the HAProxy configuration and reload HAProxy", func() {
+				_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+				Expect(reconcilerErr).ToNot(HaveOccurred())
+
+				Expect(fakeFileWriter.WriteToFileCallCount()).To(Equal(1))
+				Expect(fakeFileWriter.WriteToFileArgsForCall(0).Path).To(Equal(reconciler.HAProxyConfigPath))
+				Expect(fakeFileWriter.WriteToFileArgsForCall(0).Content).To(Equal("frontend control-plane"))
+				Expect(fakeCommandRunner.RunCmdCallCount()).To(Equal(1))
+				_, cmd := fakeCommandRunner.RunCmdArgsForCall(0)
+				Expect(cmd).To(Equal(reconciler.HAProxyReloadCommand))
+
+				updatedByoHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+				Expect(conditions.IsTrue(updatedByoHost, infrastructurev1beta1.LoadBalancerConfigured)).To(BeTrue())
+				Expect(eventutils.CollectEvents(recorder.Events)).To(ConsistOf("Normal LoadBalancerConfigured HAProxy configured"))
+			})
+
+			It("should not reload HAProxy when its configuration is unchanged", func() {
+				Expect(os.WriteFile(reconciler.HAProxyConfigPath, []byte("frontend control-plane"), 0644)).To(Succeed())
+				conditions.MarkTrue(byoHost, infrastructurev1beta1.LoadBalancerConfigured)
+				Expect(patchHelper.Patch(ctx, byoHost)).NotTo(HaveOccurred())
+
+				_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+				Expect(reconcilerErr).ToNot(HaveOccurred())
+				Expect(fakeFileWriter.WriteToFileCallCount()).To(Equal(0))
+				Expect(fakeCommandRunner.RunCmdCallCount()).To(Equal(0))
+			})
+
+			It("should stop HAProxy once the load balancer secret is cleared", func() {
+				conditions.MarkTrue(byoHost, infrastructurev1beta1.LoadBalancerConfigured)
+				byoHost.Spec.LoadBalancerSecret = nil
+				Expect(patchHelper.Patch(ctx, byoHost)).NotTo(HaveOccurred())
+
+				_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+				Expect(reconcilerErr).ToNot(HaveOccurred())
+
+				_, cmd := fakeCommandRunner.RunCmdArgsForCall(0)
+				Expect(cmd).To(Equal(reconciler.HAProxyStopCommand))
+				updatedByoHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+				Expect(conditions.Has(updatedByoHost, infrastructurev1beta1.LoadBalancerConfigured)).To(BeFalse())
+			})
+		})
+
 		Context("When MachineRef is set", func() {
 			BeforeEach(func() {
 				byoMachine = builder.ByoMachine(ns, "test-byomachine").Build()
@@ -202,6 +322,93 @@ runCmd:
 					))
 				})
 
+				It("should skip the secondary IP addresses already configured on the host", func() {
+					hostReconciler.SkipK8sInstallation = true
+					byoHost.Spec.SecondaryIPAddresses = []infrastructurev1beta1.HostIPAddress{{Address: "10.10.10.10/24"}}
+					byoHost.Status.Network = []infrastructurev1beta1.NetworkStatus{{
+						NetworkInterfaceName: "byoh-test0",
+						MACAddr:              "00:50:56:a1:b2:c3",
+						IPAddrs:              []string{"10.10.10.10/24"},
+						IsDefault:            true,
+					}}
+					Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+					_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+					Expect(reconcilerErr).ToNot(HaveOccurred())
+					Expect(eventutils.CollectEvents(recorder.Events)).NotTo(ContainElement(HavePrefix("Normal IPAddressAdded")))
+				})
+
+				It("should return an error if a secondary IP address cannot be added", func() {
+					byoHost.Spec.SecondaryIPAddresses = []infrastructurev1beta1.HostIPAddress{{Address: "10.10.10.10/24", Interface: "byoh-missing0"}}
+					Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+					_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+					Expect(reconcilerErr).To(HaveOccurred())
+					Expect(fakeCommandRunner.RunCmdCallCount()).To(Equal(0))
+					Expect(eventutils.CollectEvents(recorder.Events)).To(ContainElement(
+						HavePrefix("Warning AddIPAddressFailed adding IP address 10.10.10.10/24 to interface byoh-missing0 failed")))
+				})
+
+				Context("When the bootstrap secret is encrypted", func() {
+					var (
+						encryptionKey   *rsa.PrivateKey
+						encryptedSecret *corev1.Secret
+					)
+
+					BeforeEach(func() {
+						var err error
+						encryptionKey, err = encryption.GenerateKey()
+						Expect(err).NotTo(HaveOccurred())
+						publicKey, err := encryption.EncodePublicKey(encryptionKey)
+						Expect(err).NotTo(HaveOccurred())
+						encrypted, err := encryption.Encrypt(publicKey, bootstrapSecret.Data["value"])
+						Expect(err).NotTo(HaveOccurred())
+
+						encryptedSecret = builder.Secret(ns, "test-encrypted-secret").
+							WithKeyData(infrastructurev1beta1.EncryptedBootstrapDataKey, string(encrypted)).
+							Build()
+						Expect(k8sClient.Create(ctx, encryptedSecret)).NotTo(HaveOccurred())
+
+						byoHost.Spec.BootstrapSecret.Name = encryptedSecret.Name
+						Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+						hostReconciler.SkipK8sInstallation = true
+					})
+
+					AfterEach(func() {
+						Expect(k8sClient.Delete(ctx, encryptedSecret)).NotTo(HaveOccurred())
+					})
+
+					It("should decrypt the bootstrap data with the key of the host", func() {
+						hostReconciler.DecryptionKey = encryptionKey
+						_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
+							NamespacedName: byoHostLookupKey,
+						})
+						Expect(reconcilerErr).ToNot(HaveOccurred())
+
+						Expect(fakeFileWriter.WriteToFileCallCount()).To(Equal(1))
+						Expect(fakeFileWriter.WriteToFileArgsForCall(0).Path).To(Equal("fake/path"))
+					})
+
+					It("should return an error if the host has no key", func() {
+						_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
+							NamespacedName: byoHostLookupKey,
+						})
+						Expect(reconcilerErr).To(MatchError("bootstrap secret test-encrypted-secret is encrypted, but the host has no encryption key"))
+						Expect(fakeFileWriter.WriteToFileCallCount()).To(Equal(0))
+					})
+
+					It("should return an error if the bootstrap data was encrypted to another key", func() {
+						otherKey, err := encryption.GenerateKey()
+						Expect(err).NotTo(HaveOccurred())
+						hostReconciler.DecryptionKey = otherKey
+						_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
+							NamespacedName: byoHostLookupKey,
+						})
+						Expect(reconcilerErr).To(HaveOccurred())
+						Expect(reconcilerErr.Error()).To(ContainSubstring("failed to decrypt bootstrap secret test-encrypted-secret"))
+					})
+				})
+
 				It("should set the Reason to InstallationSecretUnavailableReason", func() {
 					result, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
 						NamespacedName: byoHostLookupKey,
@@ -347,6 +554,79 @@ runCmd:
 						}))
 					})
 
+					It("should give up bootstrapping the node after MaxBootstrapAttempts failures in a row", func() {
+						hostReconciler.MaxBootstrapAttempts = 2
+						defer func() { hostReconciler.MaxBootstrapAttempts = 0 }()
+						conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)
+						Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+						fakeCommandRunner.RunCmdReturns(errors.New("I failed"))
+
+						_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+						Expect(reconcilerErr).To(HaveOccurred())
+						_, reconcilerErr = hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+						Expect(reconcilerErr).NotTo(HaveOccurred())
+
+						updatedByoHost := &infrastructurev1beta1.ByoHost{}
+						Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+						Expect(updatedByoHost.Status.BootstrapFailures).To(Equal(int32(2)))
+						Expect(*conditions.Get(updatedByoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(conditions.MatchCondition(clusterv1.Condition{
+							Type:     infrastructurev1beta1.K8sNodeBootstrapSucceeded,
+							Status:   corev1.ConditionFalse,
+							Reason:   infrastructurev1beta1.K8sNodeBootstrapRetriesExhaustedReason,
+							Severity: clusterv1.ConditionSeverityError,
+							Message:  "CloudInitExecutionFailed 2 times in a row, last error: I failed",
+						}))
+						Expect(eventutils.CollectEvents(recorder.Events)).To(ContainElement("Warning BootstrapK8sNodeRetriesExhausted k8s Node Bootstrap failed 2 times, giving up"))
+
+						// the agent does not retry anymore
+						runs := fakeCommandRunner.RunCmdCallCount()
+						_, reconcilerErr = hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+						Expect(reconcilerErr).NotTo(HaveOccurred())
+						Expect(fakeCommandRunner.RunCmdCallCount()).To(Equal(runs))
+					})
+
+					It("should give up installing the k8s components after MaxBootstrapAttempts failures in a row", func() {
+						hostReconciler.MaxBootstrapAttempts = 2
+						defer func() { hostReconciler.MaxBootstrapAttempts = 0 }()
+						fakeCommandRunner.RunCmdReturns(errors.New("I failed"))
+
+						_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+						Expect(reconcilerErr).To(HaveOccurred())
+						_, reconcilerErr = hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+						Expect(reconcilerErr).NotTo(HaveOccurred())
+
+						updatedByoHost := &infrastructurev1beta1.ByoHost{}
+						Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+						Expect(updatedByoHost.Status.BootstrapFailures).To(Equal(int32(2)))
+						Expect(conditions.GetReason(updatedByoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)).To(Equal(infrastructurev1beta1.K8sComponentsInstallationFailedReason))
+						Expect(*conditions.Get(updatedByoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(conditions.MatchCondition(clusterv1.Condition{
+							Type:     infrastructurev1beta1.K8sNodeBootstrapSucceeded,
+							Status:   corev1.ConditionFalse,
+							Reason:   infrastructurev1beta1.K8sNodeBootstrapRetriesExhaustedReason,
+							Severity: clusterv1.ConditionSeverityError,
+							Message:  "K8sComponentsInstallationFailed 2 times in a row, last error: install script execution failed: I failed",
+						}))
+
+						// the agent does not retry anymore
+						runs := fakeCommandRunner.RunCmdCallCount()
+						_, reconcilerErr = hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+						Expect(reconcilerErr).NotTo(HaveOccurred())
+						Expect(fakeCommandRunner.RunCmdCallCount()).To(Equal(runs))
+					})
+
+					It("should reset the failures once the node is bootstrapped", func() {
+						byoHost.Status.BootstrapFailures = 1
+						Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+						_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+						Expect(reconcilerErr).NotTo(HaveOccurred())
+
+						updatedByoHost := &infrastructurev1beta1.ByoHost{}
+						Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+						Expect(conditions.IsTrue(updatedByoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+						Expect(updatedByoHost.Status.BootstrapFailures).To(BeZero())
+					})
+
 					It("should return error if install script execution failed", func() {
 						fakeCommandRunner.RunCmdReturns(errors.New("failed to execute install script"))
 						invalidInstallationSecret := builder.Secret(ns, "invalid-test-secret").
@@ -560,6 +840,19 @@ runCmd:
 				}))
 			})
 
+			It("should forget the secondary IP addresses of the host", func() {
+				byoHost.Spec.UninstallationScript = &uninstallScript
+				byoHost.Spec.SecondaryIPAddresses = []infrastructurev1beta1.HostIPAddress{{Address: "10.10.10.10/24", Interface: "byoh-missing0"}}
+				Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+				_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{NamespacedName: byoHostLookupKey})
+				Expect(reconcilerErr).ToNot(HaveOccurred())
+
+				updatedByoHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+				Expect(updatedByoHost.Spec.SecondaryIPAddresses).To(BeEmpty())
+			})
+
 			It("should return an error if we fail to load the uninstallation script", func() {
 				byoHost.Spec.UninstallationScript = nil
 				Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
@@ -720,3 +1013,18 @@ runCmd:
 		})
 	})
 })
+
+// fakeNamespaceMover records the namespace the host is moved to
+type fakeNamespaceMover struct {
+	namespace string
+	movedTo   string
+}
+
+func (m *fakeNamespaceMover) Namespace() string {
+	return m.namespace
+}
+
+func (m *fakeNamespaceMover) MoveToNamespace(_ context.Context, _ *infrastructurev1beta1.ByoHost, namespace string) error {
+	m.movedTo = namespace
+	return nil
+}
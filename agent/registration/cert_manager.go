@@ -0,0 +1,284 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	certv1 "k8s.io/api/certificates/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/certificate/csr"
+	"k8s.io/client-go/util/connrotation"
+	"k8s.io/client-go/util/keyutil"
+)
+
+const (
+	// ByohRenewalCSRNameFormat is the name of the CSRs created to renew the certificate of a host,
+	// it keeps the ByohCSRNameFormat prefix so that the CSR is picked by the BYOH admission controller
+	ByohRenewalCSRNameFormat = ByohCSRNameFormat + "-%s"
+
+	renewalCSRSuffixLength = 5
+	// renewal starts when 70% to 90% of the lifetime of the certificate has passed
+	minRenewalFraction    = 0.7
+	renewalJitterFraction = 0.2
+	maxRenewalBackoff     = 5 * time.Minute
+)
+
+// CertificateManager renews the client certificate of the host before it
+// expires. The renewal CSR is authenticated with the current certificate, so
+// the bootstrap kubeconfig is not needed. Renewed certificates are written to
+// the key directory, referenced from the BYOH kubeconfig, and hot swapped in
+// the clients created from the rest.Config passed to NewCertificateManager.
+type CertificateManager struct {
+	// KeyAlgorithm is the algorithm of the private keys of the renewed certificates, KeyAlgorithmRSA if empty
+	KeyAlgorithm string
+	// HostIdentity is presented in the CSRs of the renewed certificates
+	HostIdentity *infrastructurev1beta1.HostIdentity
+
+	hostName       string
+	kubeconfigPath string
+	clientConfig   *restclient.Config
+	dialer         *connrotation.Dialer
+	logger         logr.Logger
+
+	mu       sync.RWMutex
+	current  *tls.Certificate
+	lifetime time.Duration
+}
+
+// NewCertificateManager returns a CertificateManager for the client certificate of clientConfig.
+// clientConfig is updated to always present the current certificate.
+func NewCertificateManager(logger logr.Logger, clientConfig *restclient.Config, kubeconfigPath, hostName string, expiryDurationInSeconds int64) (*CertificateManager, error) {
+	current, err := currentCertificate(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	m := &CertificateManager{
+		hostName:       hostName,
+		kubeconfigPath: kubeconfigPath,
+		clientConfig:   clientConfig,
+		logger:         logger,
+		current:        current,
+		lifetime:       time.Duration(expiryDurationInSeconds) * time.Second,
+	}
+	if err = m.updateTransport(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// currentCertificate returns the client certificate of clientConfig
+func currentCertificate(clientConfig *restclient.Config) (*tls.Certificate, error) {
+	certData, keyData := clientConfig.CertData, clientConfig.KeyData
+	var err error
+	if len(certData) == 0 && clientConfig.CertFile != "" {
+		if certData, err = os.ReadFile(clientConfig.CertFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(keyData) == 0 && clientConfig.KeyFile != "" {
+		if keyData, err = os.ReadFile(clientConfig.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(certData) == 0 || len(keyData) == 0 {
+		return nil, errors.New("the kubeconfig does not use a client certificate")
+	}
+	return parseCertificate(certData, keyData)
+}
+
+func parseCertificate(certData, keyData []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %v", err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %v", err)
+	}
+	return &cert, nil
+}
+
+// updateTransport makes the clients created from clientConfig use the current
+// certificate for every new connection
+func (m *CertificateManager) updateTransport() error {
+	tlsConfig, err := restclient.TLSConfigFor(m.clientConfig)
+	if err != nil {
+		return fmt.Errorf("unable to configure TLS for the client certificate rotation: %v", err)
+	}
+	tlsConfig.Certificates = nil
+	tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return m.Current(), nil
+	}
+
+	m.dialer = connrotation.NewDialer((&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext) //nolint: gomnd
+	m.clientConfig.Transport = utilnet.SetTransportDefaults(&http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second, //nolint: gomnd
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: 25, //nolint: gomnd
+		DialContext:         m.dialer.DialContext,
+	})
+	// the TLS settings are now part of the transport
+	m.clientConfig.TLSClientConfig = restclient.TLSClientConfig{}
+	return nil
+}
+
+// Current returns the current client certificate
+func (m *CertificateManager) Current() *tls.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// SetCertificateLifetime changes the lifetime requested for the next certificates
+func (m *CertificateManager) SetCertificateLifetime(expiryDurationInSeconds int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lifetime = time.Duration(expiryDurationInSeconds) * time.Second
+}
+
+// nextRotationDeadline returns when the current certificate should be renewed
+func (m *CertificateManager) nextRotationDeadline() time.Time {
+	leaf := m.Current().Leaf
+	total := float64(leaf.NotAfter.Sub(leaf.NotBefore))
+	jittered := time.Duration(total * (minRenewalFraction + renewalJitterFraction*rand.Float64())) //nolint: gosec
+	return leaf.NotBefore.Add(jittered)
+}
+
+// Start implements manager.Runnable, it renews the certificate until ctx is done
+func (m *CertificateManager) Start(ctx context.Context) error {
+	for {
+		deadline := m.nextRotationDeadline()
+		m.logger.Info("client certificate rotation scheduled", "expiration", m.Current().Leaf.NotAfter, "deadline", deadline)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(deadline)):
+		}
+
+		backoff := wait.Backoff{Duration: 2 * time.Second, Factor: 2, Jitter: 0.1, Steps: 10, Cap: maxRenewalBackoff} //nolint: gomnd
+		err := wait.ExponentialBackoffWithContext(ctx, backoff, func() (bool, error) {
+			if err := m.rotate(ctx); err != nil {
+				m.logger.Error(err, "failed to renew the client certificate")
+				return false, nil
+			}
+			return true, nil
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			m.logger.Error(err, "client certificate renewal is still failing, retrying")
+		}
+	}
+}
+
+// rotate requests a new certificate, stores it and swaps it in
+func (m *CertificateManager) rotate(ctx context.Context) error {
+	if leaf := m.Current().Leaf; time.Now().After(leaf.NotAfter) {
+		return fmt.Errorf("the client certificate expired at %s, remove %s and register the host again with a bootstrap kubeconfig",
+			leaf.NotAfter, m.kubeconfigPath)
+	}
+
+	keyData, err := generatePrivateKeyPEM(m.KeyAlgorithm)
+	if err != nil {
+		return err
+	}
+	privateKey, err := keyutil.ParsePrivateKeyPEM(keyData)
+	if err != nil {
+		return err
+	}
+	csrData, err := generateCSR(m.hostName, privateKey, m.HostIdentity)
+	if err != nil {
+		return fmt.Errorf("error generating csr %s, err=%v", m.hostName, err)
+	}
+	client, err := clientset.NewForConfig(m.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	lifetime := m.lifetime
+	m.mu.RUnlock()
+	reqName, reqUID, err := csr.RequestCertificate(client,
+		csrData,
+		fmt.Sprintf(ByohRenewalCSRNameFormat, m.hostName, utilrand.String(renewalCSRSuffixLength)),
+		certv1.KubeAPIServerClientSignerName,
+		&lifetime,
+		[]certv1.KeyUsage{certv1.UsageClientAuth},
+		privateKey)
+	if err != nil {
+		return err
+	}
+	m.logger.Info("renewal CSR created, waiting for the certificate to be issued", "csr", reqName)
+
+	waitCtx, cancel := context.WithTimeout(ctx, CSRApprovalTimeout)
+	defer cancel()
+	certData, err := csr.WaitForCertificate(waitCtx, client, reqName, reqUID)
+	if err != nil {
+		return err
+	}
+	renewed, err := parseCertificate(certData, keyData)
+	if err != nil {
+		return err
+	}
+	if err = m.storeCertificate(certData, keyData); err != nil {
+		return fmt.Errorf("unable to store the renewed certificate: %v", err)
+	}
+
+	m.mu.Lock()
+	m.current = renewed
+	m.mu.Unlock()
+	// existing connections keep using the previous certificate until they are re-established
+	m.dialer.CloseAll()
+	m.logger.Info("client certificate renewed", "expiration", renewed.Leaf.NotAfter)
+	return nil
+}
+
+// storeCertificate writes the certificate and its key to the key directory and makes
+// the kubeconfig reference them, which migrates the kubeconfigs embedding the certificate
+func (m *CertificateManager) storeCertificate(certData, keyData []byte) error {
+	certPath, keyPath, err := writeClientCertificate(certData, keyData)
+	if err != nil {
+		return err
+	}
+	return updateKubeconfigCertificate(m.kubeconfigPath, certPath, keyPath)
+}
+
+// updateKubeconfigCertificate replaces the client certificate of the current context of the kubeconfig
+// with the certificate and key files
+func updateKubeconfigCertificate(kubeconfigPath, certPath, keyPath string) error {
+	kubeconfig, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	currentContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return fmt.Errorf("current context %q not found in %s", kubeconfig.CurrentContext, kubeconfigPath)
+	}
+	authInfo, ok := kubeconfig.AuthInfos[currentContext.AuthInfo]
+	if !ok {
+		return fmt.Errorf("user %q not found in %s", currentContext.AuthInfo, kubeconfigPath)
+	}
+	authInfo.ClientCertificate, authInfo.ClientKey = certPath, keyPath
+	authInfo.ClientCertificateData, authInfo.ClientKeyData = nil, nil
+	return clientcmd.WriteToFile(*kubeconfig, kubeconfigPath)
+}
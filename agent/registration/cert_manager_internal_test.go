@@ -0,0 +1,130 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/cert"
+)
+
+var _ = Describe("Certificate manager", func() {
+	var (
+		certData, keyData []byte
+		clientConfig      *restclient.Config
+		kubeconfigPath    string
+	)
+
+	BeforeEach(func() {
+		var err error
+		certData, keyData, err = cert.GenerateSelfSignedCertKey("byoh:host:test-host", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		clientConfig = &restclient.Config{
+			Host: "https://cluster-a.com",
+			TLSClientConfig: restclient.TLSClientConfig{
+				CertData: certData,
+				KeyData:  keyData,
+				Insecure: true,
+			},
+		}
+
+		kubeconfigPath = filepath.Join(GinkgoT().TempDir(), "config")
+		Expect(clientcmd.WriteToFile(clientcmdapi.Config{
+			Clusters:       map[string]*clientcmdapi.Cluster{"default-cluster": {Server: "https://cluster-a.com"}},
+			AuthInfos:      map[string]*clientcmdapi.AuthInfo{"default-auth": {ClientCertificateData: certData, ClientKeyData: keyData}},
+			Contexts:       map[string]*clientcmdapi.Context{"default-context": {Cluster: "default-cluster", AuthInfo: "default-auth"}},
+			CurrentContext: "default-context",
+		}, kubeconfigPath)).To(Succeed())
+	})
+
+	It("should fail if the kubeconfig does not use a client certificate", func() {
+		_, err := NewCertificateManager(logr.Discard(), &restclient.Config{BearerToken: "token"}, kubeconfigPath, "test-host", ExpirationSeconds)
+		Expect(err).To(MatchError("the kubeconfig does not use a client certificate"))
+	})
+
+	It("should fail if the client certificate is not valid", func() {
+		clientConfig.CertData = []byte("inValidData")
+		_, err := NewCertificateManager(logr.Discard(), clientConfig, kubeconfigPath, "test-host", ExpirationSeconds)
+		Expect(err).To(MatchError(ContainSubstring("invalid client certificate")))
+	})
+
+	It("should present the current certificate on new connections", func() {
+		m, err := NewCertificateManager(logr.Discard(), clientConfig, kubeconfigPath, "test-host", ExpirationSeconds)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clientConfig.TLSClientConfig).To(Equal(restclient.TLSClientConfig{}))
+		Expect(clientConfig.Transport).NotTo(BeNil())
+
+		transport, ok := clientConfig.Transport.(*http.Transport)
+		Expect(ok).To(BeTrue())
+		Expect(transport.TLSClientConfig.InsecureSkipVerify).To(BeTrue())
+		presented, err := transport.TLSClientConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(presented).To(BeIdenticalTo(m.Current()))
+		Expect(m.Current().Leaf.Subject.CommonName).To(HavePrefix("byoh:host:test-host"))
+
+		// clients can be created from the rotating config
+		_, err = restclient.HTTPClientFor(clientConfig)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should schedule the rotation when 70% to 90% of the certificate lifetime has passed", func() {
+		m, err := NewCertificateManager(logr.Discard(), clientConfig, kubeconfigPath, "test-host", ExpirationSeconds)
+		Expect(err).NotTo(HaveOccurred())
+		leaf := m.Current().Leaf
+		lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+		for i := 0; i < 10; i++ {
+			deadline := m.nextRotationDeadline()
+			Expect(deadline).To(BeTemporally(">=", leaf.NotBefore.Add(lifetime*7/10)))
+			Expect(deadline).To(BeTemporally("<=", leaf.NotBefore.Add(lifetime*9/10)))
+		}
+	})
+
+	It("should not renew an expired certificate", func() {
+		m, err := NewCertificateManager(logr.Discard(), clientConfig, kubeconfigPath, "test-host", ExpirationSeconds)
+		Expect(err).NotTo(HaveOccurred())
+		m.current.Leaf.NotAfter = time.Now().Add(-time.Minute)
+		Expect(m.rotate(context.TODO())).To(MatchError(ContainSubstring("the client certificate expired")))
+	})
+
+	It("should store the renewed certificate in the key directory and reference it from the kubeconfig", func() {
+		KeyDir = filepath.Join(GinkgoT().TempDir(), "pki")
+		defer func() { KeyDir = "" }()
+		m, err := NewCertificateManager(logr.Discard(), clientConfig, kubeconfigPath, "test-host", ExpirationSeconds)
+		Expect(err).NotTo(HaveOccurred())
+		renewedCert, renewedKey, err := cert.GenerateSelfSignedCertKey("byoh:host:test-host", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.storeCertificate(renewedCert, renewedKey)).To(Succeed())
+
+		for path, data := range map[string][]byte{GetClientCertPath(): renewedCert, GetClientKeyPath(): renewedKey} {
+			Expect(os.ReadFile(path)).To(Equal(data))
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+		}
+		kubeconfig, err := clientcmd.LoadFromFile(kubeconfigPath)
+		Expect(err).NotTo(HaveOccurred())
+		authInfo := kubeconfig.AuthInfos["default-auth"]
+		Expect(authInfo.ClientCertificate).To(Equal(GetClientCertPath()))
+		Expect(authInfo.ClientKey).To(Equal(GetClientKeyPath()))
+		Expect(authInfo.ClientCertificateData).To(BeEmpty())
+		Expect(authInfo.ClientKeyData).To(BeEmpty())
+		Expect(kubeconfig.Clusters["default-cluster"].Server).To(Equal("https://cluster-a.com"))
+	})
+
+	It("should fail to store the renewed certificate if the kubeconfig is missing", func() {
+		Expect(os.Remove(kubeconfigPath)).To(Succeed())
+		Expect(updateKubeconfigCertificate(kubeconfigPath, "byoh-client.crt", "byoh-client.key")).NotTo(Succeed())
+	})
+})
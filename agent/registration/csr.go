@@ -15,7 +15,10 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/hostidentity"
 	certv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	clientset "k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
@@ -27,6 +30,7 @@ import (
 )
 
 const (
+	// KeySize is the size of the RSA keys of the client certificates of the host
 	KeySize = 2048
 	// ExpirationSeconds defines the expiry time for Certificates
 	// which is currently set to 1 year aligned with kubeadm defaults.
@@ -34,8 +38,11 @@ const (
 	ByohCSROrg        = "byoh:hosts"
 	ByohCSRCNFormat   = "byoh:host:%s"
 	ByohCSRNameFormat = "byoh-csr-%s"
+	// TmpPrivateKey is the file of the private key of a pending certificate request, in the key directory
 	TmpPrivateKey     = "byoh-client.key.tmp"
 	DefaultConfigPath = ".byoh/config"
+	// EncryptionKeyFile is the file of the encryption key of the host, in the key directory
+	EncryptionKeyFile = "encryption.key"
 )
 
 var (
@@ -52,6 +59,12 @@ type ByohCSR struct {
 	configPath            string
 	logger                logr.Logger
 	expiryDuration        time.Duration
+	// Namespace is the namespace of the context of the generated kubeconfig
+	Namespace string
+	// KeyAlgorithm is the algorithm of the private key of the client certificate, KeyAlgorithmRSA if empty
+	KeyAlgorithm string
+	// HostIdentity is presented in the CSR, so that the CSR is only approved for the machine the host was registered from
+	HostIdentity *infrastructurev1beta1.HostIdentity
 }
 
 // NewByohCSR returns a ByohCSR instance
@@ -86,12 +99,16 @@ func (bcsr *ByohCSR) BootstrapKubeconfig(hostName string) error {
 	if err != nil {
 		return err
 	}
-	err = writeKubeconfigFromBootstrapping(bcsr.bootstrapClientConfig, bcsr.configPath, certData, bcsr.PrivateKey)
+	certPath, keyPath, err := writeClientCertificate(certData, bcsr.PrivateKey)
 	if err != nil {
 		return err
 	}
-	bcsr.logger.Info("kubeconfig created", "path", bcsr.configPath)
-	if err := os.Remove(TmpPrivateKey); err != nil && !os.IsNotExist(err) {
+	err = writeKubeconfigFromBootstrapping(bcsr.bootstrapClientConfig, bcsr.configPath, bcsr.Namespace, certPath, keyPath)
+	if err != nil {
+		return err
+	}
+	bcsr.logger.Info("kubeconfig created", "path", bcsr.configPath, "certificate", certPath, "key", keyPath)
+	if err := os.Remove(getTmpPrivateKeyPath()); err != nil && !os.IsNotExist(err) {
 		bcsr.logger.Error(err, "Failed cleaning up private key file")
 	}
 	return nil
@@ -103,7 +120,7 @@ func (bcsr *ByohCSR) RequestBYOHClientCert(hostname string) (string, types.UID,
 	if hostname == "" {
 		return "", "", fmt.Errorf("hostname is not valid")
 	}
-	keyData, _, err := keyutil.LoadOrGenerateKeyFile(TmpPrivateKey)
+	keyData, err := loadOrGenerateKeyFile(getTmpPrivateKeyPath(), bcsr.KeyAlgorithm)
 	if err != nil {
 		return "", "", err
 	}
@@ -112,7 +129,7 @@ func (bcsr *ByohCSR) RequestBYOHClientCert(hostname string) (string, types.UID,
 		return "", "", fmt.Errorf("invalid private key for certificate request: %v", err)
 	}
 	bcsr.PrivateKey = keyData
-	csrData, err := generateCSR(hostname, privateKey)
+	csrData, err := generateCSR(hostname, privateKey, bcsr.HostIdentity)
 	if err != nil {
 		return "", "", fmt.Errorf("error generating csr %s, err=%v", hostname, err)
 	}
@@ -132,7 +149,7 @@ func (bcsr *ByohCSR) RequestBYOHClientCert(hostname string) (string, types.UID,
 	return reqName, reqUID, nil
 }
 
-func generateCSR(hostname string, privKey interface{}) ([]byte, error) {
+func generateCSR(hostname string, privKey interface{}, identity *infrastructurev1beta1.HostIdentity) ([]byte, error) {
 	// Generate a new *x509.CertificateRequest template
 	csrTemplate := x509.CertificateRequest{
 		Subject: pkix.Name{
@@ -140,6 +157,13 @@ func generateCSR(hostname string, privKey interface{}) ([]byte, error) {
 			Organization: []string{ByohCSROrg},
 		},
 	}
+	if identity != nil {
+		extension, err := hostidentity.Extension(identity)
+		if err != nil {
+			return nil, err
+		}
+		csrTemplate.ExtraExtensions = []pkix.Extension{extension}
+	}
 	// Generate the CSR bytes
 	csrData, err := x509.CreateCertificateRequest(rand.Reader, &csrTemplate, privKey)
 	if err != nil {
@@ -170,9 +194,26 @@ func LoadRESTClientConfig(kubeconfigPath string) (*restclient.Config, error) {
 	).ClientConfig()
 }
 
+// KubeconfigNamespace returns the namespace of the current context of the kubeconfig,
+// i.e. the namespace the BootstrapKubeconfig generated the bootstrap token for
+func KubeconfigNamespace(kubeconfigPath string) (string, error) {
+	loadedConfig, err := (&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath}).Load()
+	if err != nil {
+		return "", err
+	}
+	if currentContext, ok := loadedConfig.Contexts[loadedConfig.CurrentContext]; ok {
+		return currentContext.Namespace, nil
+	}
+	return "", nil
+}
+
 // writeKubeconfigFromBootstrapping will write the new kubeconfig fetching
-// some details from bootstrap client config and using key/cert details
-func writeKubeconfigFromBootstrapping(bootstrapClientConfig *restclient.Config, kubeconfigPath string, certData, keyData []byte) error {
+// some details from bootstrap client config and referencing the key/cert files
+func writeKubeconfigFromBootstrapping(bootstrapClientConfig *restclient.Config, kubeconfigPath, namespace, certPath, keyPath string) error {
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
 	// Get the CA data from the bootstrap client config.
 	caFile, caData := bootstrapClientConfig.CAFile, []byte{}
 	if caFile == "" {
@@ -190,14 +231,14 @@ func writeKubeconfigFromBootstrapping(bootstrapClientConfig *restclient.Config,
 		}},
 		// Define auth based on the obtained client cert.
 		AuthInfos: map[string]*clientcmdapi.AuthInfo{"default-auth": {
-			ClientCertificateData: certData,
-			ClientKeyData:         keyData,
+			ClientCertificate: certPath,
+			ClientKey:         keyPath,
 		}},
 		// Define a context that connects the auth info and cluster, and set it as the default
 		Contexts: map[string]*clientcmdapi.Context{"default-context": {
 			Cluster:   "default-cluster",
 			AuthInfo:  "default-auth",
-			Namespace: "default",
+			Namespace: namespace,
 		}},
 		CurrentContext: "default-context",
 	}
@@ -217,3 +258,8 @@ func GetBYOHConfigPath() string {
 	}
 	return filepath.Join(homeDir, DefaultConfigPath)
 }
+
+// GetEncryptionKeyPath returns the path of the encryption key of the host
+func GetEncryptionKeyPath() string {
+	return filepath.Join(GetKeyDir(), EncryptionKeyFile)
+}
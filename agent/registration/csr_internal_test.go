@@ -6,10 +6,15 @@ package registration
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"os"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/hostidentity"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 var _ = Describe("Registration", func() {
@@ -18,17 +23,29 @@ var _ = Describe("Registration", func() {
 			hostName = "test-host"
 		)
 		It("should return error if Private Key is not valid", func() {
-			certData, err := generateCSR(hostName, &rsa.PrivateKey{})
+			certData, err := generateCSR(hostName, &rsa.PrivateKey{}, nil)
 			Expect(err).Should(HaveOccurred())
 			Expect(certData).To(BeNil())
 		})
 		It("should return csrData with the correct arguments", func() {
 			privateKeyData, err := rsa.GenerateKey(rand.Reader, 2048)
 			Expect(err).Should(Not(HaveOccurred()))
-			certData, err := generateCSR(hostName, privateKeyData)
+			certData, err := generateCSR(hostName, privateKeyData, nil)
 			Expect(err).Should(Not(HaveOccurred()))
 			Expect(certData).ToNot(BeNil())
 		})
+		It("should present the identity of the host", func() {
+			privateKeyData, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).Should(Not(HaveOccurred()))
+			identity := &infrastructurev1beta1.HostIdentity{MachineID: "0123456789abcdef0123456789abcdef"}
+			certData, err := generateCSR(hostName, privateKeyData, identity)
+			Expect(err).Should(Not(HaveOccurred()))
+			block, _ := pem.Decode(certData)
+			Expect(block).ToNot(BeNil())
+			request, err := x509.ParseCertificateRequest(block.Bytes)
+			Expect(err).Should(Not(HaveOccurred()))
+			Expect(hostidentity.FromCertificateRequest(request)).To(Equal(identity))
+		})
 		It("should write kubeconfig if bootstrap kubeconfig is valid", func() {
 			testDatabootstrapValid := []byte(`
 apiVersion: v1
@@ -60,12 +77,18 @@ users:
 			Expect(err).ShouldNot(HaveOccurred())
 			restConfig, err := LoadRESTClientConfig(fileboot.Name())
 			Expect(err).ShouldNot(HaveOccurred())
-			err = writeKubeconfigFromBootstrapping(restConfig, filekubeconfig.Name(), []byte("cert-data"), []byte("key-data"))
+			err = writeKubeconfigFromBootstrapping(restConfig, filekubeconfig.Name(), "ns-b", "/etc/byoh/byoh-client.crt", "/etc/byoh/byoh-client.key")
 			Expect(err).ShouldNot(HaveOccurred())
 			Expect(filekubeconfig.Name()).To(BeARegularFile())
 			content, err := os.ReadFile(filekubeconfig.Name())
 			Expect(err).ShouldNot(HaveOccurred())
 			Expect(content).ShouldNot(BeEmpty())
+			Expect(KubeconfigNamespace(fileboot.Name())).To(Equal("ns-a"))
+			Expect(KubeconfigNamespace(filekubeconfig.Name())).To(Equal("ns-b"))
+			kubeconfig, err := clientcmd.LoadFromFile(filekubeconfig.Name())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(kubeconfig.AuthInfos["default-auth"].ClientCertificate).To(Equal("/etc/byoh/byoh-client.crt"))
+			Expect(kubeconfig.AuthInfos["default-auth"].ClientKey).To(Equal("/etc/byoh/byoh-client.key"))
 			err = os.RemoveAll(fileDir)
 			Expect(err).ToNot(HaveOccurred())
 		})
@@ -99,6 +99,7 @@ kovW9X7Ook/tTW0HyX6D6HRciA==
 		})
 
 		AfterEach(func() {
+			registration.KeyDir = ""
 			err := os.RemoveAll(fileDir)
 			Expect(err).ToNot(HaveOccurred())
 		})
@@ -200,12 +201,12 @@ kovW9X7Ook/tTW0HyX6D6HRciA==
 				}
 			}()
 			registration.ConfigPath = "/non-existent-mount/config"
+			registration.KeyDir = fileDir
 			CSRRegistrar, err := registration.NewByohCSR(cfg, klogr.New(), certExpiryDuration)
 			Expect(err).ShouldNot(HaveOccurred())
 			err = CSRRegistrar.BootstrapKubeconfig(hostName)
 			Expect(err).Should(HaveOccurred())
 			Expect(err).To(MatchError("mkdir /non-existent-mount: permission denied"))
-			Expect(os.Remove(registration.TmpPrivateKey)).ShouldNot(HaveOccurred())
 		})
 		It("should create kubeconfig if csr is approved", func() {
 			// Simulate ByoAdmission Controller
@@ -232,11 +233,18 @@ kovW9X7Ook/tTW0HyX6D6HRciA==
 					return
 				}
 			}()
+			registration.KeyDir = fileDir
 			CSRRegistrar, err := registration.NewByohCSR(cfg, klogr.New(), certExpiryDuration)
 			Expect(err).ShouldNot(HaveOccurred())
 			err = CSRRegistrar.BootstrapKubeconfig(hostName)
 			Expect(err).ShouldNot(HaveOccurred())
 			Expect(registration.ConfigPath).To(BeARegularFile())
+			for _, path := range []string{registration.GetClientCertPath(), registration.GetClientKeyPath()} {
+				info, err := os.Stat(path)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+			}
+			Expect(filepath.Join(fileDir, registration.TmpPrivateKey)).ToNot(BeAnExistingFile())
 			Expect(os.Remove(registration.ConfigPath)).ShouldNot(HaveOccurred())
 		})
 	})
@@ -0,0 +1,264 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// FactLabelPrefix is the prefix of the labels the agent derives from the host facts
+	FactLabelPrefix = "facts.byoh.infrastructure.cluster.x-k8s.io/"
+
+	// ArchLabel is the CPU architecture of the host, e.g. amd64
+	ArchLabel = FactLabelPrefix + "arch"
+	// OSLabel is the ID of the operating system from os-release, e.g. ubuntu
+	OSLabel = FactLabelPrefix + "os"
+	// OSVersionLabel is the VERSION_ID of the operating system from os-release, e.g. 20.04
+	OSVersionLabel = FactLabelPrefix + "os-version"
+	// CPUCountLabel is the power of two range the number of CPUs falls in, e.g. 8-15
+	CPUCountLabel = FactLabelPrefix + "cpu-count"
+	// MemoryLabel is the power of two range the memory (in GiB) falls in, e.g. 16-31
+	MemoryLabel = FactLabelPrefix + "memory-gib"
+	// GPULabel is "true" if the host has a GPU of a known vendor
+	GPULabel = FactLabelPrefix + "gpu"
+	// GPUVendorLabelPrefix is followed by the vendor of each GPU found, e.g. gpu-nvidia=true
+	GPUVendorLabelPrefix = FactLabelPrefix + "gpu-"
+	// NICSpeedLabel is the speed class of the default network interface, e.g. 10g
+	NICSpeedLabel = FactLabelPrefix + "nic-speed"
+
+	pciDisplayControllerClass = "0x03"
+	mbpsPerGbps               = 1000
+)
+
+// gpuVendors maps PCI vendor IDs to the vendor names used in the labels.
+// Other display controllers, like the ones of BMCs, are not considered GPUs.
+var gpuVendors = map[string]string{
+	"0x10de": "nvidia",
+	"0x1002": "amd",
+	"0x8086": "intel",
+}
+
+// HostFacts are the hardware and software facts discovered on the host
+type HostFacts struct {
+	Architecture string
+	OSID         string
+	OSVersion    string
+	CPUs         int
+	MemoryBytes  uint64
+	GPUVendors   []string
+	// NICSpeedMbps is the speed of the default network interface, 0 if unknown
+	NICSpeedMbps int
+}
+
+// labelRule derives labels from the host facts
+type labelRule func(facts *HostFacts, labels map[string]string)
+
+var labelRules = []labelRule{
+	func(f *HostFacts, labels map[string]string) {
+		labels[ArchLabel] = f.Architecture
+	},
+	func(f *HostFacts, labels map[string]string) {
+		labels[OSLabel] = f.OSID
+		labels[OSVersionLabel] = f.OSVersion
+	},
+	func(f *HostFacts, labels map[string]string) {
+		labels[CPUCountLabel] = powerOfTwoRange(uint64(f.CPUs))
+	},
+	func(f *HostFacts, labels map[string]string) {
+		// round up, the kernel reserves part of the installed memory
+		gib := (f.MemoryBytes + (1 << 30) - 1) >> 30 //nolint: gomnd
+		labels[MemoryLabel] = powerOfTwoRange(gib)
+	},
+	func(f *HostFacts, labels map[string]string) {
+		labels[GPULabel] = strconv.FormatBool(len(f.GPUVendors) > 0)
+		for _, vendor := range f.GPUVendors {
+			labels[GPUVendorLabelPrefix+vendor] = "true"
+		}
+	},
+	func(f *HostFacts, labels map[string]string) {
+		labels[NICSpeedLabel] = nicSpeedClass(f.NICSpeedMbps)
+	},
+}
+
+// Labels returns the labels derived from the host facts. Facts that could not
+// be discovered do not produce a label.
+func (f *HostFacts) Labels() map[string]string {
+	labels := make(map[string]string)
+	for _, rule := range labelRules {
+		rule(f, labels)
+	}
+	for key, value := range labels {
+		if value == "" || len(validation.IsValidLabelValue(value)) > 0 {
+			delete(labels, key)
+		}
+	}
+	return labels
+}
+
+// DiscoverHostFacts discovers the facts of the local host. The NIC speed is
+// the one of the default network interface.
+func (hr *HostRegistrar) DiscoverHostFacts() (*HostFacts, error) {
+	if hr.DefaultNetworkInterface() == "" {
+		// looks up the default network interface
+		hr.GetNetworkStatus()
+	}
+	return discoverHostFacts("/", hr.DefaultNetworkInterface())
+}
+
+func discoverHostFacts(root, defaultInterface string) (*HostFacts, error) {
+	facts := &HostFacts{Architecture: runtime.GOARCH}
+
+	readFile := func(path string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(root, path))
+	}
+	osRelease, err := readFile("/etc/os-release")
+	if err != nil && os.IsNotExist(err) {
+		osRelease, err = readFile("/usr/lib/os-release")
+	}
+	if err == nil {
+		facts.OSID = osReleaseValue(osRelease, "ID")
+		facts.OSVersion = osReleaseValue(osRelease, "VERSION_ID")
+	}
+
+	if facts.CPUs, err = countCPUs(readFile); err != nil {
+		return nil, fmt.Errorf("failed to count the host CPUs: %v", err)
+	}
+	if facts.MemoryBytes, err = totalMemory(readFile); err != nil {
+		return nil, fmt.Errorf("failed to get the host memory: %v", err)
+	}
+	if facts.GPUVendors, err = findGPUVendors(filepath.Join(root, "/sys/bus/pci/devices")); err != nil {
+		return nil, fmt.Errorf("failed to look up the host GPUs: %v", err)
+	}
+	if defaultInterface != "" {
+		// virtual interfaces do not report a speed
+		if speed, err := readFile(filepath.Join("/sys/class/net", defaultInterface, "speed")); err == nil {
+			if mbps, err := strconv.Atoi(strings.TrimSpace(string(speed))); err == nil && mbps > 0 {
+				facts.NICSpeedMbps = mbps
+			}
+		}
+	}
+	return facts, nil
+}
+
+func osReleaseValue(osRelease []byte, key string) string {
+	rex := regexp.MustCompile("(?m)^" + key + "=(.*)$")
+	match := rex.FindSubmatch(osRelease)
+	if match == nil {
+		return ""
+	}
+	return strings.Trim(string(match[1]), "\"'")
+}
+
+func countCPUs(readFile func(string) ([]byte, error)) (int, error) {
+	cpuinfo, err := readFile("/proc/cpuinfo")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return runtime.NumCPU(), nil
+		}
+		return 0, err
+	}
+	cpus := 0
+	scanner := bufio.NewScanner(bytes.NewReader(cpuinfo))
+	for scanner.Scan() {
+		if key, _, found := strings.Cut(scanner.Text(), ":"); found && strings.TrimSpace(key) == "processor" {
+			cpus++
+		}
+	}
+	return cpus, scanner.Err()
+}
+
+func totalMemory(readFile func(string) ([]byte, error)) (uint64, error) {
+	meminfo, err := readFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(meminfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" { //nolint: gomnd
+			continue
+		}
+		kib, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MemTotal %q: %v", fields[1], err)
+		}
+		return kib << 10, nil //nolint: gomnd
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+}
+
+func findGPUVendors(pciDevices string) ([]string, error) {
+	devices, err := os.ReadDir(pciDevices)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, device := range devices {
+		class, err := os.ReadFile(filepath.Join(pciDevices, device.Name(), "class"))
+		if err != nil || !strings.HasPrefix(strings.TrimSpace(string(class)), pciDisplayControllerClass) {
+			continue
+		}
+		vendorID, err := os.ReadFile(filepath.Join(pciDevices, device.Name(), "vendor"))
+		if err != nil {
+			continue
+		}
+		if vendor, ok := gpuVendors[strings.TrimSpace(string(vendorID))]; ok {
+			found[vendor] = true
+		}
+	}
+	vendors := make([]string, 0, len(found))
+	for vendor := range found {
+		vendors = append(vendors, vendor)
+	}
+	sort.Strings(vendors)
+	return vendors, nil
+}
+
+// powerOfTwoRange returns the range between two consecutive powers of two n falls in, e.g. 8-15 for 12
+func powerOfTwoRange(n uint64) string {
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return "1"
+	}
+	low := uint64(1) << (bits.Len64(n) - 1)
+	return fmt.Sprintf("%d-%d", low, 2*low-1) //nolint: gomnd
+}
+
+// nicSpeedClass returns the speed class of a network interface running at mbps
+func nicSpeedClass(mbps int) string {
+	switch {
+	case mbps <= 0:
+		return ""
+	case mbps < mbpsPerGbps:
+		return "sub-1g"
+	}
+	class := 1
+	for _, gbps := range []int{10, 25, 40, 50, 100, 200, 400} {
+		if mbps >= gbps*mbpsPerGbps {
+			class = gbps
+		}
+	}
+	return fmt.Sprintf("%dg", class)
+}
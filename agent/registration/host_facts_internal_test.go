@@ -0,0 +1,115 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Host facts", func() {
+	var root string
+
+	writeFile := func(path, content string) {
+		path = filepath.Join(root, path)
+		Expect(os.MkdirAll(filepath.Dir(path), 0750)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+
+	addPCIDevice := func(address, class, vendor string) {
+		writeFile(filepath.Join("/sys/bus/pci/devices", address, "class"), class+"\n")
+		writeFile(filepath.Join("/sys/bus/pci/devices", address, "vendor"), vendor+"\n")
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		writeFile("/etc/os-release", "NAME=\"Ubuntu\"\nID=ubuntu\nVERSION_ID=\"20.04\"\nPRETTY_NAME=\"Ubuntu 20.04.4 LTS\"\n")
+		writeFile("/proc/cpuinfo", "processor\t: 0\nmodel name\t: test\n\nprocessor\t: 1\n\nprocessor\t: 2\n\nprocessor\t: 3\n\nprocessor\t: 4\n")
+		writeFile("/proc/meminfo", "MemTotal:       16305372 kB\nMemFree:         1043276 kB\n")
+		writeFile("/sys/class/net/eth0/speed", "10000\n")
+	})
+
+	It("should discover the host facts", func() {
+		addPCIDevice("0000:00:02.0", "0x030000", "0x1a03")
+		addPCIDevice("0000:3b:00.0", "0x030200", "0x10de")
+		addPCIDevice("0000:5e:00.0", "0x020000", "0x8086")
+
+		facts, err := discoverHostFacts(root, "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts).To(Equal(&HostFacts{
+			Architecture: runtime.GOARCH,
+			OSID:         "ubuntu",
+			OSVersion:    "20.04",
+			CPUs:         5,
+			MemoryBytes:  16305372 * 1024,
+			GPUVendors:   []string{"nvidia"},
+			NICSpeedMbps: 10000,
+		}))
+	})
+
+	It("should derive the labels from the host facts", func() {
+		addPCIDevice("0000:3b:00.0", "0x030200", "0x10de")
+		addPCIDevice("0000:af:00.0", "0x038000", "0x1002")
+
+		facts, err := discoverHostFacts(root, "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(facts.Labels()).To(Equal(map[string]string{
+			ArchLabel:                       runtime.GOARCH,
+			OSLabel:                         "ubuntu",
+			OSVersionLabel:                  "20.04",
+			CPUCountLabel:                   "4-7",
+			MemoryLabel:                     "16-31",
+			GPULabel:                        "true",
+			GPUVendorLabelPrefix + "amd":    "true",
+			GPUVendorLabelPrefix + "nvidia": "true",
+			NICSpeedLabel:                   "10g",
+		}))
+	})
+
+	It("should skip the facts that are not available", func() {
+		Expect(os.RemoveAll(filepath.Join(root, "/etc/os-release"))).To(Succeed())
+		writeFile("/sys/class/net/eth0/speed", "-1\n")
+
+		facts, err := discoverHostFacts(root, "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		labels := facts.Labels()
+		Expect(labels).NotTo(HaveKey(OSLabel))
+		Expect(labels).NotTo(HaveKey(NICSpeedLabel))
+		Expect(labels).To(HaveKeyWithValue(GPULabel, "false"))
+	})
+
+	It("should fail when the memory cannot be read", func() {
+		Expect(os.RemoveAll(filepath.Join(root, "/proc/meminfo"))).To(Succeed())
+
+		_, err := discoverHostFacts(root, "eth0")
+		Expect(err).To(MatchError(ContainSubstring("failed to get the host memory")))
+	})
+
+	DescribeTable("power of two ranges",
+		func(n uint64, expected string) {
+			Expect(powerOfTwoRange(n)).To(Equal(expected))
+		},
+		Entry("zero", uint64(0), ""),
+		Entry("one", uint64(1), "1"),
+		Entry("lower bound", uint64(8), "8-15"),
+		Entry("upper bound", uint64(15), "8-15"),
+		Entry("large", uint64(300), "256-511"),
+	)
+
+	DescribeTable("NIC speed classes",
+		func(mbps int, expected string) {
+			Expect(nicSpeedClass(mbps)).To(Equal(expected))
+		},
+		Entry("unknown", -1, ""),
+		Entry("100 Mb/s", 100, "sub-1g"),
+		Entry("1 Gb/s", 1000, "1g"),
+		Entry("2.5 Gb/s", 2500, "1g"),
+		Entry("25 Gb/s", 25000, "25g"),
+		Entry("100 Gb/s", 100000, "100g"),
+	)
+})
@@ -0,0 +1,108 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// HostNameData is the data of the host name templates, e.g. {{.Hostname}}-{{.MachineID | trunc 8}}
+type HostNameData struct {
+	// Hostname is the hostname of the host as reported by the kernel
+	Hostname string
+	// ShortHostname is the hostname up to its first dot
+	ShortHostname string
+	MachineID     string
+	ProductUUID   string
+}
+
+// NewHostNameData returns the data of the host name templates of the host
+func NewHostNameData(hostname string, identity *infrastructurev1beta1.HostIdentity) HostNameData {
+	data := HostNameData{
+		Hostname:      hostname,
+		ShortHostname: strings.SplitN(hostname, ".", 2)[0], //nolint: gomnd
+	}
+	if identity != nil {
+		data.MachineID = identity.MachineID
+		data.ProductUUID = identity.ProductUUID
+	}
+	return data
+}
+
+var hostNameFuncs = template.FuncMap{
+	// trunc keeps the first n characters of s, it is meant to be used in a pipeline: {{.MachineID | trunc 8}}
+	"trunc": func(n int, s string) string {
+		if n >= 0 && len(s) > n {
+			return s[:n]
+		}
+		return s
+	},
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+}
+
+// ParseHostNameTemplate parses a host name template
+func ParseHostNameTemplate(nameTemplate string) (*template.Template, error) {
+	tmpl, err := template.New("hostName").Funcs(hostNameFuncs).Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host name template %q: %v", nameTemplate, err)
+	}
+	return tmpl, nil
+}
+
+// ResolveHostName returns the name of the host, used as the name of its ByoHost, the common name
+// of its client certificates and its Kubernetes node name. It is the host name template, or the
+// hostname if the template is empty, executed with data and normalized with NormalizeHostName.
+func ResolveHostName(nameTemplate string, data HostNameData) (string, error) {
+	if nameTemplate == "" {
+		nameTemplate = "{{.Hostname}}"
+	}
+	tmpl, err := ParseHostNameTemplate(nameTemplate)
+	if err != nil {
+		return "", err
+	}
+	var name bytes.Buffer
+	if err = tmpl.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("error executing host name template %q: %v", nameTemplate, err)
+	}
+
+	hostName := NormalizeHostName(name.String())
+	if errs := validation.IsDNS1123Subdomain(hostName); len(errs) > 0 {
+		return "", fmt.Errorf("host name %q of template %q is invalid: %s", hostName, nameTemplate, strings.Join(errs, ", "))
+	}
+	return hostName, nil
+}
+
+// NormalizeHostName turns name into a DNS-1123 subdomain: it is lowercased, the characters other
+// than alphanumerics, '-' and '.' are replaced with '-', and the labels are trimmed of their
+// leading and trailing '-'. Empty labels are dropped and the result is cut to 253 characters.
+func NormalizeHostName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, strings.ToLower(strings.TrimSpace(name)))
+
+	labels := make([]string, 0, strings.Count(name, ".")+1)
+	for _, label := range strings.Split(name, ".") {
+		if label = strings.Trim(label, "-"); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	name = strings.Join(labels, ".")
+	if len(name) > validation.DNS1123SubdomainMaxLength {
+		name = strings.TrimRight(name[:validation.DNS1123SubdomainMaxLength], "-.")
+	}
+	return name
+}
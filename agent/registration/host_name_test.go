@@ -0,0 +1,63 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+)
+
+var _ = Describe("Host name", func() {
+	var data registration.HostNameData
+
+	BeforeEach(func() {
+		data = registration.NewHostNameData("Worker-01.Site-A.example.com", &infrastructurev1beta1.HostIdentity{
+			MachineID:   "0123456789abcdef0123456789abcdef",
+			ProductUUID: "4C4C4544-0042-4A10-8052-B4C04F4E4D32",
+		})
+	})
+
+	It("should default to the normalized hostname", func() {
+		Expect(registration.ResolveHostName("", data)).To(Equal("worker-01.site-a.example.com"))
+	})
+
+	It("should execute the host name template", func() {
+		Expect(registration.ResolveHostName("{{.ShortHostname}}-{{.MachineID | trunc 8}}", data)).To(Equal("worker-01-01234567"))
+		Expect(registration.ResolveHostName("{{.ProductUUID | lower}}", data)).To(Equal("4c4c4544-0042-4a10-8052-b4c04f4e4d32"))
+		Expect(registration.ResolveHostName("{{.Hostname | replace \".\" \"-\"}}", data)).To(Equal("worker-01-site-a-example-com"))
+	})
+
+	It("should reject invalid templates", func() {
+		_, err := registration.ResolveHostName("{{.Hostname", data)
+		Expect(err).To(MatchError(ContainSubstring("invalid host name template")))
+		_, err = registration.ResolveHostName("{{.Unknown}}", data)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject a template resolving to an empty name", func() {
+		data = registration.NewHostNameData("worker", nil)
+		_, err := registration.ResolveHostName("{{.MachineID}}", data)
+		Expect(err).To(MatchError(ContainSubstring("is invalid")))
+	})
+
+	DescribeTable("should normalize host names to DNS-1123 subdomains",
+		func(name, expected string) {
+			Expect(registration.NormalizeHostName(name)).To(Equal(expected))
+		},
+		Entry("uppercase letters", "WORKER-01", "worker-01"),
+		Entry("invalid characters", "worker_01 (rack 3)", "worker-01--rack-3"),
+		Entry("leading and trailing dashes of the labels", "-worker-.-site-.", "worker.site"),
+		Entry("empty labels", "worker..example.com.", "worker.example.com"),
+		Entry("long names", strings.Repeat("a", 300), strings.Repeat("a", 253)),
+	)
+
+	It("should expose the name of the host to the bootstrap templates", func() {
+		hr := &registration.HostRegistrar{ByoHostInfo: registration.HostInfo{HostName: "worker-01-01234567"}}
+		Expect(hr.ParseTemplate("name: {{.HostName}}")).To(Equal("name: worker-01-01234567"))
+	})
+})
@@ -5,20 +5,26 @@ package registration
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 	"net"
 	"os"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/jackpal/gateway"
 	"github.com/pkg/errors"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/cloudinit"
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/encryption"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	klog "k8s.io/klog/v2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/patch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -28,23 +34,57 @@ var (
 	LocalHostRegistrar *HostRegistrar
 )
 
-// HostInfo contains information about the host network interface.
+// HostInfo contains information about the host network interface and the name of the host,
+// it is the data of the bootstrap templates.
 type HostInfo struct {
 	DefaultNetworkInterfaceName string
+	// HostName is the name of the ByoHost, to be used as the kubeadm node name
+	HostName string
 }
 
 // HostRegistrar used to register a host.
 type HostRegistrar struct {
 	K8sClient   client.Client
 	ByoHostInfo HostInfo
+	// EncryptionKey is the private key of the host, its public key is published
+	// in the ByoHost status to receive encrypted bootstrap data
+	EncryptionKey *rsa.PrivateKey
+	// HostIdentity identifies the machine of the host, it is recorded in the ByoHost status
+	HostIdentity *infrastructurev1beta1.HostIdentity
+
+	// namespace is the namespace the host is registered in, it changes when an operator moves the host
+	namespace string
+	// mu guards ByoHostInfo, which is refreshed when the network changes and on registration, and namespace
+	mu sync.RWMutex
+}
+
+// DefaultNetworkInterface returns the name of the network interface of the default route
+func (hr *HostRegistrar) DefaultNetworkInterface() string {
+	hr.mu.RLock()
+	defer hr.mu.RUnlock()
+	return hr.ByoHostInfo.DefaultNetworkInterfaceName
+}
+
+// ParseTemplate implements cloudinit.ITemplateParser, it parses the template
+// content with the current HostInfo, e.g. {{.DefaultNetworkInterfaceName}} or {{.HostName}}
+func (hr *HostRegistrar) ParseTemplate(templateContent string) (string, error) {
+	hr.mu.RLock()
+	hostInfo := hr.ByoHostInfo
+	hr.mu.RUnlock()
+	return cloudinit.TemplateParser{Template: hostInfo}.ParseTemplate(templateContent)
 }
 
 // Register is called on agent startup
 // This function registers the byohost as available capacity in the management cluster
 // If the CR is already present, we consider this to be a restart / reboot of the agent process
+// and the labels, network and platform details are re-synced
 func (hr *HostRegistrar) Register(hostName, namespace string, hostLabels map[string]string) error {
 	klog.Info("Registering ByoHost")
 	ctx := context.TODO()
+	hr.mu.Lock()
+	hr.ByoHostInfo.HostName = hostName
+	hr.namespace = namespace
+	hr.mu.Unlock()
 	byoHost := &infrastructurev1beta1.ByoHost{}
 	err := hr.K8sClient.Get(ctx, types.NamespacedName{Name: hostName, Namespace: namespace}, byoHost)
 	if err != nil {
@@ -60,11 +100,11 @@ func (hr *HostRegistrar) Register(hostName, namespace string, hostLabels map[str
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      hostName,
 				Namespace: namespace,
-				Labels:    hostLabels,
 			},
 			Spec:   infrastructurev1beta1.ByoHostSpec{},
 			Status: infrastructurev1beta1.ByoHostStatus{},
 		}
+		applyManagedLabels(byoHost, hostLabels)
 		err = hr.K8sClient.Create(ctx, byoHost)
 		if err != nil {
 			klog.Errorf("error creating host %s in namespace %s, err=%v", hostName, namespace, err)
@@ -73,17 +113,21 @@ func (hr *HostRegistrar) Register(hostName, namespace string, hostLabels map[str
 	}
 
 	// run it at startup or reboot
-	return hr.UpdateHost(ctx, byoHost)
+	return hr.UpdateHost(ctx, byoHost, hostLabels)
 }
 
-// UpdateHost updates the network interface and host platform details status for the host
-func (hr *HostRegistrar) UpdateHost(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
-	klog.Info("Add Network Info")
+// UpdateHost updates the labels, the network interface, the host platform details, the encryption public key
+// and the identity status for the host
+func (hr *HostRegistrar) UpdateHost(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost, hostLabels map[string]string) error {
 	helper, err := patch.NewHelper(byoHost, hr.K8sClient)
 	if err != nil {
 		return err
 	}
 
+	klog.Info("Sync ByoHost labels")
+	applyManagedLabels(byoHost, hostLabels)
+
+	klog.Info("Add Network Info")
 	byoHost.Status.Network = hr.GetNetworkStatus()
 
 	klog.Info("Attach Host Platform details")
@@ -91,9 +135,97 @@ func (hr *HostRegistrar) UpdateHost(ctx context.Context, byoHost *infrastructure
 		return err
 	}
 
+	if hr.EncryptionKey != nil {
+		if byoHost.Status.EncryptionPublicKey, err = encryption.EncodePublicKey(hr.EncryptionKey); err != nil {
+			return err
+		}
+	}
+
+	if hr.HostIdentity != nil {
+		byoHost.Status.HostIdentity = hr.HostIdentity.DeepCopy()
+	}
+
+	if err = helper.Patch(ctx, byoHost); err != nil {
+		return err
+	}
+	return hr.removeIdentityAcceptance(ctx, byoHost)
+}
+
+// removeIdentityAcceptance removes the AcceptHostIdentityAnnotation once the identity of the host
+// is recorded, so that a later change of identity has to be accepted again
+func (hr *HostRegistrar) removeIdentityAcceptance(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	if _, ok := byoHost.Annotations[infrastructurev1beta1.AcceptHostIdentityAnnotation]; !ok {
+		return nil
+	}
+	klog.Info("Host identity accepted")
+	helper, err := patch.NewHelper(byoHost, hr.K8sClient)
+	if err != nil {
+		return err
+	}
+	delete(byoHost.Annotations, infrastructurev1beta1.AcceptHostIdentityAnnotation)
+	return helper.Patch(ctx, byoHost)
+}
+
+// UpdateLabels applies the labels the agent manages to the ByoHost,
+// see applyManagedLabels
+func (hr *HostRegistrar) UpdateLabels(ctx context.Context, hostName, namespace string, hostLabels map[string]string) error {
+	klog.Info("Updating ByoHost labels")
+	byoHost := &infrastructurev1beta1.ByoHost{}
+	err := hr.K8sClient.Get(ctx, types.NamespacedName{Name: hostName, Namespace: namespace}, byoHost)
+	if err != nil {
+		return err
+	}
+	helper, err := patch.NewHelper(byoHost, hr.K8sClient)
+	if err != nil {
+		return err
+	}
+
+	applyManagedLabels(byoHost, hostLabels)
 	return helper.Patch(ctx, byoHost)
 }
 
+// applyManagedLabels sets hostLabels on the ByoHost and records their keys in the
+// ManagedLabelsAnnotation. Labels the agent managed before that are no longer in
+// hostLabels are removed. Labels set by users or controllers, and the labels the
+// controllers use to attach the host, are left untouched.
+func applyManagedLabels(byoHost *infrastructurev1beta1.ByoHost, hostLabels map[string]string) {
+	if byoHost.Labels == nil {
+		byoHost.Labels = make(map[string]string)
+	}
+	if byoHost.Annotations == nil {
+		byoHost.Annotations = make(map[string]string)
+	}
+
+	for _, key := range strings.Split(byoHost.Annotations[infrastructurev1beta1.ManagedLabelsAnnotation], ",") {
+		if _, ok := hostLabels[key]; !ok && !isReservedLabel(key) {
+			delete(byoHost.Labels, key)
+		}
+	}
+
+	managed := make([]string, 0, len(hostLabels))
+	for key, value := range hostLabels {
+		if isReservedLabel(key) {
+			klog.Infof("ignoring label %s, it is managed by the BYOH controllers", key)
+			continue
+		}
+		byoHost.Labels[key] = value
+		managed = append(managed, key)
+	}
+	sort.Strings(managed)
+
+	if len(managed) == 0 {
+		delete(byoHost.Annotations, infrastructurev1beta1.ManagedLabelsAnnotation)
+	} else {
+		byoHost.Annotations[infrastructurev1beta1.ManagedLabelsAnnotation] = strings.Join(managed, ",")
+	}
+}
+
+// isReservedLabel returns true for the labels the controllers set when attaching the host
+func isReservedLabel(key string) bool {
+	return key == "" || key == clusterv1.ClusterNameLabel || key == infrastructurev1beta1.AttachedByoMachineLabel ||
+		key == infrastructurev1beta1.LoadBalancerHostLabel
+}
+
 // GetNetworkStatus returns the network interface(s) status for the host
 func (hr *HostRegistrar) GetNetworkStatus() []infrastructurev1beta1.NetworkStatus {
 	Network := make([]infrastructurev1beta1.NetworkStatus, 0)
@@ -132,7 +264,9 @@ func (hr *HostRegistrar) GetNetworkStatus() []infrastructurev1beta1.NetworkStatu
 			}
 			if ip.String() == defaultIP.String() {
 				netStatus.IsDefault = true
+				hr.mu.Lock()
 				hr.ByoHostInfo.DefaultNetworkInterfaceName = netStatus.NetworkInterfaceName
+				hr.mu.Unlock()
 			}
 			netStatus.IPAddrs = append(netStatus.IPAddrs, addr.String())
 		}
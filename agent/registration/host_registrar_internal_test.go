@@ -9,6 +9,8 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
 func getMockFile(targetOs string) ([]byte, error) {
@@ -70,4 +72,52 @@ var _ = Describe("Host Registrar Tests", func() {
 			Expect(detectedOS).To(Equal("Unknown"))
 		})
 	})
+	Context("When the managed labels are applied", func() {
+		var byoHost *infrastructurev1beta1.ByoHost
+
+		BeforeEach(func() {
+			byoHost = &infrastructurev1beta1.ByoHost{}
+			byoHost.Labels = map[string]string{
+				"site":                     "apac",
+				"rack":                     "r1",
+				"owner":                    "team-a",
+				clusterv1.ClusterNameLabel: "test-cluster",
+				infrastructurev1beta1.AttachedByoMachineLabel: "test-machine",
+			}
+			byoHost.Annotations = map[string]string{infrastructurev1beta1.ManagedLabelsAnnotation: "rack,site"}
+		})
+
+		It("Should add, update and remove only the labels managed by the agent", func() {
+			applyManagedLabels(byoHost, map[string]string{"site": "emea", "zone": "z1"})
+			Expect(byoHost.Labels).To(Equal(map[string]string{
+				"site":                     "emea",
+				"zone":                     "z1",
+				"owner":                    "team-a",
+				clusterv1.ClusterNameLabel: "test-cluster",
+				infrastructurev1beta1.AttachedByoMachineLabel: "test-machine",
+			}))
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.ManagedLabelsAnnotation, "site,zone"))
+		})
+
+		It("Should take over a label set by someone else", func() {
+			applyManagedLabels(byoHost, map[string]string{"owner": "team-b"})
+			Expect(byoHost.Labels).To(HaveKeyWithValue("owner", "team-b"))
+			Expect(byoHost.Labels).NotTo(HaveKey("site"))
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.ManagedLabelsAnnotation, "owner"))
+		})
+
+		It("Should never manage the labels of the controllers", func() {
+			applyManagedLabels(byoHost, map[string]string{clusterv1.ClusterNameLabel: "other-cluster"})
+			Expect(byoHost.Labels).To(HaveKeyWithValue(clusterv1.ClusterNameLabel, "test-cluster"))
+			Expect(byoHost.Labels).To(HaveKeyWithValue(infrastructurev1beta1.AttachedByoMachineLabel, "test-machine"))
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.ManagedLabelsAnnotation))
+		})
+
+		It("Should initialize the labels and annotations of a new ByoHost", func() {
+			byoHost = &infrastructurev1beta1.ByoHost{}
+			applyManagedLabels(byoHost, map[string]string{"site": "apac"})
+			Expect(byoHost.Labels).To(Equal(map[string]string{"site": "apac"}))
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.ManagedLabelsAnnotation, "site"))
+		})
+	})
 })
@@ -5,12 +5,19 @@ package registration_test
 
 import (
 	"context"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/agent/registration"
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/encryption"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/builder"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ = Describe("Host Registrar Tests", func() {
@@ -33,7 +40,104 @@ var _ = Describe("Host Registrar Tests", func() {
 
 	Context("When a ByoHost exists and registration is done", func() {
 		It("Should update the host details on the byohost successfully", func() {
-			Expect(hr.UpdateHost(ctx, byoHost)).ToNot(HaveOccurred())
+			Expect(hr.UpdateHost(ctx, byoHost, nil)).ToNot(HaveOccurred())
+		})
+
+		It("Should publish the encryption public key of the host", func() {
+			encryptionKey, err := encryption.GenerateKey()
+			Expect(err).ToNot(HaveOccurred())
+			hr.EncryptionKey = encryptionKey
+			Expect(hr.Register(byoHost.Name, defaultNamespace, nil)).To(Succeed())
+
+			updatedByoHost := &infrastructurev1beta1.ByoHost{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), updatedByoHost)).To(Succeed())
+			publicKey, err := encryption.ParsePublicKey(updatedByoHost.Status.EncryptionPublicKey)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(publicKey.Equal(&encryptionKey.PublicKey)).To(BeTrue())
+		})
+
+		It("Should record the identity of the host and consume its acceptance", func() {
+			hr.HostIdentity = &infrastructurev1beta1.HostIdentity{MachineID: "0123456789abcdef0123456789abcdef"}
+			acceptedByoHost := &infrastructurev1beta1.ByoHost{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), acceptedByoHost)).To(Succeed())
+			acceptedByoHost.Annotations = map[string]string{infrastructurev1beta1.AcceptHostIdentityAnnotation: ""}
+			Expect(k8sClient.Update(ctx, acceptedByoHost)).To(Succeed())
+
+			Expect(hr.Register(byoHost.Name, defaultNamespace, nil)).To(Succeed())
+
+			updatedByoHost := &infrastructurev1beta1.ByoHost{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), updatedByoHost)).To(Succeed())
+			Expect(updatedByoHost.Status.HostIdentity).To(Equal(hr.HostIdentity))
+			Expect(updatedByoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.AcceptHostIdentityAnnotation))
+		})
+
+		It("Should re-sync the labels managed by the agent on restart", func() {
+			Expect(hr.Register(byoHost.Name, defaultNamespace, map[string]string{"site": "apac", "rack": "r1"})).To(Succeed())
+
+			// labels set by users and controllers in the meantime
+			createdByoHost := &infrastructurev1beta1.ByoHost{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), createdByoHost)).To(Succeed())
+			createdByoHost.Labels["owner"] = "team-a"
+			createdByoHost.Labels[clusterv1.ClusterNameLabel] = "test-cluster"
+			Expect(k8sClient.Update(ctx, createdByoHost)).To(Succeed())
+
+			Expect(hr.Register(byoHost.Name, defaultNamespace, map[string]string{"site": "emea"})).To(Succeed())
+
+			updatedByoHost := &infrastructurev1beta1.ByoHost{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), updatedByoHost)).To(Succeed())
+			Expect(updatedByoHost.Labels).To(Equal(map[string]string{
+				"site":                     "emea",
+				"owner":                    "team-a",
+				clusterv1.ClusterNameLabel: "test-cluster",
+			}))
+			Expect(updatedByoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.ManagedLabelsAnnotation, "site"))
+			Expect(updatedByoHost.Status.HostDetails.OSName).NotTo(BeEmpty())
+		})
+	})
+
+	Context("When an operator moves the host to another namespace", func() {
+		var tenantNamespace *corev1.Namespace
+
+		BeforeEach(func() {
+			registration.ConfigPath = filepath.Join(GinkgoT().TempDir(), "config")
+			tenantNamespace = builder.Namespace("tenant-a").Build()
+			Expect(k8sClient.Create(ctx, tenantNamespace)).Should(Succeed())
+			Expect(hr.Register(byoHost.Name, defaultNamespace, map[string]string{"site": "apac"})).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), byoHost)).To(Succeed())
+			byoHost.Annotations[infrastructurev1beta1.MoveToNamespaceAnnotation] = tenantNamespace.Name
+			Expect(k8sClient.Update(ctx, byoHost)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			registration.ConfigPath = ""
+			// re-create the ByoHost deleted by the move for the cleanup
+			recreatedByoHost := builder.ByoHost(defaultNamespace, "host").Build()
+			recreatedByoHost.Name = byoHost.Name
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, recreatedByoHost))).Should(Succeed())
+		})
+
+		It("Should register the host in the namespace and delete its previous ByoHost", func() {
+			Expect(hr.MoveToNamespace(ctx, byoHost, tenantNamespace.Name)).To(Succeed())
+
+			movedByoHost := &infrastructurev1beta1.ByoHost{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: byoHost.Name, Namespace: tenantNamespace.Name}, movedByoHost)).To(Succeed())
+			Expect(movedByoHost.Labels).To(Equal(map[string]string{"site": "apac"}))
+			Expect(movedByoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.MoveToNamespaceAnnotation))
+			Expect(movedByoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.MovedFromNamespaceAnnotation, defaultNamespace))
+			Expect(movedByoHost.Status.HostDetails.OSName).NotTo(BeEmpty())
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), &infrastructurev1beta1.ByoHost{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			Expect(hr.Namespace()).To(Equal(tenantNamespace.Name))
+			Expect(registration.LoadMovedNamespace()).To(Equal(tenantNamespace.Name))
+			Expect(k8sClient.Delete(ctx, movedByoHost)).To(Succeed())
+		})
+
+		It("Should not move an attached host", func() {
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Name: "machine1", Namespace: defaultNamespace}
+			Expect(hr.MoveToNamespace(ctx, byoHost, tenantNamespace.Name)).NotTo(Succeed())
+			Expect(hr.Namespace()).To(Equal(defaultNamespace))
+			Expect(registration.LoadMovedNamespace()).To(BeEmpty())
 		})
 	})
 })
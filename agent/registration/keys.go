@@ -0,0 +1,125 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/util/keyutil"
+)
+
+const (
+	// KeyAlgorithmRSA generates KeySize bits RSA keys for the client certificates of the host
+	KeyAlgorithmRSA = "RSA"
+	// KeyAlgorithmECDSA generates P-256 ECDSA keys for the client certificates of the host
+	KeyAlgorithmECDSA = "ECDSA"
+	// ClientKeyFile is the file of the private key of the client certificate of the host, in the key directory
+	ClientKeyFile = "byoh-client.key"
+	// ClientCertFile is the file of the client certificate of the host, in the key directory
+	ClientCertFile = "byoh-client.crt"
+)
+
+// KeyDir is the directory of the keys and certificates of the host,
+// defaults to the directory of the BYOH kubeconfig
+var KeyDir string
+
+// GetKeyDir returns the directory of the keys and certificates of the host
+func GetKeyDir() string {
+	if KeyDir != "" {
+		return KeyDir
+	}
+	return filepath.Dir(GetBYOHConfigPath())
+}
+
+// GetClientKeyPath returns the path of the private key of the client certificate of the host
+func GetClientKeyPath() string {
+	return filepath.Join(GetKeyDir(), ClientKeyFile)
+}
+
+// GetClientCertPath returns the path of the client certificate of the host
+func GetClientCertPath() string {
+	return filepath.Join(GetKeyDir(), ClientCertFile)
+}
+
+// getTmpPrivateKeyPath returns the path of the private key of a pending certificate request
+func getTmpPrivateKeyPath() string {
+	return filepath.Join(GetKeyDir(), TmpPrivateKey)
+}
+
+// generatePrivateKeyPEM returns a new PEM encoded private key of the algorithm, RSA if empty
+func generatePrivateKeyPEM(algorithm string) ([]byte, error) {
+	switch algorithm {
+	case "", KeyAlgorithmRSA:
+		privateKey, err := rsa.GenerateKey(rand.Reader, KeySize)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: keyutil.RSAPrivateKeyBlockType, Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}), nil
+	case KeyAlgorithmECDSA:
+		return keyutil.MakeEllipticPrivateKeyPEM()
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %q, expected %s or %s", algorithm, KeyAlgorithmRSA, KeyAlgorithmECDSA)
+	}
+}
+
+// loadOrGenerateKeyFile returns the PEM encoded private key at path, generating
+// a new key of the algorithm if the file does not exist
+func loadOrGenerateKeyFile(path, algorithm string) ([]byte, error) {
+	keyData, err := os.ReadFile(path)
+	if err == nil {
+		return keyData, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error loading key from %s: %v", path, err)
+	}
+	if keyData, err = generatePrivateKeyPEM(algorithm); err != nil {
+		return nil, err
+	}
+	if err = writePrivateFile(path, keyData); err != nil {
+		return nil, err
+	}
+	return keyData, nil
+}
+
+// writeClientCertificate stores the client certificate and its private key in the key directory,
+// and returns their paths
+func writeClientCertificate(certData, keyData []byte) (certPath, keyPath string, err error) {
+	certPath, keyPath = GetClientCertPath(), GetClientKeyPath()
+	if err = writePrivateFile(keyPath, keyData); err != nil {
+		return "", "", err
+	}
+	if err = writePrivateFile(certPath, certData); err != nil {
+		return "", "", err
+	}
+	return certPath, keyPath, nil
+}
+
+// writePrivateFile atomically replaces the file at path with a 0600 file holding data.
+// The parent directory is created with 0700 permissions if it does not exist.
+func writePrivateFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil { //nolint: gomnd
+		return err
+	}
+	// CreateTemp creates the file with 0600 permissions
+	tmpFile, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err = tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
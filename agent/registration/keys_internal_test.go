@@ -0,0 +1,83 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/util/keyutil"
+)
+
+var _ = Describe("Keys", func() {
+	Context("When generatePrivateKeyPEM is called", func() {
+		It("should generate an RSA key by default", func() {
+			for _, algorithm := range []string{"", KeyAlgorithmRSA} {
+				keyData, err := generatePrivateKeyPEM(algorithm)
+				Expect(err).NotTo(HaveOccurred())
+				key, err := keyutil.ParsePrivateKeyPEM(keyData)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).To(BeAssignableToTypeOf(&rsa.PrivateKey{}))
+				Expect(key.(*rsa.PrivateKey).N.BitLen()).To(Equal(KeySize))
+			}
+		})
+
+		It("should generate an ECDSA key", func() {
+			keyData, err := generatePrivateKeyPEM(KeyAlgorithmECDSA)
+			Expect(err).NotTo(HaveOccurred())
+			key, err := keyutil.ParsePrivateKeyPEM(keyData)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(BeAssignableToTypeOf(&ecdsa.PrivateKey{}))
+		})
+
+		It("should return error if the algorithm is not supported", func() {
+			_, err := generatePrivateKeyPEM("DSA")
+			Expect(err).To(MatchError(`unsupported key algorithm "DSA", expected RSA or ECDSA`))
+		})
+	})
+
+	Context("When the keys are stored", func() {
+		BeforeEach(func() {
+			KeyDir = filepath.Join(GinkgoT().TempDir(), "pki")
+		})
+
+		AfterEach(func() {
+			KeyDir = ""
+		})
+
+		It("should store the files with 0600 permissions in a 0700 key directory", func() {
+			certPath, keyPath, err := writeClientCertificate([]byte("cert-data"), []byte("key-data"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(certPath).To(Equal(filepath.Join(KeyDir, ClientCertFile)))
+			Expect(keyPath).To(Equal(filepath.Join(KeyDir, ClientKeyFile)))
+			for _, path := range []string{certPath, keyPath} {
+				info, err := os.Stat(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+			}
+			info, err := os.Stat(KeyDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o700)))
+
+			// rotation replaces the files
+			_, _, err = writeClientCertificate([]byte("renewed-cert-data"), []byte("renewed-key-data"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.ReadFile(keyPath)).To(Equal([]byte("renewed-key-data")))
+			entries, err := os.ReadDir(KeyDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+		})
+
+		It("should reuse the pending private key", func() {
+			keyData, err := loadOrGenerateKeyFile(getTmpPrivateKeyPath(), KeyAlgorithmECDSA)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getTmpPrivateKeyPath()).To(Equal(filepath.Join(KeyDir, TmpPrivateKey)))
+			Expect(loadOrGenerateKeyFile(getTmpPrivateKeyPath(), KeyAlgorithmRSA)).To(Equal(keyData))
+		})
+	})
+})
@@ -0,0 +1,122 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/cluster-api/util/patch"
+)
+
+// NamespaceFile records the namespace an operator moved the host to, next to the host kubeconfig
+const NamespaceFile = "namespace"
+
+// GetNamespacePath returns the path of the file recording the namespace the host was moved to
+func GetNamespacePath() string {
+	return filepath.Join(filepath.Dir(GetBYOHConfigPath()), NamespaceFile)
+}
+
+// LoadMovedNamespace returns the namespace an operator moved the host to, empty if the host was not moved
+func LoadMovedNamespace() (string, error) {
+	data, err := os.ReadFile(GetNamespacePath())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading the namespace of the host: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// RemoveMovedNamespace forgets the namespace the host was moved to, e.g. when it is deregistered
+func RemoveMovedNamespace() error {
+	if err := os.Remove(GetNamespacePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Namespace returns the namespace the host is registered in
+func (hr *HostRegistrar) Namespace() string {
+	hr.mu.RLock()
+	defer hr.mu.RUnlock()
+	return hr.namespace
+}
+
+// MoveToNamespace moves the idle host to the namespace an operator set in the MoveToNamespaceAnnotation
+// of its ByoHost. The host is registered in the namespace with the labels it manages, the namespace is
+// recorded so that the agent keeps registering the host there, and byoHost is deleted.
+func (hr *HostRegistrar) MoveToNamespace(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost, namespace string) error {
+	if byoHost.Status.MachineRef != nil {
+		return fmt.Errorf("ByoHost %s/%s is attached to %s %s/%s", byoHost.Namespace, byoHost.Name,
+			byoHost.Status.MachineRef.Kind, byoHost.Status.MachineRef.Namespace, byoHost.Status.MachineRef.Name)
+	}
+	klog.Infof("Moving ByoHost %s from namespace %s to %s", byoHost.Name, byoHost.Namespace, namespace)
+
+	hostLabels := make(map[string]string)
+	for _, key := range strings.Split(byoHost.Annotations[infrastructurev1beta1.ManagedLabelsAnnotation], ",") {
+		if value, ok := byoHost.Labels[key]; ok && !isReservedLabel(key) {
+			hostLabels[key] = value
+		}
+	}
+	movedByoHost := &infrastructurev1beta1.ByoHost{}
+	err := hr.K8sClient.Get(ctx, types.NamespacedName{Name: byoHost.Name, Namespace: namespace}, movedByoHost)
+	if apierrors.IsNotFound(err) {
+		movedByoHost = &infrastructurev1beta1.ByoHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        byoHost.Name,
+				Namespace:   namespace,
+				Annotations: map[string]string{infrastructurev1beta1.MovedFromNamespaceAnnotation: byoHost.Namespace},
+			},
+		}
+		applyManagedLabels(movedByoHost, hostLabels)
+		err = hr.K8sClient.Create(ctx, movedByoHost)
+	}
+	if err == nil {
+		err = hr.recordMovedFrom(ctx, movedByoHost, byoHost.Namespace)
+	}
+	if err != nil {
+		return fmt.Errorf("error registering host %s in namespace %s: %v", byoHost.Name, namespace, err)
+	}
+	if err = hr.UpdateHost(ctx, movedByoHost, hostLabels); err != nil {
+		return err
+	}
+
+	if err = writePrivateFile(GetNamespacePath(), []byte(namespace)); err != nil {
+		return fmt.Errorf("error recording the namespace of the host: %v", err)
+	}
+	if err = hr.K8sClient.Delete(ctx, byoHost); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting ByoHost %s/%s: %v", byoHost.Namespace, byoHost.Name, err)
+	}
+	hr.mu.Lock()
+	hr.namespace = namespace
+	hr.mu.Unlock()
+	return nil
+}
+
+// recordMovedFrom sets the MovedFromNamespaceAnnotation on the ByoHost the host is moved to, which
+// keeps the host allowed in its namespace once the ByoHost it was moved from is deleted
+func (hr *HostRegistrar) recordMovedFrom(ctx context.Context, movedByoHost *infrastructurev1beta1.ByoHost, namespace string) error {
+	if movedByoHost.Annotations[infrastructurev1beta1.MovedFromNamespaceAnnotation] == namespace {
+		return nil
+	}
+	helper, err := patch.NewHelper(movedByoHost, hr.K8sClient)
+	if err != nil {
+		return err
+	}
+	if movedByoHost.Annotations == nil {
+		movedByoHost.Annotations = make(map[string]string)
+	}
+	movedByoHost.Annotations[infrastructurev1beta1.MovedFromNamespaceAnnotation] = namespace
+	return helper.Patch(ctx, movedByoHost)
+}
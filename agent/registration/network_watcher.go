@@ -0,0 +1,150 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+)
+
+const (
+	// DefaultNetworkResyncPeriod is how often the network status is refreshed
+	// when no link or address change is notified
+	DefaultNetworkResyncPeriod = 5 * time.Minute
+
+	// NodeIPChangedReason is the reason of the event raised when an IP address
+	// of the default network interface of a bootstrapped host goes away
+	NodeIPChangedReason = "NodeIPChanged"
+
+	// networkChangeDebounce groups the bursts of netlink notifications,
+	// e.g. on DHCP renewal, into a single refresh
+	networkChangeDebounce = 2 * time.Second
+)
+
+// NetworkWatcher keeps the network status of the ByoHost up to date. It
+// refreshes the status when links or addresses change and every ResyncPeriod.
+type NetworkWatcher struct {
+	Registrar    *HostRegistrar
+	HostName     string
+	Recorder     record.EventRecorder
+	ResyncPeriod time.Duration
+}
+
+// Start implements manager.Runnable, it watches the network until ctx is done
+func (w *NetworkWatcher) Start(ctx context.Context) error {
+	changes := make(chan struct{}, 1)
+	if err := subscribeNetworkChanges(ctx, changes); err != nil {
+		klog.Errorf("unable to watch the network changes, the network status is only refreshed every %s: %v", w.ResyncPeriod, err)
+	}
+
+	ticker := time.NewTicker(w.ResyncPeriod)
+	defer ticker.Stop()
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+			if debounce == nil {
+				debounce = time.After(networkChangeDebounce)
+			}
+			continue
+		case <-debounce:
+			debounce = nil
+		case <-ticker.C:
+		}
+		if err := w.refresh(ctx); err != nil {
+			klog.Errorf("error refreshing the network status of host %s: %v", w.HostName, err)
+		}
+	}
+}
+
+// refresh patches the network status of the ByoHost if it changed
+func (w *NetworkWatcher) refresh(ctx context.Context) error {
+	byoHost := &infrastructurev1beta1.ByoHost{}
+	err := w.Registrar.K8sClient.Get(ctx, types.NamespacedName{Name: w.HostName, Namespace: w.Registrar.Namespace()}, byoHost)
+	if err != nil {
+		return err
+	}
+
+	network := w.Registrar.GetNetworkStatus()
+	if reflect.DeepEqual(network, byoHost.Status.Network) {
+		return nil
+	}
+	klog.Info("Network status changed, updating ByoHost")
+	w.checkNodeIP(byoHost, network)
+
+	helper, err := patch.NewHelper(byoHost, w.Registrar.K8sClient)
+	if err != nil {
+		return err
+	}
+	byoHost.Status.Network = network
+	return helper.Patch(ctx, byoHost)
+}
+
+// checkNodeIP raises a warning event if an IP address of the default network
+// interface, that the Kubernetes node running on the host may use, went away
+func (w *NetworkWatcher) checkNodeIP(byoHost *infrastructurev1beta1.ByoHost, network []infrastructurev1beta1.NetworkStatus) {
+	if byoHost.Status.MachineRef == nil || !conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded) {
+		return
+	}
+	previousIPs := defaultInterfaceIPs(byoHost.Status.Network)
+	currentIPs := defaultInterfaceIPs(network)
+	// the control plane endpoint moves between the control plane hosts
+	endpointIP := byoHost.Annotations[infrastructurev1beta1.EndPointIPAnnotation]
+
+	for ip := range previousIPs {
+		if currentIPs[ip] || ip == endpointIP {
+			continue
+		}
+		current := make([]string, 0, len(currentIPs))
+		for currentIP := range currentIPs {
+			current = append(current, currentIP)
+		}
+		sort.Strings(current)
+		w.Recorder.Eventf(byoHost, corev1.EventTypeWarning, NodeIPChangedReason,
+			"IP %s of the default network interface is gone (current IPs: %s), the node of %s %s may no longer be reachable",
+			ip, strings.Join(current, ","), byoHost.Status.MachineRef.Kind, byoHost.Status.MachineRef.Name)
+	}
+}
+
+// defaultInterfaceIPs returns the IP addresses, without prefix length, of the default network interface
+func defaultInterfaceIPs(network []infrastructurev1beta1.NetworkStatus) map[string]bool {
+	ips := make(map[string]bool)
+	for _, status := range network {
+		if !status.IsDefault {
+			continue
+		}
+		for _, addr := range status.IPAddrs {
+			ip, _, err := net.ParseCIDR(addr)
+			if err != nil {
+				ips[addr] = true
+				continue
+			}
+			ips[ip.String()] = true
+		}
+	}
+	return ips
+}
+
+// notifyNetworkChange signals a change without blocking, a pending
+// notification already covers the new change
+func notifyNetworkChange(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
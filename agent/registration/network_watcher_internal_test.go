@@ -0,0 +1,69 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/cluster-api/util/conditions"
+)
+
+var _ = Describe("Network watcher", func() {
+	var (
+		recorder *record.FakeRecorder
+		watcher  *NetworkWatcher
+		byoHost  *infrastructurev1beta1.ByoHost
+	)
+
+	networkWith := func(defaultIPs ...string) []infrastructurev1beta1.NetworkStatus {
+		return []infrastructurev1beta1.NetworkStatus{
+			{NetworkInterfaceName: "lo", IPAddrs: []string{"127.0.0.1/8"}},
+			{NetworkInterfaceName: "eth0", IsDefault: true, IPAddrs: defaultIPs},
+		}
+	}
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		watcher = &NetworkWatcher{Recorder: recorder}
+		byoHost = &infrastructurev1beta1.ByoHost{}
+		byoHost.Status.Network = networkWith("10.0.0.5/24", "10.0.0.100/32")
+		byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Name: "test-machine"}
+		conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+	})
+
+	It("should raise a warning event when the node IP goes away", func() {
+		watcher.checkNodeIP(byoHost, networkWith("10.0.0.7/24", "10.0.0.100/32"))
+		Expect(recorder.Events).To(Receive(And(
+			ContainSubstring(corev1.EventTypeWarning),
+			ContainSubstring(NodeIPChangedReason),
+			ContainSubstring("IP 10.0.0.5 of the default network interface is gone (current IPs: 10.0.0.100,10.0.0.7)"),
+		)))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should ignore the control plane endpoint IP", func() {
+		byoHost.Annotations = map[string]string{infrastructurev1beta1.EndPointIPAnnotation: "10.0.0.100"}
+		watcher.checkNodeIP(byoHost, networkWith("10.0.0.5/24"))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should not raise an event for a host that is not a node", func() {
+		byoHost.Status.MachineRef = nil
+		watcher.checkNodeIP(byoHost, networkWith("10.0.0.7/24"))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should not raise an event when an address is added", func() {
+		watcher.checkNodeIP(byoHost, networkWith("10.0.0.5/24", "10.0.0.100/32", "fd00::5/64"))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("should parse templates with the current default network interface", func() {
+		hr := &HostRegistrar{ByoHostInfo: HostInfo{DefaultNetworkInterfaceName: "eth1"}}
+		Expect(hr.ParseTemplate("interface: {{.DefaultNetworkInterfaceName}}")).To(Equal("interface: eth1"))
+	})
+})
@@ -0,0 +1,45 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package registration
+
+import (
+	"context"
+
+	"github.com/vishvananda/netlink"
+	klog "k8s.io/klog/v2"
+)
+
+// subscribeNetworkChanges notifies changes when a link or an address of the host changes
+func subscribeNetworkChanges(ctx context.Context, changes chan<- struct{}) error {
+	links := make(chan netlink.LinkUpdate)
+	if err := netlink.LinkSubscribe(links, ctx.Done()); err != nil {
+		return err
+	}
+	addrs := make(chan netlink.AddrUpdate)
+	if err := netlink.AddrSubscribe(addrs, ctx.Done()); err != nil {
+		return err
+	}
+
+	go func() {
+		for update := range links {
+			klog.V(4).Infof("link %s changed", update.Attrs().Name)
+			notifyNetworkChange(changes)
+		}
+		if ctx.Err() == nil {
+			klog.Error("netlink link subscription closed, the network status is only refreshed periodically")
+		}
+	}()
+	go func() {
+		for update := range addrs {
+			klog.V(4).Infof("address %s changed", update.LinkAddress.String())
+			notifyNetworkChange(changes)
+		}
+		if ctx.Err() == nil {
+			klog.Error("netlink address subscription closed, the network status is only refreshed periodically")
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,16 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package registration
+
+import (
+	"context"
+	"errors"
+)
+
+// subscribeNetworkChanges is only supported on linux, where the agent runs
+func subscribeNetworkChanges(_ context.Context, _ chan<- struct{}) error {
+	return errors.New("network change notifications are only supported on linux")
+}
@@ -4,7 +4,11 @@
 package v1beta1
 
 import (
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
 const (
@@ -14,7 +18,8 @@ const (
 	// DefaultContext is the context name used in the generated bootstrap-kubeconfig
 	DefaultContext = "default-context"
 
-	// DefaultNamespace is the namespace used in the generated bootstrap-kubeconfig
+	// DefaultNamespace is the namespace used in the generated bootstrap-kubeconfig when the
+	// BootstrapKubeconfig has neither a TargetNamespace nor a namespace
 	DefaultNamespace = "default"
 
 	// DefaultAuth is the auth in the generated bootstrap-kubeconfig
@@ -25,6 +30,27 @@ const (
 
 	// BootstrapTokenExtraGroups is the byoh group that has access to create CertificateSigningRequest
 	BootstrapTokenExtraGroups = "system:bootstrappers:byoh"
+
+	// BootstrapKubeconfigNameAnnotation is the name of the BootstrapKubeconfig a bootstrap token secret was generated for
+	BootstrapKubeconfigNameAnnotation = "byoh.infrastructure.cluster.x-k8s.io/bootstrapkubeconfig-name"
+
+	// BootstrapKubeconfigNamespaceAnnotation is the namespace of the BootstrapKubeconfig a bootstrap token secret was generated for
+	BootstrapKubeconfigNamespaceAnnotation = "byoh.infrastructure.cluster.x-k8s.io/bootstrapkubeconfig-namespace"
+
+	// BootstrapKubeconfigSecretKey is the key of the bootstrap kubeconfig in the secret of a BootstrapKubeconfig
+	BootstrapKubeconfigSecretKey = "bootstrap-kubeconfig"
+
+	// RegenerateTokenAnnotation requests a new bootstrap token for a BootstrapKubeconfig, the previous one is revoked
+	RegenerateTokenAnnotation = "byoh.infrastructure.cluster.x-k8s.io/regenerate-token"
+
+	// BootstrapKubeconfigFinalizer allows the BootstrapKubeconfig controller to delete the bootstrap token secret
+	BootstrapKubeconfigFinalizer = "bootstrapkubeconfig.infrastructure.cluster.x-k8s.io"
+
+	// HostsGroup is the group, i.e. the organization of the client certificates, of the registered hosts
+	HostsGroup = "byoh:hosts"
+
+	// HostUsernamePrefix is followed by the host name in the username, i.e. the common name of the client certificate, of a registered host
+	HostUsernamePrefix = "byoh:host:"
 )
 
 // BootstrapKubeconfigSpec defines the desired state of BootstrapKubeconfig
@@ -39,18 +65,74 @@ type BootstrapKubeconfigSpec struct {
 
 	// CertificateAuthorityData contains PEM-encoded certificate authority certificates.
 	CertificateAuthorityData string `json:"certificate-authority-data"`
+
+	// TargetNamespace is the namespace the hosts bootstrapped with the token register their
+	// ByoHost in. Defaults to the namespace of the BootstrapKubeconfig.
+	// +optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// HostNamePatterns are shell patterns, e.g. "web-*", one of which the name of the hosts
+	// bootstrapped with the token must match. Any host name is allowed if empty.
+	// +optional
+	HostNamePatterns []string `json:"hostNamePatterns,omitempty"`
+
+	// MaxUsages is the number of hosts that can be bootstrapped with the token. Unlimited if not set.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxUsages *int32 `json:"maxUsages,omitempty"`
+
+	// TTL is the time to live of the bootstrap token. Defaults to 30 minutes.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+// RegisteredHost is a host registered with a bootstrap token of a BootstrapKubeconfig
+type RegisteredHost struct {
+	// HostName is the name of the host
+	HostName string `json:"hostName"`
+
+	// TokenID is the ID of the bootstrap token the host registered with
+	TokenID string `json:"tokenID"`
 }
 
 // BootstrapKubeconfigStatus defines the observed state of BootstrapKubeconfig
 type BootstrapKubeconfigStatus struct {
 	// BootstrapKubeconfigData is an optional reference to a bootstrap kubeconfig info
 	// for starting the host registration process
+	// Deprecated: the bootstrap kubeconfig is in the secret of BootstrapKubeconfigSecretRef,
+	// the controller moves the data of the existing BootstrapKubeconfigs to it.
 	// +optional
 	BootstrapKubeconfigData *string `json:"bootstrapKubeconfigData,omitempty"`
+
+	// BootstrapKubeconfigSecretRef is the secret, in the namespace of the BootstrapKubeconfig, with the
+	// bootstrap kubeconfig for starting the host registration process under the bootstrap-kubeconfig key
+	// +optional
+	BootstrapKubeconfigSecretRef *corev1.LocalObjectReference `json:"bootstrapKubeconfigSecretRef,omitempty"`
+
+	// RegisteredHosts are the hosts whose first client certificate was approved for a bootstrap token
+	// of the BootstrapKubeconfig, with the last token they registered with. Only the hosts registered
+	// with the current token count towards MaxUsages.
+	// +optional
+	RegisteredHosts []RegisteredHost `json:"registeredHosts,omitempty"`
+
+	// TokenID is the ID of the bootstrap token of the bootstrap kubeconfig
+	// +optional
+	TokenID string `json:"tokenID,omitempty"`
+
+	// TokenExpirationTime is the time the bootstrap token expires
+	// +optional
+	TokenExpirationTime *metav1.Time `json:"tokenExpirationTime,omitempty"`
+
+	// Conditions defines current service state of the BootstrapKubeconfig.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="TokenValid",type="string",JSONPath=".status.conditions[?(@.type=='BootstrapTokenValid')].status"
+//+kubebuilder:printcolumn:name="Expires",type="string",JSONPath=".status.tokenExpirationTime"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // BootstrapKubeconfig is the Schema for the bootstrapkubeconfigs API
 type BootstrapKubeconfig struct {
@@ -70,6 +152,72 @@ type BootstrapKubeconfigList struct {
 	Items           []BootstrapKubeconfig `json:"items"`
 }
 
+// GetConditions returns the conditions of BootstrapKubeconfig status
+func (r *BootstrapKubeconfig) GetConditions() clusterv1.Conditions {
+	return r.Status.Conditions
+}
+
+// SetConditions sets the conditions of BootstrapKubeconfig status
+func (r *BootstrapKubeconfig) SetConditions(conditions clusterv1.Conditions) {
+	r.Status.Conditions = conditions
+}
+
+// TokenNamespace returns the namespace the hosts bootstrapped with the token register in
+func (r *BootstrapKubeconfig) TokenNamespace() string {
+	switch {
+	case r.Spec.TargetNamespace != "":
+		return r.Spec.TargetNamespace
+	case r.Namespace != "":
+		return r.Namespace
+	}
+	return DefaultNamespace
+}
+
+// AllowsHostName returns true if hostName matches one of the HostNamePatterns, or if there are none
+func (r *BootstrapKubeconfig) AllowsHostName(hostName string) bool {
+	if len(r.Spec.HostNamePatterns) == 0 {
+		return true
+	}
+	for _, pattern := range r.Spec.HostNamePatterns {
+		if matched, err := path.Match(pattern, hostName); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRegistered returns true if the first client certificate of hostName was approved for a
+// token of the BootstrapKubeconfig
+func (r *BootstrapKubeconfig) HasRegistered(hostName string) bool {
+	for _, registered := range r.Status.RegisteredHosts {
+		if registered.HostName == hostName {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRegisteredWithToken returns true if hostName last registered with the token tokenID
+func (r *BootstrapKubeconfig) HasRegisteredWithToken(hostName, tokenID string) bool {
+	for _, registered := range r.Status.RegisteredHosts {
+		if registered.HostName == hostName && registered.TokenID == tokenID {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenUsages returns the number of hosts registered with the token tokenID
+func (r *BootstrapKubeconfig) TokenUsages(tokenID string) int {
+	usages := 0
+	for _, registered := range r.Status.RegisteredHosts {
+		if registered.TokenID == tokenID {
+			usages++
+		}
+	}
+	return usages
+}
+
 func init() {
 	SchemeBuilder.Register(&BootstrapKubeconfig{}, &BootstrapKubeconfigList{})
 }
@@ -7,8 +7,10 @@ import (
 	b64 "encoding/base64"
 	"encoding/pem"
 	"net/url"
+	"path"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -43,7 +45,7 @@ func (r *BootstrapKubeconfig) ValidateCreate() error {
 		return err
 	}
 
-	return nil
+	return r.validateTokenBinding()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
@@ -58,7 +60,7 @@ func (r *BootstrapKubeconfig) ValidateUpdate(old runtime.Object) error {
 		return err
 	}
 
-	return nil
+	return r.validateTokenBinding()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -101,6 +103,24 @@ func (r *BootstrapKubeconfig) validateCAData() error {
 	return nil
 }
 
+func (r *BootstrapKubeconfig) validateTokenBinding() error {
+	specPath := field.NewPath("spec")
+	if r.Spec.TargetNamespace != "" {
+		if errs := validation.IsDNS1123Label(r.Spec.TargetNamespace); len(errs) > 0 {
+			return field.Invalid(specPath.Child("targetNamespace"), r.Spec.TargetNamespace, errs[0])
+		}
+	}
+	for i, pattern := range r.Spec.HostNamePatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return field.Invalid(specPath.Child("hostNamePatterns").Index(i), pattern, "invalid host name pattern")
+		}
+	}
+	if r.Spec.TTL != nil && r.Spec.TTL.Duration <= 0 {
+		return field.Invalid(specPath.Child("ttl"), r.Spec.TTL.Duration.String(), "TTL must be positive")
+	}
+	return nil
+}
+
 func (r *BootstrapKubeconfig) isURLValid(parsedURL *url.URL) bool {
 	if parsedURL.Host == "" || parsedURL.Scheme != APIServerURLScheme || parsedURL.Port() == "" {
 		return false
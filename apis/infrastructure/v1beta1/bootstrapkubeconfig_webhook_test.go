@@ -6,6 +6,7 @@ package v1beta1_test
 import (
 	b64 "encoding/base64"
 	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -125,6 +126,52 @@ var _ = Describe("BootstrapKubeconfig Webhook", func() {
 			err = k8sClient.Create(ctx, bootstrapKubeconfig)
 			Expect(err).NotTo(HaveOccurred())
 		})
+
+		It("should reject the request if TargetNamespace is not a valid namespace", func() {
+			bootstrapKubeconfig = builder.BootstrapKubeconfig(defaultNamespace, testBootstrapKubeconfigName).
+				WithServer(testServerValid).
+				WithCAData(b64.StdEncoding.EncodeToString(cfg.CAData)).
+				WithTargetNamespace("Byoh_Pool").
+				Build()
+			err = k8sClient.Create(ctx, bootstrapKubeconfig)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.targetNamespace: Invalid value: \"Byoh_Pool\""))
+		})
+
+		It("should reject the request if a host name pattern is not valid", func() {
+			bootstrapKubeconfig = builder.BootstrapKubeconfig(defaultNamespace, testBootstrapKubeconfigName).
+				WithServer(testServerValid).
+				WithCAData(b64.StdEncoding.EncodeToString(cfg.CAData)).
+				WithHostNamePatterns("web-*", "db-[").
+				Build()
+			err = k8sClient.Create(ctx, bootstrapKubeconfig)
+			Expect(err).To(HaveOccurred())
+			Expect(err).To(MatchError("admission webhook \"vbootstrapkubeconfig.kb.io\" denied the request: spec.hostNamePatterns[1]: Invalid value: \"db-[\": invalid host name pattern"))
+		})
+
+		It("should reject the request if TTL is not positive", func() {
+			bootstrapKubeconfig = builder.BootstrapKubeconfig(defaultNamespace, testBootstrapKubeconfigName).
+				WithServer(testServerValid).
+				WithCAData(b64.StdEncoding.EncodeToString(cfg.CAData)).
+				WithTTL(0).
+				Build()
+			err = k8sClient.Create(ctx, bootstrapKubeconfig)
+			Expect(err).To(HaveOccurred())
+			Expect(err).To(MatchError("admission webhook \"vbootstrapkubeconfig.kb.io\" denied the request: spec.ttl: Invalid value: \"0s\": TTL must be positive"))
+		})
+
+		It("should accept the request if the token is bound to a namespace and host names", func() {
+			bootstrapKubeconfig = builder.BootstrapKubeconfig(defaultNamespace, testBootstrapKubeconfigName).
+				WithServer(testServerValid).
+				WithCAData(b64.StdEncoding.EncodeToString(cfg.CAData)).
+				WithTargetNamespace("byoh-pool").
+				WithHostNamePatterns("web-*").
+				WithMaxUsages(3).
+				WithTTL(2 * time.Hour).
+				Build()
+			err = k8sClient.Create(ctx, bootstrapKubeconfig)
+			Expect(err).NotTo(HaveOccurred())
+		})
 	})
 
 	Context("When BootstrapKubeconfig gets an update request", func() {
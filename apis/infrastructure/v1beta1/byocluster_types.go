@@ -4,6 +4,7 @@
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
@@ -25,6 +26,116 @@ type ByoClusterSpec struct {
 	// if not set, the default will be set to https://projects.registry.vmware.com/cluster_api_provider_bringyourownhost
 	// +optional
 	BundleLookupBaseRegistry string `json:"bundleLookupBaseRegistry,omitempty"`
+
+	// KubeVIP configures the kube-vip static pod serving the control plane endpoint.
+	// When set, the kube-vip manifest is added to the bootstrap data of the control plane machines.
+	// +optional
+	KubeVIP *KubeVIPSpec `json:"kubeVIP,omitempty"`
+
+	// LoadBalancer configures an external load balancer of the control plane endpoint, its backends
+	// are kept in sync with the control plane machines. It cannot be set together with KubeVIP.
+	// +optional
+	LoadBalancer *LoadBalancerSpec `json:"loadBalancer,omitempty"`
+
+	// ControlPlaneEndpointIPPool is a reference to the IPAM pool the host of the control plane endpoint
+	// is claimed from with an IPAddressClaim, when the host is not set. The claimed address is also the
+	// default kube-vip address.
+	// +optional
+	ControlPlaneEndpointIPPool *corev1.TypedLocalObjectReference `json:"controlPlaneEndpointIPPool,omitempty"`
+}
+
+// LoadBalancerSpec defines the load balancer of the control plane endpoint, exactly one of its providers must be set
+type LoadBalancerSpec struct {
+	// HAProxy runs HAProxy on a host of the pool
+	// +optional
+	HAProxy *HAProxyLoadBalancerSpec `json:"haproxy,omitempty"`
+
+	// Webhook delegates the load balancer to an external service
+	// +optional
+	Webhook *WebhookLoadBalancerSpec `json:"webhook,omitempty"`
+}
+
+// HAProxyLoadBalancerSpec defines a load balancer running HAProxy on a host of the pool.
+// The host is chosen among the available ByoHosts and is not used for machines until the ByoCluster is deleted.
+type HAProxyLoadBalancerSpec struct {
+	// Selector selects the ByoHosts the load balancer host is chosen from, all the available hosts if not set
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// WebhookLoadBalancerSpec defines a load balancer configured by an external service
+type WebhookLoadBalancerSpec struct {
+	// URL of the service, the backends are sent to it with a POST request and the load balancer
+	// is released with a DELETE request. Only https URLs are accepted, the requests are sent from
+	// the network of the controller manager.
+	URL string `json:"url"`
+
+	// CABundle is the PEM encoded CA bundle used to verify the certificate of the service,
+	// the system CAs are used if not set
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+}
+
+// KubeVIPMode is the way kube-vip advertises the control plane endpoint
+type KubeVIPMode string
+
+const (
+	// KubeVIPModeARP elects a leader among the control plane nodes that answers the ARP requests of the VIP
+	KubeVIPModeARP KubeVIPMode = "ARP"
+	// KubeVIPModeBGP advertises the VIP from all the control plane nodes to BGP peers
+	KubeVIPModeBGP KubeVIPMode = "BGP"
+
+	// DefaultKubeVIPImage is the kube-vip image used when KubeVIPSpec.Image is not set
+	DefaultKubeVIPImage = "ghcr.io/kube-vip/kube-vip:v0.5.0"
+)
+
+// KubeVIPSpec defines the kube-vip configuration of the control plane endpoint
+type KubeVIPSpec struct {
+	// Mode is the way the VIP is advertised, ARP or BGP. Defaults to ARP.
+	// +kubebuilder:validation:Enum=ARP;BGP
+	// +optional
+	Mode KubeVIPMode `json:"mode,omitempty"`
+
+	// Address is the virtual IP address of the control plane endpoint.
+	// Defaults to the host of the control plane endpoint, which must then be an IP address.
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// Interface is the network interface the VIP is bound to.
+	// Defaults to the default network interface of each host.
+	// +optional
+	Interface string `json:"interface,omitempty"`
+
+	// Image is the kube-vip image, defaults to ghcr.io/kube-vip/kube-vip:v0.5.0
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// BGP configures the BGP peering, it is required in BGP mode.
+	// +optional
+	BGP *KubeVIPBGPSpec `json:"bgp,omitempty"`
+}
+
+// KubeVIPBGPSpec defines the BGP peering of kube-vip
+type KubeVIPBGPSpec struct {
+	// AS is the autonomous system number of the control plane nodes
+	AS uint32 `json:"as"`
+
+	// PeerAddress is the address of the BGP peer
+	PeerAddress string `json:"peerAddress"`
+
+	// PeerAS is the autonomous system number of the BGP peer
+	PeerAS uint32 `json:"peerAS"`
+}
+
+// GetKubeVIPAddress returns the virtual IP address of the control plane endpoint, empty if kube-vip is not configured
+func (byoCluster *ByoCluster) GetKubeVIPAddress() string {
+	if byoCluster.Spec.KubeVIP == nil {
+		return ""
+	}
+	if byoCluster.Spec.KubeVIP.Address != "" {
+		return byoCluster.Spec.KubeVIP.Address
+	}
+	return byoCluster.Spec.ControlPlaneEndpoint.Host
 }
 
 // ByoClusterStatus defines the observed state of ByoCluster
@@ -0,0 +1,71 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+import (
+	"net/url"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var byoclusterlog = logf.Log.WithName("byocluster-resource")
+
+// LoadBalancerWebhookURLScheme is the url scheme of the load balancer webhook services
+const LoadBalancerWebhookURLScheme = "https"
+
+func (r *ByoCluster) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-byocluster,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=byoclusters,verbs=create;update,versions=v1beta1,name=vbyocluster.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ByoCluster{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ByoCluster) ValidateCreate() error {
+	byoclusterlog.Info("validate create", "name", r.Name)
+
+	return r.validateLoadBalancerWebhook()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ByoCluster) ValidateUpdate(old runtime.Object) error {
+	byoclusterlog.Info("validate update", "name", r.Name)
+
+	return r.validateLoadBalancerWebhook()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ByoCluster) ValidateDelete() error {
+	byoclusterlog.Info("validate delete", "name", r.Name)
+
+	return nil
+}
+
+// validateLoadBalancerWebhook only accepts https URLs for the load balancer webhook, which the
+// controller manager sends requests to from its own network
+func (r *ByoCluster) validateLoadBalancerWebhook() error {
+	if r.Spec.LoadBalancer == nil || r.Spec.LoadBalancer.Webhook == nil {
+		return nil
+	}
+	urlPath := field.NewPath("spec").Child("loadBalancer", "webhook", "url")
+	parsedURL, err := url.Parse(r.Spec.LoadBalancer.Webhook.URL)
+	if err != nil {
+		return field.Invalid(urlPath, r.Spec.LoadBalancer.Webhook.URL, "URL is not valid")
+	}
+	if parsedURL.Scheme != LoadBalancerWebhookURLScheme {
+		return field.Invalid(urlPath, r.Spec.LoadBalancer.Webhook.URL, "URL scheme must be https")
+	}
+	if parsedURL.Host == "" {
+		return field.Invalid(urlPath, r.Spec.LoadBalancer.Webhook.URL, "URL host cannot be empty")
+	}
+	return nil
+}
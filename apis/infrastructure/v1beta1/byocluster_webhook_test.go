@@ -0,0 +1,62 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	byohv1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/builder"
+)
+
+var _ = Describe("ByoCluster Webhook", func() {
+	var (
+		byoCluster       *byohv1beta1.ByoCluster
+		defaultNamespace = "default"
+	)
+
+	webhookLoadBalancer := func(url string) *byohv1beta1.LoadBalancerSpec {
+		return &byohv1beta1.LoadBalancerSpec{Webhook: &byohv1beta1.WebhookLoadBalancerSpec{URL: url}}
+	}
+
+	Context("When ByoCluster gets a create request", func() {
+		It("should allow an https load balancer webhook URL", func() {
+			byoCluster = builder.ByoCluster(defaultNamespace, "byocluster-https-webhook").
+				WithLoadBalancer(webhookLoadBalancer("https://lb.example.com/control-planes")).
+				Build()
+			Expect(k8sClient.Create(ctx, byoCluster)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, byoCluster)).Should(Succeed())
+		})
+
+		It("should reject a load balancer webhook URL without https scheme", func() {
+			byoCluster = builder.ByoCluster(defaultNamespace, "byocluster-http-webhook").
+				WithLoadBalancer(webhookLoadBalancer("http://10.0.0.1/internal")).
+				Build()
+			err := k8sClient.Create(ctx, byoCluster)
+			Expect(err).To(MatchError("admission webhook \"vbyocluster.kb.io\" denied the request: spec.loadBalancer.webhook.url: Invalid value: \"http://10.0.0.1/internal\": URL scheme must be https"))
+		})
+
+		It("should reject a load balancer webhook URL without host", func() {
+			byoCluster = builder.ByoCluster(defaultNamespace, "byocluster-webhook-without-host").
+				WithLoadBalancer(webhookLoadBalancer("https:///control-planes")).
+				Build()
+			err := k8sClient.Create(ctx, byoCluster)
+			Expect(err).To(MatchError("admission webhook \"vbyocluster.kb.io\" denied the request: spec.loadBalancer.webhook.url: Invalid value: \"https:///control-planes\": URL host cannot be empty"))
+		})
+	})
+
+	Context("When ByoCluster gets an update request", func() {
+		It("should reject a load balancer webhook URL without https scheme", func() {
+			byoCluster = builder.ByoCluster(defaultNamespace, "byocluster-updated-webhook").
+				WithLoadBalancer(webhookLoadBalancer("https://lb.example.com/control-planes")).
+				Build()
+			Expect(k8sClient.Create(ctx, byoCluster)).Should(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, byoCluster)).Should(Succeed()) })
+
+			byoCluster.Spec.LoadBalancer.Webhook.URL = "http://lb.example.com/control-planes"
+			err := k8sClient.Update(ctx, byoCluster)
+			Expect(err).To(MatchError("admission webhook \"vbyocluster.kb.io\" denied the request: spec.loadBalancer.webhook.url: Invalid value: \"http://lb.example.com/control-planes\": URL scheme must be https"))
+		})
+	})
+})
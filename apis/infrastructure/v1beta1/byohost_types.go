@@ -20,6 +20,29 @@ const (
 	AttachedByoMachineLabel = "byoh.infrastructure.cluster.x-k8s.io/byomachine-name"
 	// BundleLookupBaseRegistryAnnotation annotation used to store the base registry for the bundle lookup
 	BundleLookupBaseRegistryAnnotation = "byoh.infrastructure.cluster.x-k8s.io/bundle-registry"
+	// ManagedLabelsAnnotation annotation used to store the comma separated keys of the labels managed by the host agent
+	ManagedLabelsAnnotation = "byoh.infrastructure.cluster.x-k8s.io/managed-labels"
+	// HostSecretReaderLabel label used to mark the Roles and RoleBindings granting a host read access to its secrets
+	HostSecretReaderLabel = "byoh.infrastructure.cluster.x-k8s.io/host-secret-reader"
+	// ByoHostAnnotation annotation used to store the namespace/name of the ByoHost a Role or RoleBinding was created for
+	ByoHostAnnotation = "byoh.infrastructure.cluster.x-k8s.io/byohost"
+	// EncryptedBootstrapDataKey is the key of the bootstrap data encrypted to the EncryptionPublicKey of the host
+	// in the bootstrap secret of a ByoHost
+	EncryptedBootstrapDataKey = "encryptedValue"
+	// AcceptHostIdentityAnnotation annotation set by an operator on a ByoHost to accept a new HostIdentity,
+	// the agent removes it once the new identity is recorded
+	AcceptHostIdentityAnnotation = "byoh.infrastructure.cluster.x-k8s.io/accept-host-identity"
+	// MoveToNamespaceAnnotation annotation set by an operator on an idle ByoHost to move the host to the
+	// namespace of its value, the agent then registers the host in this namespace and deletes the ByoHost
+	MoveToNamespaceAnnotation = "byoh.infrastructure.cluster.x-k8s.io/move-to-namespace"
+	// MovedFromNamespaceAnnotation annotation set by the agent on the ByoHost it registers in the namespace
+	// an operator moved the host to, its value is the namespace the host was moved from
+	MovedFromNamespaceAnnotation = "byoh.infrastructure.cluster.x-k8s.io/moved-from-namespace"
+	// LoadBalancerHostLabel label used to mark the host serving the control plane endpoint of a ByoCluster
+	// with HAProxy, its value is the namespace.name of the ByoCluster, shortened with a hash beyond 63 characters
+	LoadBalancerHostLabel = "byoh.infrastructure.cluster.x-k8s.io/load-balancer"
+	// HAProxyConfigKey is the key of the HAProxy configuration in the load balancer secret of a ByoHost
+	HAProxyConfigKey = "haproxy.cfg"
 )
 
 // ByoHostSpec defines the desired state of ByoHost
@@ -38,6 +61,27 @@ type ByoHostSpec struct {
 	// generated by InstallerController
 	// +optional
 	UninstallationScript *string `json:"uninstallationScript,omitempty"`
+
+	// LoadBalancerSecret is an optional reference to the secret holding the HAProxy
+	// configuration of the load balancer the host serves for a ByoCluster
+	// +optional
+	LoadBalancerSecret *corev1.ObjectReference `json:"loadBalancerSecret,omitempty"`
+
+	// SecondaryIPAddresses are the IP addresses the agent configures on the host for the
+	// ByoMachine it is attached to, they are removed when the host is cleaned up
+	// +optional
+	SecondaryIPAddresses []HostIPAddress `json:"secondaryIPAddresses,omitempty"`
+}
+
+// HostIPAddress is an IP address configured on a network interface of the host
+type HostIPAddress struct {
+	// Address is the IP address with its prefix length, e.g. 10.10.10.10/24
+	Address string `json:"address"`
+
+	// Interface is the network interface the address is configured on,
+	// the default network interface of the host if not set
+	// +optional
+	Interface string `json:"interface,omitempty"`
 }
 
 // HostInfo is a set of details about the host platform.
@@ -52,6 +96,21 @@ type HostInfo struct {
 	Architecture string `json:"architecture,omitempty"`
 }
 
+// HostIdentity is a set of stable facts identifying the machine of a host.
+type HostIdentity struct {
+	// MachineID is the content of /etc/machine-id.
+	// +optional
+	MachineID string `json:"machineID,omitempty"`
+
+	// ProductUUID is the DMI product UUID of the machine.
+	// +optional
+	ProductUUID string `json:"productUUID,omitempty"`
+
+	// SSHHostKeyFingerprint is the SHA256 fingerprint of the SSH host key, as printed by ssh-keygen.
+	// +optional
+	SSHHostKeyFingerprint string `json:"sshHostKeyFingerprint,omitempty"`
+}
+
 // ByoHostStatus defines the observed state of ByoHost
 type ByoHostStatus struct {
 	// MachineRef is an optional reference to a Cluster API Machine
@@ -71,6 +130,22 @@ type ByoHostStatus struct {
 	// network interfaces.
 	// +optional
 	Network []NetworkStatus `json:"network,omitempty"`
+
+	// EncryptionPublicKey is the PEM encoded RSA public key of the host agent.
+	// When set, the bootstrap data of the host is encrypted to this key.
+	// +optional
+	EncryptionPublicKey string `json:"encryptionPublicKey,omitempty"`
+
+	// HostIdentity identifies the machine of the host, it is recorded at the first registration.
+	// Until the AcceptHostIdentityAnnotation is set, a machine with another identity cannot
+	// update the ByoHost nor get the client certificate of the host.
+	// +optional
+	HostIdentity *HostIdentity `json:"hostIdentity,omitempty"`
+
+	// BootstrapFailures is the number of consecutive failed attempts of the agent to bootstrap
+	// the k8s node of the attached machine.
+	// +optional
+	BootstrapFailures int32 `json:"bootstrapFailures,omitempty"`
 }
 
 //+kubebuilder:object:root=true
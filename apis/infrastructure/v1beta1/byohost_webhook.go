@@ -5,25 +5,53 @@ package v1beta1
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
+	"sort"
 	"strings"
 
 	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
-//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=byohosts,verbs=create;update;delete,versions=v1beta1,name=vbyohost.kb.io,admissionReviewVersions={v1,v1beta1}
+//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=byohosts;byohosts/status,verbs=create;update;delete,versions=v1beta1,name=vbyohost.kb.io,admissionReviewVersions={v1,v1beta1}
+//+kubebuilder:webhook:path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-byohost,mutating=true,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=byohosts,verbs=create;update,versions=v1beta1,name=mbyohost.kb.io,admissionReviewVersions={v1,v1beta1}
 
 // +k8s:deepcopy-gen=false
 // ByoHostValidator validates ByoHosts
 type ByoHostValidator struct {
-	//	Client  client.Client
-	decoder *admission.Decoder
+	Client client.Client
+	// APIReader reads the installation secrets of the ByoHosts without a cache, so that the webhook
+	// does not watch all the secrets of the cluster
+	APIReader client.Reader
+	// ManagerServiceAccount is the username of the controller manager, allowed to update any ByoHost.
+	// Defaults to DefaultManagerServiceAccount.
+	ManagerServiceAccount string
+	decoder               *admission.Decoder
 }
 
-// To allow byoh manager service account to patch ByoHost CR
-const managerServiceAccount = "system:serviceaccount:byoh-system:byoh-controller-manager"
+// DefaultManagerServiceAccount is the service account of the byoh controller manager deployed in byoh-system
+const DefaultManagerServiceAccount = "system:serviceaccount:byoh-system:byoh-controller-manager"
+
+// managerOwnedLabels and managerOwnedAnnotations are set by the controller manager or by operators,
+// an agent can only remove them
+var (
+	managerOwnedLabels      = []string{clusterv1.ClusterNameLabel, AttachedByoMachineLabel, LoadBalancerHostLabel}
+	managerOwnedAnnotations = []string{HostCleanupAnnotation, EndPointIPAnnotation, K8sVersionAnnotation, BundleLookupBaseRegistryAnnotation,
+		AcceptHostIdentityAnnotation, MoveToNamespaceAnnotation}
+	// agentOwnedAnnotations are set by the agent, along with the labels listed in the ManagedLabelsAnnotation
+	agentOwnedAnnotations = []string{ManagedLabelsAnnotation, MovedFromNamespaceAnnotation}
+	// operatorAnnotations are the managerOwnedAnnotations operators can set
+	operatorAnnotations = []string{AcceptHostIdentityAnnotation, MoveToNamespaceAnnotation}
+)
 
 //nolint: gocritic
 // Handle handles all the requests for ByoHost resource
@@ -32,7 +60,7 @@ func (v *ByoHostValidator) Handle(ctx context.Context, req admission.Request) ad
 
 	switch req.Operation {
 	case v1.Create, v1.Update:
-		response = v.handleCreateUpdate(&req)
+		response = v.handleCreateUpdate(ctx, &req)
 	case v1.Delete:
 		response = v.handleDelete(&req)
 	default:
@@ -41,7 +69,7 @@ func (v *ByoHostValidator) Handle(ctx context.Context, req admission.Request) ad
 	return response
 }
 
-func (v *ByoHostValidator) handleCreateUpdate(req *admission.Request) admission.Response {
+func (v *ByoHostValidator) handleCreateUpdate(ctx context.Context, req *admission.Request) admission.Response {
 	byoHost := &ByoHost{}
 	err := v.decoder.Decode(*req, byoHost)
 	if err != nil {
@@ -49,17 +77,333 @@ func (v *ByoHostValidator) handleCreateUpdate(req *admission.Request) admission.
 	}
 	userName := req.UserInfo.Username
 	// allow manager service account to patch ByoHost
-	if userName == managerServiceAccount && req.Operation == v1.Update {
+	if userName == v.managerServiceAccount() && req.Operation == v1.Update {
 		return admission.Allowed("")
 	}
-	substrs := strings.Split(userName, ":")
-	if len(substrs) < 2 { //nolint: gomnd
+	hostName := strings.TrimPrefix(userName, HostUsernamePrefix)
+	if hostName == userName || hostName == "" {
+		// operators, who are not in the hosts group, can change the labels and annotations no
+		// controller owns, accept a new identity of the host or move it to another namespace
+		if req.Operation == v1.Update && !isHostsGroupMember(req.UserInfo.Groups) {
+			if response, ok := v.handleOperatorUpdate(req, byoHost); ok {
+				return response
+			}
+		}
 		return admission.Denied(fmt.Sprintf("%s is not a valid agent username", userName))
 	}
-	if !strings.Contains(byoHost.Name, substrs[2]) {
+	if hostName != byoHost.Name {
 		return admission.Denied(fmt.Sprintf("%s cannot create/update resource %s", userName, byoHost.Name))
 	}
-	return admission.Allowed("")
+
+	// a created ByoHost is validated as an update of an empty ByoHost, so that the agent cannot set
+	// the fields it does not own by recreating its ByoHost
+	oldByoHost := &ByoHost{}
+	if req.Operation == v1.Update {
+		if err = v.decoder.DecodeRaw(req.OldObject, oldByoHost); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	if err = v.validateAgentUpdate(ctx, oldByoHost, byoHost); err != nil {
+		return admission.Denied(fmt.Sprintf("%s cannot %s resource %s: %v", userName, strings.ToLower(string(req.Operation)), byoHost.Name, err))
+	}
+	return v.validateNamespace(ctx, oldByoHost, byoHost)
+}
+
+func (v *ByoHostValidator) managerServiceAccount() string {
+	if v.ManagerServiceAccount != "" {
+		return v.ManagerServiceAccount
+	}
+	return DefaultManagerServiceAccount
+}
+
+func isHostsGroupMember(groups []string) bool {
+	for _, group := range groups {
+		if group == HostsGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAgentUpdate only lets an agent change the fields it owns: the status, the labels listed in
+// the ManagedLabelsAnnotation, the agentOwnedAnnotations and the uninstallation script of the
+// installation secret. The agent can only clear the other fields the controller manager sets in the
+// spec, clear the machine reference, and remove the labels and annotations of the controller manager.
+// On create, oldByoHost is empty.
+func (v *ByoHostValidator) validateAgentUpdate(ctx context.Context, oldByoHost, byoHost *ByoHost) error {
+	if byoHost.Spec.BootstrapSecret != nil && !reflect.DeepEqual(byoHost.Spec.BootstrapSecret, oldByoHost.Spec.BootstrapSecret) {
+		return fmt.Errorf("spec.bootstrapSecret can only be cleared")
+	}
+	if byoHost.Spec.InstallationSecret != nil && !reflect.DeepEqual(byoHost.Spec.InstallationSecret, oldByoHost.Spec.InstallationSecret) {
+		return fmt.Errorf("spec.installationSecret can only be cleared")
+	}
+	if byoHost.Spec.LoadBalancerSecret != nil && !reflect.DeepEqual(byoHost.Spec.LoadBalancerSecret, oldByoHost.Spec.LoadBalancerSecret) {
+		return fmt.Errorf("spec.loadBalancerSecret can only be cleared")
+	}
+	if len(byoHost.Spec.SecondaryIPAddresses) > 0 && !reflect.DeepEqual(byoHost.Spec.SecondaryIPAddresses, oldByoHost.Spec.SecondaryIPAddresses) {
+		return fmt.Errorf("spec.secondaryIPAddresses can only be cleared")
+	}
+	if err := v.validateUninstallationScript(ctx, oldByoHost, byoHost); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(agentMaskedSpec(oldByoHost.Spec), agentMaskedSpec(byoHost.Spec)) {
+		return fmt.Errorf("spec can only be changed by the controller manager")
+	}
+	if byoHost.Status.MachineRef != nil && !reflect.DeepEqual(byoHost.Status.MachineRef, oldByoHost.Status.MachineRef) {
+		return fmt.Errorf("status.machineRef can only be cleared")
+	}
+	if oldByoHost.Status.HostIdentity != nil && !reflect.DeepEqual(byoHost.Status.HostIdentity, oldByoHost.Status.HostIdentity) {
+		if _, accepted := oldByoHost.Annotations[AcceptHostIdentityAnnotation]; !accepted {
+			return fmt.Errorf("status.hostIdentity does not match the identity recorded at the first registration of the host, "+
+				"an operator must set the %s annotation to accept the new identity", AcceptHostIdentityAnnotation)
+		}
+	}
+
+	for _, key := range managerOwnedLabels {
+		if !removedOrUnchanged(oldByoHost.Labels, byoHost.Labels, key) {
+			return fmt.Errorf("label %s can only be removed", key)
+		}
+	}
+	for _, key := range managerOwnedAnnotations {
+		if !removedOrUnchanged(oldByoHost.Annotations, byoHost.Annotations, key) {
+			return fmt.Errorf("annotation %s can only be removed", key)
+		}
+	}
+	if key := changedKey(oldByoHost.Labels, byoHost.Labels, append(agentLabelKeys(oldByoHost, byoHost), managerOwnedLabels...)); key != "" {
+		return fmt.Errorf("label %s is not managed by the agent", key)
+	}
+	if key := changedKey(oldByoHost.Annotations, byoHost.Annotations, append(agentOwnedAnnotations, managerOwnedAnnotations...)); key != "" {
+		return fmt.Errorf("annotation %s is not managed by the agent", key)
+	}
+	if !reflect.DeepEqual(byoHost.OwnerReferences, oldByoHost.OwnerReferences) {
+		return fmt.Errorf("metadata.ownerReferences cannot be changed")
+	}
+	if !reflect.DeepEqual(byoHost.Finalizers, oldByoHost.Finalizers) {
+		return fmt.Errorf("metadata.finalizers cannot be changed")
+	}
+	return nil
+}
+
+// agentMaskedSpec returns spec without the fields an agent can change
+func agentMaskedSpec(spec ByoHostSpec) ByoHostSpec {
+	spec.BootstrapSecret = nil
+	spec.InstallationSecret = nil
+	spec.LoadBalancerSecret = nil
+	spec.SecondaryIPAddresses = nil
+	spec.UninstallationScript = nil
+	return spec
+}
+
+// validateUninstallationScript lets an agent clear the uninstallation script, or set it to the
+// uninstall script of the installation secret of the host
+func (v *ByoHostValidator) validateUninstallationScript(ctx context.Context, oldByoHost, byoHost *ByoHost) error {
+	script := byoHost.Spec.UninstallationScript
+	if script == nil || reflect.DeepEqual(script, oldByoHost.Spec.UninstallationScript) {
+		return nil
+	}
+	invalid := fmt.Errorf("spec.uninstallationScript can only be cleared or set to the uninstall script of spec.installationSecret")
+	secretRef := byoHost.Spec.InstallationSecret
+	if secretRef == nil || v.APIReader == nil {
+		return invalid
+	}
+	namespace := secretRef.Namespace
+	if namespace == "" {
+		namespace = byoHost.Namespace
+	}
+	secret := &corev1.Secret{}
+	if err := v.APIReader.Get(ctx, types.NamespacedName{Name: secretRef.Name, Namespace: namespace}, secret); err != nil {
+		return fmt.Errorf("cannot read spec.installationSecret: %v", err)
+	}
+	if string(secret.Data["uninstall"]) != *script {
+		return invalid
+	}
+	return nil
+}
+
+// managedLabelKeys returns the keys of the labels the agent manages on byoHost
+func managedLabelKeys(byoHost *ByoHost) []string {
+	value, ok := byoHost.Annotations[ManagedLabelsAnnotation]
+	if !ok {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// agentLabelKeys returns the keys of the labels the agent can change: the labels it already manages
+// and the new labels it starts to manage. The agent cannot claim an existing label of an operator.
+func agentLabelKeys(oldByoHost, byoHost *ByoHost) []string {
+	keys := managedLabelKeys(oldByoHost)
+	for _, key := range managedLabelKeys(byoHost) {
+		if _, exists := oldByoHost.Labels[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// changedKey returns the first key, in sorted order, whose value differs between oldValues and
+// values, ignoring the ignored keys. It returns an empty string if no other key changed.
+func changedKey(oldValues, values map[string]string, ignored []string) string {
+	keys := make([]string, 0, len(oldValues)+len(values))
+	for key := range oldValues {
+		keys = append(keys, key)
+	}
+	for key := range values {
+		if _, ok := oldValues[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if containsKey(ignored, key) {
+			continue
+		}
+		oldValue, existed := oldValues[key]
+		value, exists := values[key]
+		if existed != exists || oldValue != value {
+			return key
+		}
+	}
+	return ""
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// handleOperatorUpdate handles the updates of operators, it returns false if the old ByoHost cannot be decoded
+func (v *ByoHostValidator) handleOperatorUpdate(req *admission.Request, byoHost *ByoHost) (admission.Response, bool) {
+	oldByoHost := &ByoHost{}
+	if err := v.decoder.DecodeRaw(req.OldObject, oldByoHost); err != nil {
+		return admission.Response{}, false
+	}
+	if err := validateOperatorUpdate(oldByoHost, byoHost); err != nil {
+		return admission.Denied(fmt.Sprintf("%s cannot update resource %s: %v", req.UserInfo.Username, byoHost.Name, err)), true
+	}
+
+	if namespace, ok := byoHost.Annotations[MoveToNamespaceAnnotation]; ok && namespace != oldByoHost.Annotations[MoveToNamespaceAnnotation] {
+		if err := validateNamespaceMove(byoHost, namespace); err != nil {
+			return admission.Denied(fmt.Sprintf("cannot move ByoHost %s: %v", byoHost.Name, err)), true
+		}
+	}
+	return admission.Allowed(""), true
+}
+
+// validateOperatorUpdate lets operators change the labels and annotations no controller owns, and set
+// or remove the operatorAnnotations. The fields owned by the controller manager or the agent cannot change.
+func validateOperatorUpdate(oldByoHost, byoHost *ByoHost) error {
+	for _, key := range append(managerOwnedLabels, managedLabelKeys(oldByoHost)...) {
+		if !unchanged(oldByoHost.Labels, byoHost.Labels, key) {
+			return fmt.Errorf("label %s is managed by the BYOH controllers or the agent", key)
+		}
+	}
+	for _, key := range append(managerOwnedAnnotations, agentOwnedAnnotations...) {
+		if !containsKey(operatorAnnotations, key) && !unchanged(oldByoHost.Annotations, byoHost.Annotations, key) {
+			return fmt.Errorf("annotation %s is managed by the BYOH controllers or the agent", key)
+		}
+	}
+	if !reflect.DeepEqual(oldByoHost.Finalizers, byoHost.Finalizers) {
+		return fmt.Errorf("metadata.finalizers cannot be changed")
+	}
+	if !reflect.DeepEqual(oldByoHost.OwnerReferences, byoHost.OwnerReferences) {
+		return fmt.Errorf("metadata.ownerReferences cannot be changed")
+	}
+	if !reflect.DeepEqual(oldByoHost.Spec, byoHost.Spec) {
+		return fmt.Errorf("spec can only be changed by the controller manager")
+	}
+	if !reflect.DeepEqual(oldByoHost.Status, byoHost.Status) {
+		return fmt.Errorf("status can only be changed by the controller manager or the agent")
+	}
+	return nil
+}
+
+// validateNamespaceMove checks that the host can be moved to namespace
+func validateNamespaceMove(byoHost *ByoHost, namespace string) error {
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, ", "))
+	}
+	if namespace == byoHost.Namespace {
+		return fmt.Errorf("the host is already registered in namespace %s", namespace)
+	}
+	if byoHost.Status.MachineRef != nil {
+		return fmt.Errorf("the host is attached to %s %s/%s", byoHost.Status.MachineRef.Kind, byoHost.Status.MachineRef.Namespace, byoHost.Status.MachineRef.Name)
+	}
+	return nil
+}
+
+func unchanged(oldValues, values map[string]string, key string) bool {
+	oldValue, existed := oldValues[key]
+	value, exists := values[key]
+	return existed == exists && oldValue == value
+}
+
+func removedOrUnchanged(oldValues, values map[string]string, key string) bool {
+	value, ok := values[key]
+	if !ok {
+		return true
+	}
+	oldValue, existed := oldValues[key]
+	return existed && value == oldValue
+}
+
+// validateNamespace only lets an agent create or update the ByoHost of its host in the target namespace
+// of the BootstrapKubeconfigs whose bootstrap token registered it, in the namespace an operator moves it
+// to, or in the namespace it was moved to, as recorded in the MovedFromNamespaceAnnotation
+func (v *ByoHostValidator) validateNamespace(ctx context.Context, oldByoHost, byoHost *ByoHost) admission.Response {
+	if v.Client == nil {
+		return admission.Allowed("")
+	}
+	if movedFrom, ok := byoHost.Annotations[MovedFromNamespaceAnnotation]; ok {
+		if oldMovedFrom, ok := oldByoHost.Annotations[MovedFromNamespaceAnnotation]; ok && oldMovedFrom == movedFrom {
+			return admission.Allowed("")
+		}
+		// the ByoHost the host was moved from still has the MoveToNamespaceAnnotation of the operator
+		source := &ByoHost{}
+		err := v.Client.Get(ctx, types.NamespacedName{Name: byoHost.Name, Namespace: movedFrom}, source)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if err != nil || source.Annotations[MoveToNamespaceAnnotation] != byoHost.Namespace {
+			return admission.Denied(fmt.Sprintf("host %s is not moved from namespace %s to %s", byoHost.Name, movedFrom, byoHost.Namespace))
+		}
+		return admission.Allowed("")
+	}
+
+	bootstrapKubeconfigs := &BootstrapKubeconfigList{}
+	if err := v.Client.List(ctx, bootstrapKubeconfigs); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	namespaces := make([]string, 0)
+	for i := range bootstrapKubeconfigs.Items {
+		if bootstrapKubeconfigs.Items[i].HasRegistered(byoHost.Name) {
+			namespaces = append(namespaces, bootstrapKubeconfigs.Items[i].TokenNamespace())
+		}
+	}
+	if len(namespaces) == 0 {
+		return admission.Allowed("")
+	}
+	// the namespaces an operator moves the host to, see MoveToNamespaceAnnotation
+	byoHosts := &ByoHostList{}
+	if err := v.Client.List(ctx, byoHosts); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	for i := range byoHosts.Items {
+		if namespace, ok := byoHosts.Items[i].Annotations[MoveToNamespaceAnnotation]; ok && byoHosts.Items[i].Name == byoHost.Name {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	for _, namespace := range namespaces {
+		if namespace == byoHost.Namespace {
+			return admission.Allowed("")
+		}
+	}
+	return admission.Denied(fmt.Sprintf("host %s was bootstrapped for the namespaces %s, not %s",
+		byoHost.Name, strings.Join(namespaces, ","), byoHost.Namespace))
 }
 
 func (v *ByoHostValidator) handleDelete(req *admission.Request) admission.Response {
@@ -79,3 +423,74 @@ func (v *ByoHostValidator) InjectDecoder(d *admission.Decoder) error {
 	v.decoder = d
 	return nil
 }
+
+// +k8s:deepcopy-gen=false
+// ByoHostDefaulter normalizes the labels of ByoHosts
+type ByoHostDefaulter struct {
+	decoder *admission.Decoder
+}
+
+//nolint: gocritic
+// Handle handles the create and update requests for ByoHost resource
+func (d *ByoHostDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	byoHost := &ByoHost{}
+	if err := d.decoder.Decode(req, byoHost); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	normalizeLabels(byoHost)
+	marshaled, err := json.Marshal(byoHost)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// normalizeLabels trims the whitespaces around the label keys and values, and rewrites the
+// ManagedLabelsAnnotation as the sorted keys of the labels the agent manages on the ByoHost
+func normalizeLabels(byoHost *ByoHost) {
+	if len(byoHost.Labels) > 0 {
+		labels := make(map[string]string, len(byoHost.Labels))
+		for key, value := range byoHost.Labels {
+			if key = strings.TrimSpace(key); key != "" {
+				labels[key] = strings.TrimSpace(value)
+			}
+		}
+		byoHost.Labels = labels
+	}
+
+	value, ok := byoHost.Annotations[ManagedLabelsAnnotation]
+	if !ok {
+		return
+	}
+	seen := make(map[string]bool)
+	managed := make([]string, 0)
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		if _, exists := byoHost.Labels[key]; !exists || seen[key] || isManagerOwnedLabel(key) {
+			continue
+		}
+		seen[key] = true
+		managed = append(managed, key)
+	}
+	sort.Strings(managed)
+	if len(managed) == 0 {
+		delete(byoHost.Annotations, ManagedLabelsAnnotation)
+		return
+	}
+	byoHost.Annotations[ManagedLabelsAnnotation] = strings.Join(managed, ",")
+}
+
+func isManagerOwnedLabel(key string) bool {
+	for _, label := range managerOwnedLabels {
+		if key == label {
+			return true
+		}
+	}
+	return false
+}
+
+// InjectDecoder injects the decoder.
+func (d *ByoHostDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
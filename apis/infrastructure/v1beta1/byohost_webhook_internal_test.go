@@ -15,6 +15,9 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
@@ -22,6 +25,7 @@ var _ = Describe("ByohostWebhook/Unit", func() {
 	schema := runtime.NewScheme()
 	err := AddToScheme(schema)
 	Expect(err).NotTo(HaveOccurred())
+	Expect(corev1.AddToScheme(schema)).To(Succeed())
 	decoder, _ := admission.NewDecoder(schema)
 	v := &ByoHostValidator{
 		decoder: decoder,
@@ -74,6 +78,34 @@ var _ = Describe("ByohostWebhook/Unit", func() {
 			Expect(resp.AdmissionResponse.Allowed).To(Equal(false))
 			Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal(fmt.Sprintf("%s cannot create/update resource %s", "byoh:host:host2", "host1")))
 		})
+		It("Should reject request from an agent whose host name is a prefix of the ByoHost name", func() {
+			admissionRequest := admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				UserInfo:  v1.UserInfo{Username: "byoh:host:host"},
+				Object: runtime.RawExtension{
+					Raw:    byoHostRaw,
+					Object: byoHost,
+				},
+			}
+			resp := v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+			Expect(resp.AdmissionResponse.Allowed).To(Equal(false))
+			Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal(fmt.Sprintf("%s cannot create/update resource %s", "byoh:host:host", "host1")))
+		})
+		It("Should reject request from usernames without a host name", func() {
+			for _, userName := range []string{"byoh", "byoh:host", "byoh:host:", "system:node:host1"} {
+				admissionRequest := admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					UserInfo:  v1.UserInfo{Username: userName},
+					Object: runtime.RawExtension{
+						Raw:    byoHostRaw,
+						Object: byoHost,
+					},
+				}
+				resp := v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+				Expect(resp.AdmissionResponse.Allowed).To(Equal(false))
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal(fmt.Sprintf("%s is not a valid agent username", userName)))
+			}
+		})
 		It("Should allow request from the valid agent user", func() {
 			admissionRequest := admissionv1.AdmissionRequest{
 				Operation: admissionv1.Create,
@@ -86,6 +118,59 @@ var _ = Describe("ByohostWebhook/Unit", func() {
 			resp := v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
 			Expect(resp.AdmissionResponse.Allowed).To(Equal(true))
 		})
+
+		Context("When the agent creates the ByoHost with fields it does not own", func() {
+			createByoHost := func() admission.Response {
+				raw, err := json.Marshal(byoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				admissionRequest := admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					UserInfo:  v1.UserInfo{Username: "byoh:host:host1", Groups: []string{HostsGroup}},
+					Object:    runtime.RawExtension{Raw: raw, Object: byoHost},
+				}
+				return v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+			}
+			secretRef := &corev1.ObjectReference{Name: "secret", Namespace: "other-tenant"}
+
+			It("Should allow the labels the agent manages", func() {
+				byoHost.Labels = map[string]string{"site": "apac"}
+				byoHost.Annotations = map[string]string{ManagedLabelsAnnotation: "site"}
+				Expect(createByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			DescribeTable("Should reject the create request",
+				func(setField func(), reason string) {
+					setField()
+					resp := createByoHost()
+					Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+					Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("byoh:host:host1 cannot create resource host1: " + reason))
+				},
+				Entry("with a bootstrap secret", func() { byoHost.Spec.BootstrapSecret = secretRef },
+					"spec.bootstrapSecret can only be cleared"),
+				Entry("with an installation secret", func() { byoHost.Spec.InstallationSecret = secretRef },
+					"spec.installationSecret can only be cleared"),
+				Entry("with a load balancer secret", func() { byoHost.Spec.LoadBalancerSecret = secretRef },
+					"spec.loadBalancerSecret can only be cleared"),
+				Entry("with secondary IP addresses", func() { byoHost.Spec.SecondaryIPAddresses = []HostIPAddress{{Address: "10.0.0.2"}} },
+					"spec.secondaryIPAddresses can only be cleared"),
+				Entry("with an uninstallation script", func() {
+					script := "rm -rf /"
+					byoHost.Spec.UninstallationScript = &script
+				}, "spec.uninstallationScript can only be cleared or set to the uninstall script of spec.installationSecret"),
+				Entry("with a machine reference", func() { byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Name: "machine"} },
+					"status.machineRef can only be cleared"),
+				Entry("with the cluster name label", func() { byoHost.Labels = map[string]string{clusterv1.ClusterNameLabel: "cluster1"} },
+					"label "+clusterv1.ClusterNameLabel+" can only be removed"),
+				Entry("with the attached ByoMachine label", func() { byoHost.Labels = map[string]string{AttachedByoMachineLabel: "default.machine"} },
+					"label "+AttachedByoMachineLabel+" can only be removed"),
+				Entry("with the load balancer host label", func() { byoHost.Labels = map[string]string{LoadBalancerHostLabel: "cluster1"} },
+					"label "+LoadBalancerHostLabel+" can only be removed"),
+				Entry("with an annotation of the controller manager", func() { byoHost.Annotations = map[string]string{EndPointIPAnnotation: "10.0.0.1"} },
+					"annotation "+EndPointIPAnnotation+" can only be removed"),
+				Entry("with a label of users", func() { byoHost.Labels = map[string]string{"env": "prod"} },
+					"label env is not managed by the agent"),
+			)
+		})
 	})
 
 	Context("When ByoHost gets an update request", func() {
@@ -126,7 +211,7 @@ var _ = Describe("ByohostWebhook/Unit", func() {
 		It("Should allow update request from manager", func() {
 			admissionRequest := admissionv1.AdmissionRequest{
 				Operation: admissionv1.Update,
-				UserInfo:  v1.UserInfo{Username: managerServiceAccount},
+				UserInfo:  v1.UserInfo{Username: DefaultManagerServiceAccount},
 				Object: runtime.RawExtension{
 					Raw:    byoHostRaw,
 					Object: byoHost,
@@ -156,10 +241,458 @@ var _ = Describe("ByohostWebhook/Unit", func() {
 					Raw:    byoHostRaw,
 					Object: byoHost,
 				},
+				OldObject: runtime.RawExtension{
+					Raw:    byoHostRaw,
+					Object: byoHost,
+				},
 			}
 			resp := v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
 			Expect(resp.AdmissionResponse.Allowed).To(Equal(true))
 		})
+		It("Should allow update request from the configured manager service account", func() {
+			validator := &ByoHostValidator{decoder: decoder, ManagerServiceAccount: "system:serviceaccount:capi-system:byoh-controller-manager"}
+			for userName, allowed := range map[string]bool{
+				"system:serviceaccount:capi-system:byoh-controller-manager": true,
+				DefaultManagerServiceAccount:                                false,
+			} {
+				admissionRequest := admissionv1.AdmissionRequest{
+					Operation: admissionv1.Update,
+					UserInfo:  v1.UserInfo{Username: userName},
+					Object: runtime.RawExtension{
+						Raw:    byoHostRaw,
+						Object: byoHost,
+					},
+				}
+				resp := validator.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+				Expect(resp.AdmissionResponse.Allowed).To(Equal(allowed))
+			}
+		})
+
+		Context("When the agent changes the ByoHost", func() {
+			var (
+				oldByoHost     *ByoHost
+				agentValidator *ByoHostValidator
+				objects        []client.Object
+			)
+
+			updateByoHost := func() admission.Response {
+				oldByoHostRaw, err := json.Marshal(oldByoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				newByoHostRaw, err := json.Marshal(byoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				admissionRequest := admissionv1.AdmissionRequest{
+					Operation: admissionv1.Update,
+					UserInfo:  v1.UserInfo{Username: "byoh:host:host1", Groups: []string{HostsGroup}},
+					Object:    runtime.RawExtension{Raw: newByoHostRaw, Object: byoHost},
+					OldObject: runtime.RawExtension{Raw: oldByoHostRaw, Object: oldByoHost},
+				}
+				return agentValidator.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+			}
+
+			BeforeEach(func() {
+				byoHost.Labels = map[string]string{clusterv1.ClusterNameLabel: "cluster1", "env": "prod"}
+				byoHost.Annotations = map[string]string{EndPointIPAnnotation: "10.0.0.1", "owner": "team-a"}
+				byoHost.Spec.BootstrapSecret = &corev1.ObjectReference{Name: "bootstrap-secret", Namespace: "default"}
+				byoHost.Spec.InstallationSecret = &corev1.ObjectReference{Name: "installation-secret", Namespace: "default"}
+				oldByoHost = byoHost.DeepCopy()
+				objects = []client.Object{&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "installation-secret", Namespace: "default"},
+					Data:       map[string][]byte{"install": []byte("install"), "uninstall": []byte("uninstall")},
+				}}
+			})
+
+			JustBeforeEach(func() {
+				agentValidator = &ByoHostValidator{
+					decoder:   decoder,
+					Client:    fake.NewClientBuilder().WithScheme(schema).WithObjects(objects...).Build(),
+					APIReader: fake.NewClientBuilder().WithScheme(schema).WithObjects(objects...).Build(),
+				}
+			})
+
+			It("Should allow the changes of the agent owned fields", func() {
+				byoHost.Labels["site"] = "apac"
+				byoHost.Annotations[ManagedLabelsAnnotation] = "site"
+				script := "uninstall"
+				byoHost.Spec.UninstallationScript = &script
+				byoHost.Status.HostDetails.Architecture = "amd64"
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should allow the agent to remove the labels it manages", func() {
+				oldByoHost.Labels["site"] = "apac"
+				oldByoHost.Annotations[ManagedLabelsAnnotation] = "site"
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should reject an uninstallation script that is not the one of the installation secret", func() {
+				script := "rm -rf /"
+				byoHost.Spec.UninstallationScript = &script
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("spec.uninstallationScript can only be cleared or set to the uninstall script of spec.installationSecret"))
+			})
+
+			It("Should reject an uninstallation script set without installation secret", func() {
+				oldByoHost.Spec.InstallationSecret = nil
+				byoHost.Spec.InstallationSecret = nil
+				script := "uninstall"
+				byoHost.Spec.UninstallationScript = &script
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("spec.uninstallationScript can only be cleared"))
+			})
+
+			It("Should allow the agent to clear the uninstallation script", func() {
+				script := "uninstall"
+				oldByoHost.Spec.UninstallationScript = &script
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should reject the labels of users changed by the agent", func() {
+				byoHost.Labels["env"] = "dev"
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("label env is not managed by the agent"))
+			})
+
+			It("Should reject the labels of users claimed by the agent", func() {
+				byoHost.Labels["env"] = "dev"
+				byoHost.Annotations[ManagedLabelsAnnotation] = "env"
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("label env is not managed by the agent"))
+
+				delete(byoHost.Labels, "env")
+				resp = updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("label env is not managed by the agent"))
+			})
+
+			It("Should reject the annotations of users changed by the agent", func() {
+				delete(byoHost.Annotations, "owner")
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("annotation owner is not managed by the agent"))
+			})
+
+			It("Should reject the finalizers changed by the agent", func() {
+				byoHost.Finalizers = []string{"example.com/finalizer"}
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("metadata.finalizers cannot be changed"))
+			})
+
+			It("Should allow the agent to clear the fields set by the manager", func() {
+				byoHost.Spec.BootstrapSecret = nil
+				delete(byoHost.Labels, clusterv1.ClusterNameLabel)
+				delete(byoHost.Annotations, EndPointIPAnnotation)
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should reject a bootstrap secret set by the agent", func() {
+				byoHost.Spec.BootstrapSecret = &corev1.ObjectReference{Name: "another-secret", Namespace: "default"}
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("byoh:host:host1 cannot update resource host1: spec.bootstrapSecret can only be cleared"))
+			})
+
+			It("Should reject an installation secret set by the agent", func() {
+				byoHost.Spec.InstallationSecret = &corev1.ObjectReference{Name: "another-secret", Namespace: "default"}
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("spec.installationSecret can only be cleared"))
+			})
+
+			It("Should reject a load balancer secret set by the agent", func() {
+				byoHost.Spec.LoadBalancerSecret = &corev1.ObjectReference{Name: "cluster1-haproxy", Namespace: "default"}
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("spec.loadBalancerSecret can only be cleared"))
+			})
+
+			It("Should reject secondary IP addresses set by the agent", func() {
+				byoHost.Spec.SecondaryIPAddresses = []HostIPAddress{{Address: "10.0.0.5/24"}}
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("spec.secondaryIPAddresses can only be cleared"))
+			})
+
+			It("Should reject the labels of the manager changed by the agent", func() {
+				byoHost.Labels[AttachedByoMachineLabel] = "machine1"
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("label " + AttachedByoMachineLabel + " can only be removed"))
+			})
+
+			It("Should reject the annotations of the manager changed by the agent", func() {
+				byoHost.Annotations[EndPointIPAnnotation] = "10.0.0.2"
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("annotation " + EndPointIPAnnotation + " can only be removed"))
+			})
+
+			It("Should reject a machine reference set by the agent", func() {
+				byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Name: "machine1", Namespace: "default"}
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("status.machineRef can only be cleared"))
+			})
+
+			It("Should allow the agent to clear the machine reference", func() {
+				oldByoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Name: "machine1", Namespace: "default"}
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should reject the owner references changed by the agent", func() {
+				byoHost.OwnerReferences = []metav1.OwnerReference{{APIVersion: "v1", Kind: "Node", Name: "host1", UID: "uid"}}
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("metadata.ownerReferences cannot be changed"))
+			})
+
+			It("Should allow the agent to record the identity of the host", func() {
+				byoHost.Status.HostIdentity = &HostIdentity{MachineID: "machine-id-1"}
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should reject another identity of the host", func() {
+				oldByoHost.Status.HostIdentity = &HostIdentity{MachineID: "machine-id-1"}
+				for _, identity := range []*HostIdentity{{MachineID: "machine-id-2"}, nil} {
+					byoHost.Status.HostIdentity = identity
+					resp := updateByoHost()
+					Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+					Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("status.hostIdentity does not match the identity recorded"))
+				}
+			})
+
+			It("Should allow another identity of the host once accepted", func() {
+				oldByoHost.Status.HostIdentity = &HostIdentity{MachineID: "machine-id-1"}
+				oldByoHost.Annotations[AcceptHostIdentityAnnotation] = ""
+				byoHost.Annotations[AcceptHostIdentityAnnotation] = ""
+				byoHost.Status.HostIdentity = &HostIdentity{MachineID: "machine-id-2"}
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+
+				// the agent removes the annotation once the new identity is recorded
+				oldByoHost = byoHost.DeepCopy()
+				delete(byoHost.Annotations, AcceptHostIdentityAnnotation)
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should reject the acceptance of a new identity by the agent", func() {
+				byoHost.Annotations[AcceptHostIdentityAnnotation] = ""
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("annotation " + AcceptHostIdentityAnnotation + " can only be removed"))
+			})
+
+			Context("When the host was bootstrapped with a token bound to another namespace", func() {
+				BeforeEach(func() {
+					objects = append(objects, &BootstrapKubeconfig{
+						ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-kubeconfig", Namespace: "default"},
+						Spec:       BootstrapKubeconfigSpec{TargetNamespace: "byoh-pool"},
+						Status:     BootstrapKubeconfigStatus{RegisteredHosts: []RegisteredHost{{HostName: "host1", TokenID: "abcdef"}}},
+					})
+				})
+
+				It("Should reject the update of the ByoHost", func() {
+					resp := updateByoHost()
+					Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+					Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("host host1 was bootstrapped for the namespaces byoh-pool, not default"))
+				})
+
+				It("Should reject a namespace the host was not moved to", func() {
+					byoHost.Annotations[MovedFromNamespaceAnnotation] = "byoh-pool"
+					resp := updateByoHost()
+					Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+					Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("host host1 is not moved from namespace byoh-pool to default"))
+				})
+
+				Context("When an operator moved the host to the namespace", func() {
+					BeforeEach(func() {
+						objects = append(objects, &ByoHost{ObjectMeta: metav1.ObjectMeta{
+							Name:        "host1",
+							Namespace:   "byoh-pool",
+							Annotations: map[string]string{MoveToNamespaceAnnotation: "default"},
+						}})
+					})
+
+					It("Should allow the agent to record the move", func() {
+						byoHost.Annotations[MovedFromNamespaceAnnotation] = "byoh-pool"
+						Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+					})
+				})
+
+				It("Should allow the updates of a moved host once the ByoHost it was moved from is deleted", func() {
+					oldByoHost.Annotations[MovedFromNamespaceAnnotation] = "byoh-pool"
+					byoHost.Annotations[MovedFromNamespaceAnnotation] = "byoh-pool"
+					Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+				})
+			})
+		})
+
+		Context("When an operator accepts a new identity of the host", func() {
+			var oldByoHost *ByoHost
+
+			updateByoHost := func() admission.Response {
+				oldByoHostRaw, err := json.Marshal(oldByoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				newByoHostRaw, err := json.Marshal(byoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				admissionRequest := admissionv1.AdmissionRequest{
+					Operation: admissionv1.Update,
+					UserInfo:  v1.UserInfo{Username: "kubernetes-admin"},
+					Object:    runtime.RawExtension{Raw: newByoHostRaw, Object: byoHost},
+					OldObject: runtime.RawExtension{Raw: oldByoHostRaw, Object: oldByoHost},
+				}
+				return v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+			}
+
+			BeforeEach(func() {
+				byoHost.Status.HostIdentity = &HostIdentity{MachineID: "machine-id-1"}
+				oldByoHost = byoHost.DeepCopy()
+				byoHost.Annotations = map[string]string{AcceptHostIdentityAnnotation: ""}
+			})
+
+			It("Should allow the operator to set the annotation", func() {
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should reject the changes of the fields owned by the controllers", func() {
+				byoHost.Spec.BootstrapSecret = &corev1.ObjectReference{Name: "bootstrap-secret", Namespace: "default"}
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("kubernetes-admin cannot update resource host1: spec can only be changed by the controller manager"))
+			})
+		})
+
+		Context("When an operator edits the labels and annotations of the host", func() {
+			var (
+				oldByoHost *ByoHost
+				userInfo   v1.UserInfo
+			)
+
+			updateByoHost := func() admission.Response {
+				oldByoHostRaw, err := json.Marshal(oldByoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				newByoHostRaw, err := json.Marshal(byoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				admissionRequest := admissionv1.AdmissionRequest{
+					Operation: admissionv1.Update,
+					UserInfo:  userInfo,
+					Object:    runtime.RawExtension{Raw: newByoHostRaw, Object: byoHost},
+					OldObject: runtime.RawExtension{Raw: oldByoHostRaw, Object: oldByoHost},
+				}
+				return v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+			}
+
+			BeforeEach(func() {
+				userInfo = v1.UserInfo{Username: "kubernetes-admin", Groups: []string{"system:masters"}}
+				byoHost.Labels = map[string]string{clusterv1.ClusterNameLabel: "cluster1", "site": "apac"}
+				byoHost.Annotations = map[string]string{ManagedLabelsAnnotation: "site"}
+				oldByoHost = byoHost.DeepCopy()
+			})
+
+			It("Should allow the labels and annotations no controller owns", func() {
+				byoHost.Labels["env"] = "prod"
+				byoHost.Annotations["owner"] = "team-a"
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should reject the labels of the controller manager", func() {
+				delete(byoHost.Labels, clusterv1.ClusterNameLabel)
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("label " + clusterv1.ClusterNameLabel + " is managed by the BYOH controllers or the agent"))
+			})
+
+			It("Should reject the labels the agent manages", func() {
+				byoHost.Labels["site"] = "emea"
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("label site is managed by the BYOH controllers or the agent"))
+			})
+
+			It("Should reject the annotations of the agent", func() {
+				byoHost.Annotations[MovedFromNamespaceAnnotation] = "byoh-pool"
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("annotation " + MovedFromNamespaceAnnotation + " is managed by the BYOH controllers or the agent"))
+			})
+
+			It("Should reject the users of the hosts group", func() {
+				userInfo = v1.UserInfo{Username: "test-user", Groups: []string{HostsGroup}}
+				byoHost.Labels["env"] = "prod"
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("test-user is not a valid agent username"))
+			})
+		})
+
+		Context("When an operator moves the host to another namespace", func() {
+			var oldByoHost *ByoHost
+
+			updateByoHost := func() admission.Response {
+				oldByoHostRaw, err := json.Marshal(oldByoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				newByoHostRaw, err := json.Marshal(byoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				admissionRequest := admissionv1.AdmissionRequest{
+					Operation: admissionv1.Update,
+					UserInfo:  v1.UserInfo{Username: "kubernetes-admin"},
+					Object:    runtime.RawExtension{Raw: newByoHostRaw, Object: byoHost},
+					OldObject: runtime.RawExtension{Raw: oldByoHostRaw, Object: oldByoHost},
+				}
+				return v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+			}
+
+			BeforeEach(func() {
+				oldByoHost = byoHost.DeepCopy()
+				byoHost.Annotations = map[string]string{MoveToNamespaceAnnotation: "tenant-a"}
+			})
+
+			It("Should allow the operator to set the annotation on an idle host", func() {
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should allow the operator to cancel the move", func() {
+				oldByoHost = byoHost.DeepCopy()
+				byoHost.Annotations = nil
+				Expect(updateByoHost().AdmissionResponse.Allowed).To(BeTrue())
+			})
+
+			It("Should reject the move of an attached host", func() {
+				machineRef := &corev1.ObjectReference{Kind: "ByoMachine", Name: "machine1", Namespace: "default"}
+				oldByoHost.Status.MachineRef = machineRef
+				byoHost.Status.MachineRef = machineRef
+				resp := updateByoHost()
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("cannot move ByoHost host1: the host is attached to ByoMachine default/machine1"))
+			})
+
+			It("Should reject an invalid namespace", func() {
+				for _, namespace := range []string{"Tenant_A", "default"} {
+					byoHost.Annotations[MoveToNamespaceAnnotation] = namespace
+					resp := updateByoHost()
+					Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+					Expect(string(resp.AdmissionResponse.Result.Reason)).To(HavePrefix("cannot move ByoHost host1"))
+				}
+			})
+
+			It("Should reject the move by the agent", func() {
+				oldByoHostRaw, err := json.Marshal(oldByoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				newByoHostRaw, err := json.Marshal(byoHost)
+				Expect(err).ShouldNot(HaveOccurred())
+				resp := v.Handle(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Update,
+					UserInfo:  v1.UserInfo{Username: "byoh:host:host1"},
+					Object:    runtime.RawExtension{Raw: newByoHostRaw, Object: byoHost},
+					OldObject: runtime.RawExtension{Raw: oldByoHostRaw, Object: oldByoHost},
+				}})
+				Expect(resp.AdmissionResponse.Allowed).To(BeFalse())
+				Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("annotation " + MoveToNamespaceAnnotation + " can only be removed"))
+			})
+		})
 	})
 	Context("When ByoHost gets an delete request", func() {
 		var (
@@ -217,4 +750,61 @@ var _ = Describe("ByohostWebhook/Unit", func() {
 			Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("cannot delete ByoHost when MachineRef is assigned"))
 		})
 	})
+
+	Context("When ByoHost gets a defaulting request", func() {
+		var (
+			byoHost *ByoHost
+			d       *ByoHostDefaulter
+		)
+		BeforeEach(func() {
+			d = &ByoHostDefaulter{decoder: decoder}
+			byoHost = &ByoHost{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "ByoHost",
+					APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "host1",
+					Namespace: "default",
+					Labels: map[string]string{
+						" site ":                   " apac",
+						"cores":                    "2",
+						clusterv1.ClusterNameLabel: "cluster1",
+					},
+					Annotations: map[string]string{
+						ManagedLabelsAnnotation: "site, cores,cores,memory," + clusterv1.ClusterNameLabel,
+					},
+				},
+			}
+		})
+		It("Should trim the labels and normalize the managed labels", func() {
+			normalizeLabels(byoHost)
+			Expect(byoHost.Labels).To(Equal(map[string]string{
+				"site":                     "apac",
+				"cores":                    "2",
+				clusterv1.ClusterNameLabel: "cluster1",
+			}))
+			Expect(byoHost.Annotations[ManagedLabelsAnnotation]).To(Equal("cores,site"))
+		})
+		It("Should remove the managed labels annotation when no managed label is set", func() {
+			byoHost.Annotations[ManagedLabelsAnnotation] = "memory"
+			normalizeLabels(byoHost)
+			Expect(byoHost.Annotations).NotTo(HaveKey(ManagedLabelsAnnotation))
+		})
+		It("Should patch the ByoHost", func() {
+			byoHostRaw, err := json.Marshal(byoHost)
+			Expect(err).ShouldNot(HaveOccurred())
+			admissionRequest := admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				UserInfo:  v1.UserInfo{Username: "byoh:host:host1"},
+				Object: runtime.RawExtension{
+					Raw:    byoHostRaw,
+					Object: byoHost,
+				},
+			}
+			resp := d.Handle(context.TODO(), admission.Request{AdmissionRequest: admissionRequest})
+			Expect(resp.AdmissionResponse.Allowed).To(BeTrue())
+			Expect(resp.Patches).NotTo(BeEmpty())
+		})
+	})
 })
@@ -5,10 +5,12 @@ package v1beta1_test
 
 import (
 	"context"
+	b64 "encoding/base64"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	byohv1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/builder"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -124,6 +126,58 @@ var _ = Describe("ByohostWebhook", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("is not a valid agent username"))
 		})
+
+		It("should reject the fields of the controller manager set by the agent", func() {
+			byoHost.Spec.BootstrapSecret = &corev1.ObjectReference{Name: "bootstrap-secret", Namespace: "other-tenant"}
+			err := ValidUserK8sClient.Create(ctx, byoHost)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("cannot create resource host1: spec.bootstrapSecret can only be cleared"))
+		})
+
+		Context("When the host was bootstrapped with a token bound to another namespace", func() {
+			var bootstrapKubeconfig *byohv1beta1.BootstrapKubeconfig
+
+			BeforeEach(func() {
+				bootstrapKubeconfig = builder.BootstrapKubeconfig("default", "bootstrap-kubeconfig").
+					WithServer("https://abc.com:1234").
+					WithCAData(b64.StdEncoding.EncodeToString(cfg.CAData)).
+					WithTargetNamespace("byoh-pool").
+					Build()
+				Expect(k8sClient.Create(ctx, bootstrapKubeconfig)).Should(Succeed())
+				bootstrapKubeconfig.Status.RegisteredHosts = []byohv1beta1.RegisteredHost{{HostName: byoHost.Name, TokenID: "abcdef"}}
+				Expect(k8sClient.Status().Update(ctx, bootstrapKubeconfig)).Should(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(k8sClient.Delete(ctx, bootstrapKubeconfig)).Should(Succeed())
+			})
+
+			It("should reject the request", func() {
+				Eventually(func() string {
+					err := ValidUserK8sClient.Create(ctx, byoHost)
+					if err == nil {
+						Expect(ValidUserK8sClient.Delete(ctx, byoHost)).Should(Succeed())
+						return ""
+					}
+					return err.Error()
+				}).Should(ContainSubstring("host host1 was bootstrapped for the namespaces byoh-pool, not default"))
+			})
+
+			It("should allow the namespace an operator moves the host to", func() {
+				pool := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "byoh-pool"}}
+				Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, pool))).Should(Succeed())
+				pooledHost := byoHost.DeepCopy()
+				pooledHost.Namespace = pool.Name
+				Eventually(func() error { return ValidUserK8sClient.Create(ctx, pooledHost) }).Should(Succeed())
+				pooledHost.Annotations = map[string]string{byohv1beta1.MoveToNamespaceAnnotation: "default"}
+				Expect(k8sClient.Update(ctx, pooledHost)).Should(Succeed())
+
+				Eventually(func() error { return ValidUserK8sClient.Create(ctx, byoHost) }).Should(Succeed())
+				// cleanup
+				Expect(ValidUserK8sClient.Delete(ctx, byoHost)).Should(Succeed())
+				Expect(ValidUserK8sClient.Delete(ctx, pooledHost)).Should(Succeed())
+			})
+		})
 	})
 	Context("When ByoHost gets a update request", func() {
 		var (
@@ -0,0 +1,66 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ByoHostAdmissionPolicySpec defines the hosts whose CSRs the ByoAdmission controller approves
+type ByoHostAdmissionPolicySpec struct {
+	// HostNamePatterns are shell patterns, e.g. "web-*", one of which the host name must match.
+	// Any host name matches if empty.
+	// +optional
+	HostNamePatterns []string `json:"hostNamePatterns,omitempty"`
+
+	// Namespaces restricts the policy to the hosts bootstrapped with a BootstrapKubeconfig of
+	// one of these namespaces, or, for certificate renewals, to the hosts with a ByoHost in one
+	// of these namespaces. Any namespace matches if empty.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// BootstrapTokenID restricts the policy to the CSRs requested with this bootstrap token.
+	// It is not checked on the certificate renewals of registered hosts, which match on the
+	// Namespaces of their ByoHosts instead.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]{6}$`
+	BootstrapTokenID string `json:"bootstrapTokenID,omitempty"`
+
+	// MaxCertificateDuration is the longest certificate lifetime the matching hosts can request.
+	// It cannot raise the maximum set on the controller manager.
+	// +optional
+	MaxCertificateDuration *metav1.Duration `json:"maxCertificateDuration,omitempty"`
+
+	// ManualApproval leaves the CSRs of the matching hosts pending, to be approved by an administrator.
+	// +optional
+	ManualApproval bool `json:"manualApproval,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:path=byohostadmissionpolicies,scope=Cluster,shortName=byohap
+//+kubebuilder:printcolumn:name="Token",type="string",JSONPath=".spec.bootstrapTokenID"
+//+kubebuilder:printcolumn:name="MaxDuration",type="string",JSONPath=".spec.maxCertificateDuration"
+//+kubebuilder:printcolumn:name="Manual",type="boolean",JSONPath=".spec.manualApproval"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ByoHostAdmissionPolicy is the Schema for the byohostadmissionpolicies API
+type ByoHostAdmissionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ByoHostAdmissionPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ByoHostAdmissionPolicyList contains a list of ByoHostAdmissionPolicy
+type ByoHostAdmissionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ByoHostAdmissionPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ByoHostAdmissionPolicy{}, &ByoHostAdmissionPolicyList{})
+}
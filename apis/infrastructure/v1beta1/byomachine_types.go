@@ -7,6 +7,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 )
 
 const (
@@ -27,6 +28,27 @@ type ByoMachineSpec struct {
 	// the details of InstallationSecret to be used to install BYOH Bundle.
 	// +optional
 	InstallerRef *corev1.ObjectReference `json:"installerRef,omitempty"`
+
+	// SecondaryIPAddresses are IP addresses claimed from IPAM pools for the machine, they are configured
+	// on the host in addition to its own addresses while it is attached to the machine
+	// +optional
+	SecondaryIPAddresses []SecondaryIPAddressSpec `json:"secondaryIPAddresses,omitempty"`
+
+	// AddressPolicy selects the addresses of the attached host published as the internal IPs of the machine,
+	// the addresses of the default network interface of the host if not set
+	// +optional
+	AddressPolicy *MachineAddressPolicy `json:"addressPolicy,omitempty"`
+}
+
+// SecondaryIPAddressSpec defines an IP address claimed from an IPAM pool for a machine
+type SecondaryIPAddressSpec struct {
+	// PoolRef is a reference to the IPAM pool the address is claimed from
+	PoolRef corev1.TypedLocalObjectReference `json:"poolRef"`
+
+	// Interface is the network interface of the host the address is configured on,
+	// the default network interface of the host if not set
+	// +optional
+	Interface string `json:"interface,omitempty"`
 }
 
 // NetworkStatus provides information about one of a VM's networks.
@@ -51,6 +73,18 @@ type NetworkStatus struct {
 	IsDefault bool `json:"isDefault,omitempty"`
 }
 
+// MachineAddressPolicy selects the addresses of a host published as the internal IPs of its machine
+type MachineAddressPolicy struct {
+	// Interface is the network interface of the host whose addresses are internal IPs
+	// +optional
+	Interface string `json:"interface,omitempty"`
+
+	// CIDRs restricts the internal IPs to the addresses within one of these CIDRs,
+	// on any network interface of the host unless Interface is set
+	// +optional
+	CIDRs []string `json:"cidrs,omitempty"`
+}
+
 // ByoMachineStatus defines the observed state of ByoMachine
 type ByoMachineStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -63,6 +97,19 @@ type ByoMachineStatus struct {
 	// +optional
 	Ready bool `json:"ready"`
 
+	// Addresses are the internal IPs of the attached host selected by the address policy and its host name
+	// +optional
+	Addresses clusterv1.MachineAddresses `json:"addresses,omitempty"`
+
+	// FailureReason is set when the attached host fails in a way the agent does not recover from,
+	// e.g. the bootstrap of the node fails, so that the machine gets remediated
+	// +optional
+	FailureReason *capierrors.MachineStatusError `json:"failureReason,omitempty"`
+
+	// FailureMessage is a human readable description of the failure of the attached host
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
 	// Conditions defines current service state of the BYOMachine.
 	// +optional
 	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
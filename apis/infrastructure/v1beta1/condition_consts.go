@@ -40,6 +40,11 @@ const (
 	// that are part of the cloud-config file
 	CloudInitExecutionFailedReason = "CloudInitExecutionFailed"
 
+	// K8sNodeBootstrapRetriesExhaustedReason indicates that the agent gave up installing the k8s components or
+	// bootstrapping the k8s node after failing too many times in a row, the host needs to be fixed and its
+	// machine remediated
+	K8sNodeBootstrapRetriesExhaustedReason = "K8sNodeBootstrapRetriesExhausted"
+
 	// K8sNodeAbsentReason indicates that the node is not a Kubernetes node
 	// This is usually set after executing kubeadm reset on the node
 	K8sNodeAbsentReason = "K8sNodeAbsent"
@@ -52,6 +57,14 @@ const (
 	// K8sComponentsInstallationFailedReason indicates that the installer failed to install all the
 	// k8s components on this host
 	K8sComponentsInstallationFailedReason = "K8sComponentsInstallationFailed"
+
+	// LoadBalancerConfigured documents if the host serves the load balancer of a ByoCluster
+	// with the HAProxy configuration of its load balancer secret
+	LoadBalancerConfigured clusterv1.ConditionType = "LoadBalancerConfigured"
+
+	// LoadBalancerConfigurationFailedReason indicates that the HAProxy configuration could not be
+	// written or HAProxy could not be reloaded
+	LoadBalancerConfigurationFailedReason = "LoadBalancerConfigurationFailed"
 )
 
 // Conditions and Reasons defined on BYOMachine
@@ -75,6 +88,70 @@ const (
 	// InstallationSecretNotAvailableReason indicates that the installation secret is not yet
 	// generated for a given BYOMachine
 	InstallationSecretNotAvailableReason = "InstallationSecretNotAvailable"
+
+	// WaitingForNodeReason indicates that the attached host is yet to register its Node
+	// in the workload cluster for the ByoMachine to set its providerID
+	WaitingForNodeReason = "WaitingForNode"
+
+	// ByoHostFailedReason indicates that the agent of the attached host gave up bootstrapping the k8s node,
+	// the ByoMachine is failed so that it gets remediated
+	ByoHostFailedReason = "ByoHostFailed"
+
+	// ByoHostDegradedReason indicates that the attached host failed in a way the agent retries,
+	// e.g. the installation of the k8s components or the bootstrap of the k8s node
+	ByoHostDegradedReason = "ByoHostDegraded"
+)
+
+// Conditions and Reasons defined on BootstrapKubeconfig
+const (
+	// BootstrapTokenValid documents if the bootstrap token of the BootstrapKubeconfig
+	// can still be used by a host to request its client certificate
+	BootstrapTokenValid clusterv1.ConditionType = "BootstrapTokenValid"
+
+	// BootstrapTokenExpiredReason indicates that the bootstrap token expired,
+	// a new one can be requested with the regenerate-token annotation
+	BootstrapTokenExpiredReason = "BootstrapTokenExpired"
+
+	// BootstrapTokenNotFoundReason indicates that the secret of the bootstrap token
+	// was deleted from kube-system before it expired
+	BootstrapTokenNotFoundReason = "BootstrapTokenNotFound"
+)
+
+// Conditions and Reasons defined on ByoCluster
+const (
+	// KubeVIPReady documents if the kube-vip configuration of the ByoCluster is valid
+	// and its VIP is not used by another cluster or host
+	KubeVIPReady clusterv1.ConditionType = "KubeVIPReady"
+
+	// InvalidKubeVIPConfigReason indicates that the kube-vip configuration of the ByoCluster is invalid
+	InvalidKubeVIPConfigReason = "InvalidKubeVIPConfig"
+
+	// KubeVIPAddressInUseReason indicates that the VIP of the ByoCluster is already used
+	// by the control plane endpoint of another cluster or by a host
+	KubeVIPAddressInUseReason = "KubeVIPAddressInUse"
+
+	// LoadBalancerReady documents if the load balancer of the control plane endpoint of the ByoCluster
+	// is configured with the control plane machines
+	LoadBalancerReady clusterv1.ConditionType = "LoadBalancerReady"
+
+	// InvalidLoadBalancerConfigReason indicates that the load balancer configuration of the ByoCluster is invalid
+	InvalidLoadBalancerConfigReason = "InvalidLoadBalancerConfig"
+
+	// LoadBalancerHostsUnavailableReason indicates that no ByoHost is available to run the load balancer
+	LoadBalancerHostsUnavailableReason = "LoadBalancerHostsUnavailable"
+
+	// LoadBalancerFailedReason indicates that the load balancer provider failed to configure the load balancer
+	LoadBalancerFailedReason = "LoadBalancerFailed"
+)
+
+// Conditions and Reasons defined on ByoCluster and ByoMachine
+const (
+	// IPAddressesClaimed documents if the IP addresses claimed from IPAM pools, i.e. the control plane
+	// endpoint of a ByoCluster or the secondary IP addresses of a ByoMachine, are allocated
+	IPAddressesClaimed clusterv1.ConditionType = "IPAddressesClaimed"
+
+	// WaitingForIPAddressReason indicates that an IPAddressClaim is not yet allocated by its IPAM provider
+	WaitingForIPAddressReason = "WaitingForIPAddress"
 )
 
 // Reasons common to all Byo Resources
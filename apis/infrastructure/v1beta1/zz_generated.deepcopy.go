@@ -13,6 +13,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	apiv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/errors"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -35,7 +36,7 @@ func (in *BootstrapKubeconfig) DeepCopyInto(out *BootstrapKubeconfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -92,6 +93,21 @@ func (in *BootstrapKubeconfigList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BootstrapKubeconfigSpec) DeepCopyInto(out *BootstrapKubeconfigSpec) {
 	*out = *in
+	if in.HostNamePatterns != nil {
+		in, out := &in.HostNamePatterns, &out.HostNamePatterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxUsages != nil {
+		in, out := &in.MaxUsages, &out.MaxUsages
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BootstrapKubeconfigSpec.
@@ -112,6 +128,27 @@ func (in *BootstrapKubeconfigStatus) DeepCopyInto(out *BootstrapKubeconfigStatus
 		*out = new(string)
 		**out = **in
 	}
+	if in.BootstrapKubeconfigSecretRef != nil {
+		in, out := &in.BootstrapKubeconfigSecretRef, &out.BootstrapKubeconfigSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.RegisteredHosts != nil {
+		in, out := &in.RegisteredHosts, &out.RegisteredHosts
+		*out = make([]RegisteredHost, len(*in))
+		copy(*out, *in)
+	}
+	if in.TokenExpirationTime != nil {
+		in, out := &in.TokenExpirationTime, &out.TokenExpirationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1beta1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BootstrapKubeconfigStatus.
@@ -129,7 +166,7 @@ func (in *ByoCluster) DeepCopyInto(out *ByoCluster) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -187,6 +224,21 @@ func (in *ByoClusterList) DeepCopyObject() runtime.Object {
 func (in *ByoClusterSpec) DeepCopyInto(out *ByoClusterSpec) {
 	*out = *in
 	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	if in.KubeVIP != nil {
+		in, out := &in.KubeVIP, &out.KubeVIP
+		*out = new(KubeVIPSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LoadBalancer != nil {
+		in, out := &in.LoadBalancer, &out.LoadBalancer
+		*out = new(LoadBalancerSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ControlPlaneEndpointIPPool != nil {
+		in, out := &in.ControlPlaneEndpointIPPool, &out.ControlPlaneEndpointIPPool
+		*out = new(v1.TypedLocalObjectReference)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoClusterSpec.
@@ -290,7 +342,7 @@ func (in *ByoClusterTemplateList) DeepCopyObject() runtime.Object {
 func (in *ByoClusterTemplateResource) DeepCopyInto(out *ByoClusterTemplateResource) {
 	*out = *in
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoClusterTemplateResource.
@@ -346,6 +398,94 @@ func (in *ByoHost) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ByoHostAdmissionPolicy) DeepCopyInto(out *ByoHostAdmissionPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoHostAdmissionPolicy.
+func (in *ByoHostAdmissionPolicy) DeepCopy() *ByoHostAdmissionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ByoHostAdmissionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ByoHostAdmissionPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ByoHostAdmissionPolicyList) DeepCopyInto(out *ByoHostAdmissionPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ByoHostAdmissionPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoHostAdmissionPolicyList.
+func (in *ByoHostAdmissionPolicyList) DeepCopy() *ByoHostAdmissionPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ByoHostAdmissionPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ByoHostAdmissionPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ByoHostAdmissionPolicySpec) DeepCopyInto(out *ByoHostAdmissionPolicySpec) {
+	*out = *in
+	if in.HostNamePatterns != nil {
+		in, out := &in.HostNamePatterns, &out.HostNamePatterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxCertificateDuration != nil {
+		in, out := &in.MaxCertificateDuration, &out.MaxCertificateDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoHostAdmissionPolicySpec.
+func (in *ByoHostAdmissionPolicySpec) DeepCopy() *ByoHostAdmissionPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ByoHostAdmissionPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ByoHostList) DeepCopyInto(out *ByoHostList) {
 	*out = *in
@@ -396,6 +536,16 @@ func (in *ByoHostSpec) DeepCopyInto(out *ByoHostSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.LoadBalancerSecret != nil {
+		in, out := &in.LoadBalancerSecret, &out.LoadBalancerSecret
+		*out = new(v1.ObjectReference)
+		**out = **in
+	}
+	if in.SecondaryIPAddresses != nil {
+		in, out := &in.SecondaryIPAddresses, &out.SecondaryIPAddresses
+		*out = make([]HostIPAddress, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoHostSpec.
@@ -431,6 +581,11 @@ func (in *ByoHostStatus) DeepCopyInto(out *ByoHostStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.HostIdentity != nil {
+		in, out := &in.HostIdentity, &out.HostIdentity
+		*out = new(HostIdentity)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoHostStatus.
@@ -515,6 +670,18 @@ func (in *ByoMachineSpec) DeepCopyInto(out *ByoMachineSpec) {
 		*out = new(v1.ObjectReference)
 		**out = **in
 	}
+	if in.SecondaryIPAddresses != nil {
+		in, out := &in.SecondaryIPAddresses, &out.SecondaryIPAddresses
+		*out = make([]SecondaryIPAddressSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AddressPolicy != nil {
+		in, out := &in.AddressPolicy, &out.AddressPolicy
+		*out = new(MachineAddressPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoMachineSpec.
@@ -531,6 +698,21 @@ func (in *ByoMachineSpec) DeepCopy() *ByoMachineSpec {
 func (in *ByoMachineStatus) DeepCopyInto(out *ByoMachineStatus) {
 	*out = *in
 	out.HostInfo = in.HostInfo
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make(apiv1beta1.MachineAddresses, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailureReason != nil {
+		in, out := &in.FailureReason, &out.FailureReason
+		*out = new(errors.MachineStatusError)
+		**out = **in
+	}
+	if in.FailureMessage != nil {
+		in, out := &in.FailureMessage, &out.FailureMessage
+		*out = new(string)
+		**out = **in
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make(apiv1beta1.Conditions, len(*in))
@@ -656,6 +838,56 @@ func (in *ByoMachineTemplateStatus) DeepCopy() *ByoMachineTemplateStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HAProxyLoadBalancerSpec) DeepCopyInto(out *HAProxyLoadBalancerSpec) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HAProxyLoadBalancerSpec.
+func (in *HAProxyLoadBalancerSpec) DeepCopy() *HAProxyLoadBalancerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HAProxyLoadBalancerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostIPAddress) DeepCopyInto(out *HostIPAddress) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostIPAddress.
+func (in *HostIPAddress) DeepCopy() *HostIPAddress {
+	if in == nil {
+		return nil
+	}
+	out := new(HostIPAddress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostIdentity) DeepCopyInto(out *HostIdentity) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostIdentity.
+func (in *HostIdentity) DeepCopy() *HostIdentity {
+	if in == nil {
+		return nil
+	}
+	out := new(HostIdentity)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HostInfo) DeepCopyInto(out *HostInfo) {
 	*out = *in
@@ -871,6 +1103,86 @@ func (in *K8sInstallerConfigTemplateStatus) DeepCopy() *K8sInstallerConfigTempla
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeVIPBGPSpec) DeepCopyInto(out *KubeVIPBGPSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeVIPBGPSpec.
+func (in *KubeVIPBGPSpec) DeepCopy() *KubeVIPBGPSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeVIPBGPSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeVIPSpec) DeepCopyInto(out *KubeVIPSpec) {
+	*out = *in
+	if in.BGP != nil {
+		in, out := &in.BGP, &out.BGP
+		*out = new(KubeVIPBGPSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeVIPSpec.
+func (in *KubeVIPSpec) DeepCopy() *KubeVIPSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeVIPSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerSpec) DeepCopyInto(out *LoadBalancerSpec) {
+	*out = *in
+	if in.HAProxy != nil {
+		in, out := &in.HAProxy, &out.HAProxy
+		*out = new(HAProxyLoadBalancerSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(WebhookLoadBalancerSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerSpec.
+func (in *LoadBalancerSpec) DeepCopy() *LoadBalancerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachineAddressPolicy) DeepCopyInto(out *MachineAddressPolicy) {
+	*out = *in
+	if in.CIDRs != nil {
+		in, out := &in.CIDRs, &out.CIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineAddressPolicy.
+func (in *MachineAddressPolicy) DeepCopy() *MachineAddressPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(MachineAddressPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkStatus) DeepCopyInto(out *NetworkStatus) {
 	*out = *in
@@ -890,3 +1202,54 @@ func (in *NetworkStatus) DeepCopy() *NetworkStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegisteredHost) DeepCopyInto(out *RegisteredHost) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegisteredHost.
+func (in *RegisteredHost) DeepCopy() *RegisteredHost {
+	if in == nil {
+		return nil
+	}
+	out := new(RegisteredHost)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecondaryIPAddressSpec) DeepCopyInto(out *SecondaryIPAddressSpec) {
+	*out = *in
+	in.PoolRef.DeepCopyInto(&out.PoolRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecondaryIPAddressSpec.
+func (in *SecondaryIPAddressSpec) DeepCopy() *SecondaryIPAddressSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SecondaryIPAddressSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookLoadBalancerSpec) DeepCopyInto(out *WebhookLoadBalancerSpec) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookLoadBalancerSpec.
+func (in *WebhookLoadBalancerSpec) DeepCopy() *WebhookLoadBalancerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookLoadBalancerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
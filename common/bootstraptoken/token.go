@@ -77,7 +77,7 @@ func GenerateBootstrapKubeconfigFromBootstrapToken(tokenStr string, bootstrapKub
 		Contexts: map[string]*clientcmdapi.Context{infrastructurev1beta1.DefaultContext: {
 			Cluster:   infrastructurev1beta1.DefaultClusterName,
 			AuthInfo:  infrastructurev1beta1.DefaultAuth,
-			Namespace: infrastructurev1beta1.DefaultNamespace,
+			Namespace: bootstrapKubeconfig.TokenNamespace(),
 		}},
 		CurrentContext: infrastructurev1beta1.DefaultContext,
 	}
@@ -0,0 +1,175 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package encryption encrypts the bootstrap data of a host to the public key the host agent
+// publishes in the ByoHost status, so that only the host can decrypt it.
+//
+// The data is encrypted with a random AES-256-GCM key, which is itself encrypted with RSA-OAEP.
+// The encrypted data is the big endian length of the encrypted key on two bytes, followed by the
+// encrypted key, the nonce and the sealed data.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/util/keyutil"
+)
+
+const (
+	// KeySize is the size of the RSA keys of the hosts
+	KeySize = 3072
+	// PublicKeyBlockType is the PEM block type of the published public keys
+	PublicKeyBlockType = "PUBLIC KEY"
+
+	dataKeySize   = 32
+	keyLengthSize = 2
+)
+
+// GenerateKey generates a new RSA private key
+func GenerateKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, KeySize)
+}
+
+// LoadOrGenerateKeyFile returns the RSA private key stored in the PEM file at path,
+// generating it and writing it with 0600 permissions if the file does not exist
+func LoadOrGenerateKeyFile(path string) (*rsa.PrivateKey, error) {
+	keyData, err := os.ReadFile(path)
+	if err == nil {
+		return ParsePrivateKeyPEM(keyData)
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error loading encryption key from %s: %v", path, err)
+	}
+
+	privateKey, err := GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("error generating encryption key: %v", err)
+	}
+	keyData = pem.EncodeToMemory(&pem.Block{Type: keyutil.RSAPrivateKeyBlockType, Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil { //nolint: gomnd
+		return nil, err
+	}
+	if err = os.WriteFile(path, keyData, 0o600); err != nil { //nolint: gomnd
+		return nil, fmt.Errorf("error writing encryption key to %s: %v", path, err)
+	}
+	return privateKey, nil
+}
+
+// ParsePrivateKeyPEM returns the RSA private key of the PEM data
+func ParsePrivateKeyPEM(keyData []byte) (*rsa.PrivateKey, error) {
+	key, err := keyutil.ParsePrivateKeyPEM(keyData)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("encryption key is not an RSA private key")
+	}
+	return privateKey, nil
+}
+
+// EncodePublicKey returns the PEM encoded public key of the private key
+func EncodePublicKey(privateKey *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: PublicKeyBlockType, Bytes: der})), nil
+}
+
+// ParsePublicKey returns the RSA public key of the PEM encoded public key
+func ParsePublicKey(publicKeyPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil || block.Type != PublicKeyBlockType {
+		return nil, fmt.Errorf("public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an RSA public key")
+	}
+	return publicKey, nil
+}
+
+// Encrypt encrypts the data to the PEM encoded public key
+func Encrypt(publicKeyPEM string, data []byte) ([]byte, error) {
+	publicKey, err := ParsePublicKey(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err = rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, dataKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	encrypted := make([]byte, keyLengthSize, keyLengthSize+len(encryptedKey)+len(nonce)+len(data)+gcm.Overhead())
+	binary.BigEndian.PutUint16(encrypted, uint16(len(encryptedKey)))
+	encrypted = append(encrypted, encryptedKey...)
+	encrypted = append(encrypted, nonce...)
+	return gcm.Seal(encrypted, nonce, data, nil), nil
+}
+
+// Decrypt decrypts the data encrypted to the public key of the private key
+func Decrypt(privateKey *rsa.PrivateKey, encrypted []byte) ([]byte, error) {
+	if len(encrypted) < keyLengthSize {
+		return nil, errors.New("encrypted data is too short")
+	}
+	keyLength := int(binary.BigEndian.Uint16(encrypted))
+	encrypted = encrypted[keyLengthSize:]
+	if len(encrypted) < keyLength {
+		return nil, errors.New("encrypted data is too short")
+	}
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encrypted[:keyLength], nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data key: %v", err)
+	}
+	encrypted = encrypted[keyLength:]
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	data, err := gcm.Open(nil, encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data: %v", err)
+	}
+	return data, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
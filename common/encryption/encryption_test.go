@@ -0,0 +1,79 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package encryption_test
+
+import (
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/encryption"
+)
+
+var _ = Describe("Encryption", func() {
+	var (
+		privateKey *rsa.PrivateKey
+		publicKey  string
+		data       = []byte("kubeadm join --token abcdef.0123456789abcdef")
+	)
+
+	BeforeEach(func() {
+		var err error
+		privateKey, err = encryption.GenerateKey()
+		Expect(err).NotTo(HaveOccurred())
+		publicKey, err = encryption.EncodePublicKey(privateKey)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should decrypt the data encrypted to the public key", func() {
+		encrypted, err := encryption.Encrypt(publicKey, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(encrypted)).NotTo(ContainSubstring("kubeadm"))
+
+		decrypted, err := encryption.Decrypt(privateKey, encrypted)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decrypted).To(Equal(data))
+	})
+
+	It("should not decrypt the data with another key", func() {
+		encrypted, err := encryption.Encrypt(publicKey, data)
+		Expect(err).NotTo(HaveOccurred())
+		otherKey, err := encryption.GenerateKey()
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = encryption.Decrypt(otherKey, encrypted)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject tampered data", func() {
+		encrypted, err := encryption.Encrypt(publicKey, data)
+		Expect(err).NotTo(HaveOccurred())
+		encrypted[len(encrypted)-1] ^= 0xff
+
+		_, err = encryption.Decrypt(privateKey, encrypted)
+		Expect(err).To(HaveOccurred())
+		_, err = encryption.Decrypt(privateKey, encrypted[:1])
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject an invalid public key", func() {
+		_, err := encryption.Encrypt("not a public key", data)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should load the generated key file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "byoh", "encryption.key")
+		generated, err := encryption.LoadOrGenerateKeyFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+
+		loaded, err := encryption.LoadOrGenerateKeyFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Equal(generated)).To(BeTrue())
+	})
+})
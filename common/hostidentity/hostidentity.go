@@ -0,0 +1,116 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package hostidentity collects the facts identifying the machine of a host, and carries them
+// in an extension of the certificate signing requests of the host agent.
+package hostidentity
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+)
+
+var (
+	// ExtensionOID is the OID of the CSR extension holding the JSON encoded HostIdentity of the host
+	ExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 6876, 61, 1}
+
+	// MachineIDPaths are the files the machine ID is read from, in order
+	MachineIDPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+	// ProductUUIDPath is the file the DMI product UUID is read from
+	ProductUUIDPath = "/sys/class/dmi/id/product_uuid"
+	// SSHHostKeyPaths are the public SSH host keys, in order of preference
+	SSHHostKeyPaths = []string{"/etc/ssh/ssh_host_ed25519_key.pub", "/etc/ssh/ssh_host_ecdsa_key.pub", "/etc/ssh/ssh_host_rsa_key.pub"}
+)
+
+// Collect returns the identity of the machine, reading its files with readFile.
+// The facts that cannot be read are left empty, nil is returned if none can be read.
+func Collect(readFile func(string) ([]byte, error)) *infrastructurev1beta1.HostIdentity {
+	identity := &infrastructurev1beta1.HostIdentity{}
+	for _, path := range MachineIDPaths {
+		if data, err := readFile(path); err == nil && strings.TrimSpace(string(data)) != "" {
+			identity.MachineID = strings.TrimSpace(string(data))
+			break
+		}
+	}
+	if data, err := readFile(ProductUUIDPath); err == nil {
+		identity.ProductUUID = strings.ToLower(strings.TrimSpace(string(data)))
+	}
+	for _, path := range SSHHostKeyPaths {
+		data, err := readFile(path)
+		if err != nil {
+			continue
+		}
+		if fingerprint, err := Fingerprint(data); err == nil {
+			identity.SSHHostKeyFingerprint = fingerprint
+			break
+		}
+	}
+	if *identity == (infrastructurev1beta1.HostIdentity{}) {
+		return nil
+	}
+	return identity
+}
+
+// Fingerprint returns the SHA256 fingerprint of a public key in the authorized_keys format,
+// e.g. SHA256:I7Y1v2kCSSsjfvybTCtS0E//Hc9jYtPOG7KE/BtXANI
+func Fingerprint(publicKey []byte) (string, error) {
+	fields := strings.Fields(string(publicKey))
+	if len(fields) < 2 { //nolint: gomnd
+		return "", fmt.Errorf("public key is not in the authorized_keys format")
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %v", err)
+	}
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// Extension returns the CSR extension holding the identity
+func Extension(identity *infrastructurev1beta1.HostIdentity) (pkix.Extension, error) {
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	value, err := asn1.MarshalWithParams(string(data), "utf8")
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: ExtensionOID, Value: value}, nil
+}
+
+// FromCertificateRequest returns the identity held in the extension of the request, nil if it has none
+func FromCertificateRequest(request *x509.CertificateRequest) (*infrastructurev1beta1.HostIdentity, error) {
+	for _, extension := range request.Extensions {
+		if !extension.Id.Equal(ExtensionOID) {
+			continue
+		}
+		var data string
+		if _, err := asn1.UnmarshalWithParams(extension.Value, &data, "utf8"); err != nil {
+			return nil, fmt.Errorf("invalid host identity extension: %v", err)
+		}
+		identity := &infrastructurev1beta1.HostIdentity{}
+		if err := json.Unmarshal([]byte(data), identity); err != nil {
+			return nil, fmt.Errorf("invalid host identity extension: %v", err)
+		}
+		return identity, nil
+	}
+	return nil, nil
+}
+
+// Matches returns true if the identity presented by a host is the recorded one.
+// Any identity matches when none is recorded.
+func Matches(recorded, presented *infrastructurev1beta1.HostIdentity) bool {
+	if recorded == nil {
+		return true
+	}
+	return presented != nil && *recorded == *presented
+}
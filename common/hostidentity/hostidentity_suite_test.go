@@ -0,0 +1,16 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package hostidentity_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestHostIdentity(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HostIdentity Suite")
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package hostidentity_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/hostidentity"
+)
+
+const sshHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIsxHOcgAJER1ogiajoDaerOZU2+kdcp2Vi05HY0TOH0 root@host\n"
+
+var _ = Describe("Host identity", func() {
+	var files map[string]string
+
+	readFile := func(path string) ([]byte, error) {
+		if content, ok := files[path]; ok {
+			return []byte(content), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	BeforeEach(func() {
+		files = map[string]string{
+			"/etc/machine-id":                   "0123456789abcdef0123456789abcdef\n",
+			"/sys/class/dmi/id/product_uuid":    "4C4C4544-0042-3510-8050-B2C04F564432\n",
+			"/etc/ssh/ssh_host_ecdsa_key.pub":   "not a key",
+			"/etc/ssh/ssh_host_ed25519_key.pub": sshHostKey,
+		}
+	})
+
+	It("should collect the facts of the machine", func() {
+		Expect(hostidentity.Collect(readFile)).To(Equal(&infrastructurev1beta1.HostIdentity{
+			MachineID:             "0123456789abcdef0123456789abcdef",
+			ProductUUID:           "4c4c4544-0042-3510-8050-b2c04f564432",
+			SSHHostKeyFingerprint: "SHA256:I7Y1v2kCSSsjfvybTCtS0E//Hc9jYtPOG7KE/BtXANI",
+		}))
+	})
+
+	It("should collect the facts that can be read", func() {
+		files = map[string]string{
+			"/var/lib/dbus/machine-id":        "0123456789abcdef0123456789abcdef",
+			"/etc/ssh/ssh_host_ecdsa_key.pub": "not a key",
+		}
+		Expect(hostidentity.Collect(readFile)).To(Equal(&infrastructurev1beta1.HostIdentity{
+			MachineID: "0123456789abcdef0123456789abcdef",
+		}))
+
+		files = map[string]string{}
+		Expect(hostidentity.Collect(readFile)).To(BeNil())
+	})
+
+	It("should carry the identity in the certificate request", func() {
+		identity := hostidentity.Collect(readFile)
+		extension, err := hostidentity.Extension(identity)
+		Expect(err).NotTo(HaveOccurred())
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		csrData, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:         pkix.Name{CommonName: "byoh:host:test-host"},
+			ExtraExtensions: []pkix.Extension{extension},
+		}, privateKey)
+		Expect(err).NotTo(HaveOccurred())
+		request, err := x509.ParseCertificateRequest(csrData)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(hostidentity.FromCertificateRequest(request)).To(Equal(identity))
+		Expect(hostidentity.FromCertificateRequest(&x509.CertificateRequest{})).To(BeNil())
+	})
+
+	It("should only match the recorded identity", func() {
+		recorded := hostidentity.Collect(readFile)
+		other := recorded.DeepCopy()
+		other.MachineID = "fedcba9876543210fedcba9876543210"
+
+		Expect(hostidentity.Matches(nil, nil)).To(BeTrue())
+		Expect(hostidentity.Matches(nil, other)).To(BeTrue())
+		Expect(hostidentity.Matches(recorded, recorded.DeepCopy())).To(BeTrue())
+		Expect(hostidentity.Matches(recorded, other)).To(BeFalse())
+		Expect(hostidentity.Matches(recorded, nil)).To(BeFalse())
+	})
+})
@@ -6,17 +6,26 @@ package controllers
 import (
 	"context"
 	b64 "encoding/base64"
+	"fmt"
 	"time"
 
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/bootstraptoken"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
 	clientcmdlatest "k8s.io/client-go/tools/clientcmd/api/latest"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
 	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -27,17 +36,18 @@ type BootstrapKubeconfigReconciler struct {
 }
 
 const (
-	// ttl is the time to live for the generated bootstrap token
+	// ttl is the default time to live for the generated bootstrap token
 	ttl = time.Minute * 30
 )
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=bootstrapkubeconfigs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=bootstrapkubeconfigs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=bootstrapkubeconfigs/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
-func (r *BootstrapKubeconfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *BootstrapKubeconfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
 	logger := log.FromContext(ctx)
 	logger.Info("Reconcile request received")
 
@@ -51,21 +61,71 @@ func (r *BootstrapKubeconfigReconciler) Reconcile(ctx context.Context, req ctrl.
 		return ctrl.Result{}, err
 	}
 
-	// There already is bootstrap-kubeconfig data associated with this object
-	// Do not create secrets again
-	if bootstrapKubeconfig.Status.BootstrapKubeconfigData != nil {
+	helper, err := patch.NewHelper(bootstrapKubeconfig, r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	defer func() {
+		if err := helper.Patch(ctx, bootstrapKubeconfig); err != nil && reterr == nil {
+			reterr = err
+		}
+	}()
+
+	// the token secret is in kube-system and cannot be owned by the BootstrapKubeconfig,
+	// the finalizer deletes it instead of the garbage collector
+	if !bootstrapKubeconfig.DeletionTimestamp.IsZero() {
+		if err = r.revokeToken(ctx, bootstrapKubeconfig); err != nil {
+			return ctrl.Result{}, err
+		}
+		controllerutil.RemoveFinalizer(bootstrapKubeconfig, infrastructurev1beta1.BootstrapKubeconfigFinalizer)
 		return ctrl.Result{}, nil
 	}
+	controllerutil.AddFinalizer(bootstrapKubeconfig, infrastructurev1beta1.BootstrapKubeconfigFinalizer)
+
+	if _, ok := bootstrapKubeconfig.Annotations[infrastructurev1beta1.RegenerateTokenAnnotation]; ok {
+		logger.Info("Regenerating the bootstrap token", "tokenID", tokenID(bootstrapKubeconfig))
+		if err = r.revokeToken(ctx, bootstrapKubeconfig); err != nil {
+			return ctrl.Result{}, err
+		}
+		delete(bootstrapKubeconfig.Annotations, infrastructurev1beta1.RegenerateTokenAnnotation)
+		bootstrapKubeconfig.Status.BootstrapKubeconfigData = nil
+		bootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef = nil
+	}
+
+	// BootstrapKubeconfigs generated before the bootstrap kubeconfig was moved to a secret
+	if bootstrapKubeconfig.Status.BootstrapKubeconfigData != nil {
+		logger.Info("Moving the bootstrap kubeconfig data to a secret")
+		bootstrapKubeconfig.Status.TokenID = tokenID(bootstrapKubeconfig)
+		if err = r.writeKubeconfigSecret(ctx, bootstrapKubeconfig, []byte(*bootstrapKubeconfig.Status.BootstrapKubeconfigData)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// There already is bootstrap-kubeconfig data associated with this object
+	// Do not create secrets again, only check that the token is still valid
+	if bootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef != nil {
+		return r.reconcileTokenValidity(ctx, bootstrapKubeconfig)
+	}
 
 	tokenStr, err := bootstraputil.GenerateBootstrapToken()
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	bootstrapKubeconfigSecret, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, ttl)
+	tokenTTL := ttl
+	if bootstrapKubeconfig.Spec.TTL != nil {
+		tokenTTL = bootstrapKubeconfig.Spec.TTL.Duration
+	}
+	bootstrapKubeconfigSecret, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, tokenTTL)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	// the token secret is in kube-system, the annotations tell the ByoAdmission controller
+	// which namespace the hosts bootstrapped with the token belong to
+	bootstrapKubeconfigSecret.Annotations = map[string]string{
+		infrastructurev1beta1.BootstrapKubeconfigNameAnnotation:      bootstrapKubeconfig.Name,
+		infrastructurev1beta1.BootstrapKubeconfigNamespaceAnnotation: bootstrapKubeconfig.Namespace,
+	}
 
 	// create secret
 	err = r.Client.Create(ctx, bootstrapKubeconfigSecret)
@@ -90,15 +150,127 @@ func (r *BootstrapKubeconfigReconciler) Reconcile(ctx context.Context, req ctrl.
 		return ctrl.Result{}, err
 	}
 
-	helper, err := patch.NewHelper(bootstrapKubeconfig, r.Client)
+	if err = r.writeKubeconfigSecret(ctx, bootstrapKubeconfig, runtimeEncodedBootstrapKubeConfig); err != nil {
+		return ctrl.Result{}, err
+	}
+	bootstrapKubeconfig.Status.TokenID = string(bootstrapKubeconfigSecret.Data[bootstrapapi.BootstrapTokenIDKey])
+	return updateTokenValidity(bootstrapKubeconfig, bootstrapKubeconfigSecret)
+}
+
+// writeKubeconfigSecret writes the bootstrap kubeconfig to the secret of the BootstrapKubeconfig, so that
+// reading it requires the permission to get the secrets of the namespace, not only the BootstrapKubeconfigs.
+// The secret is owned by the BootstrapKubeconfig and deleted with it.
+func (r *BootstrapKubeconfigReconciler) writeKubeconfigSecret(ctx context.Context, bootstrapKubeconfig *infrastructurev1beta1.BootstrapKubeconfig, kubeconfig []byte) error {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      bootstrapKubeconfig.Name + "-bootstrap-kubeconfig",
+		Namespace: bootstrapKubeconfig.Namespace,
+	}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(bootstrapKubeconfig, infrastructurev1beta1.GroupVersion.WithKind("BootstrapKubeconfig")),
+		}
+		secret.Data = map[string][]byte{infrastructurev1beta1.BootstrapKubeconfigSecretKey: kubeconfig}
+		return nil
+	})
 	if err != nil {
+		return fmt.Errorf("failed to write the bootstrap kubeconfig secret %s: %v", secret.Name, err)
+	}
+	bootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef = &corev1.LocalObjectReference{Name: secret.Name}
+	bootstrapKubeconfig.Status.BootstrapKubeconfigData = nil
+	return nil
+}
+
+// reconcileTokenValidity sets the BootstrapTokenValid condition and the expiration time of the token,
+// and requeues the BootstrapKubeconfig for when the token expires
+func (r *BootstrapKubeconfigReconciler) reconcileTokenValidity(ctx context.Context, bootstrapKubeconfig *infrastructurev1beta1.BootstrapKubeconfig) (ctrl.Result, error) {
+	bootstrapKubeconfig.Status.TokenID = tokenID(bootstrapKubeconfig)
+	if bootstrapKubeconfig.Status.TokenID == "" {
+		conditions.MarkFalse(bootstrapKubeconfig, infrastructurev1beta1.BootstrapTokenValid, infrastructurev1beta1.BootstrapTokenNotFoundReason,
+			clusterv1.ConditionSeverityWarning, "the bootstrap kubeconfig data has no bootstrap token")
+		return ctrl.Result{}, nil
+	}
+
+	tokenSecret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      bootstraputil.BootstrapTokenSecretName(bootstrapKubeconfig.Status.TokenID),
+		Namespace: metav1.NamespaceSystem,
+	}, tokenSecret)
+	switch {
+	case err == nil:
+		return updateTokenValidity(bootstrapKubeconfig, tokenSecret)
+	case apierrors.IsNotFound(err):
+		// the token cleaner deletes the secrets of the expired tokens
+		if expiration := bootstrapKubeconfig.Status.TokenExpirationTime; expiration == nil || time.Now().Before(expiration.Time) {
+			conditions.MarkFalse(bootstrapKubeconfig, infrastructurev1beta1.BootstrapTokenValid, infrastructurev1beta1.BootstrapTokenNotFoundReason,
+				clusterv1.ConditionSeverityWarning, "the secret of bootstrap token %s was deleted", bootstrapKubeconfig.Status.TokenID)
+			return ctrl.Result{}, nil
+		}
+		return updateTokenValidity(bootstrapKubeconfig, nil)
+	default:
 		return ctrl.Result{}, err
 	}
+}
+
+// updateTokenValidity updates the expiration time of the token from its secret, if any,
+// and sets the BootstrapTokenValid condition
+func updateTokenValidity(bootstrapKubeconfig *infrastructurev1beta1.BootstrapKubeconfig, tokenSecret *corev1.Secret) (ctrl.Result, error) {
+	if tokenSecret != nil {
+		expiration, err := time.Parse(time.RFC3339, string(tokenSecret.Data[bootstrapapi.BootstrapTokenExpirationKey]))
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("invalid expiration of bootstrap token %s: %v", bootstrapKubeconfig.Status.TokenID, err)
+		}
+		bootstrapKubeconfig.Status.TokenExpirationTime = &metav1.Time{Time: expiration}
+	}
+
+	untilExpiration := time.Until(bootstrapKubeconfig.Status.TokenExpirationTime.Time)
+	if untilExpiration <= 0 {
+		conditions.MarkFalse(bootstrapKubeconfig, infrastructurev1beta1.BootstrapTokenValid, infrastructurev1beta1.BootstrapTokenExpiredReason,
+			clusterv1.ConditionSeverityWarning, "bootstrap token %s expired at %s", bootstrapKubeconfig.Status.TokenID,
+			bootstrapKubeconfig.Status.TokenExpirationTime.Format(time.RFC3339))
+		return ctrl.Result{}, nil
+	}
+	conditions.MarkTrue(bootstrapKubeconfig, infrastructurev1beta1.BootstrapTokenValid)
+	return ctrl.Result{RequeueAfter: untilExpiration}, nil
+}
 
-	bootstrapKubeconfigDataStr := string(runtimeEncodedBootstrapKubeConfig)
-	bootstrapKubeconfig.Status.BootstrapKubeconfigData = &bootstrapKubeconfigDataStr
+// revokeToken deletes the secret of the bootstrap token of the BootstrapKubeconfig
+func (r *BootstrapKubeconfigReconciler) revokeToken(ctx context.Context, bootstrapKubeconfig *infrastructurev1beta1.BootstrapKubeconfig) error {
+	id := tokenID(bootstrapKubeconfig)
+	if id == "" {
+		return nil
+	}
+	tokenSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      bootstraputil.BootstrapTokenSecretName(id),
+		Namespace: metav1.NamespaceSystem,
+	}}
+	if err := r.Client.Delete(ctx, tokenSecret); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete bootstrap token %s: %v", id, err)
+	}
+	return nil
+}
 
-	return ctrl.Result{}, helper.Patch(ctx, bootstrapKubeconfig)
+// tokenID returns the ID of the bootstrap token of the BootstrapKubeconfig, read from the bootstrap
+// kubeconfig data for the BootstrapKubeconfigs generated before it was recorded in the status
+func tokenID(bootstrapKubeconfig *infrastructurev1beta1.BootstrapKubeconfig) string {
+	if bootstrapKubeconfig.Status.TokenID != "" {
+		return bootstrapKubeconfig.Status.TokenID
+	}
+	if bootstrapKubeconfig.Status.BootstrapKubeconfigData == nil {
+		return ""
+	}
+	kubeconfig, err := clientcmd.Load([]byte(*bootstrapKubeconfig.Status.BootstrapKubeconfigData))
+	if err != nil {
+		return ""
+	}
+	authInfo, ok := kubeconfig.AuthInfos[infrastructurev1beta1.DefaultAuth]
+	if !ok {
+		return ""
+	}
+	id, _, err := bootstraptoken.GetTokenIDSecretFromBootstrapToken(authInfo.Token)
+	if err != nil {
+		return ""
+	}
+	return id
 }
 
 // SetupWithManager sets up the controller with the Manager.
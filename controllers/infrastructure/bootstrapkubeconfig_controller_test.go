@@ -5,16 +5,23 @@ package controllers_test
 
 import (
 	"context"
+	"time"
 
 	b64 "encoding/base64"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	infrav1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/bootstraptoken"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/clientcmd"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -32,6 +39,17 @@ var _ = Describe("Controllers/BoottrapKubeconfigController", func() {
 		existingBootstrapKubeconfigData = "i am already present"
 	)
 
+	// getBootstrapKubeconfigData returns the bootstrap kubeconfig from the secret of the BootstrapKubeconfig
+	getBootstrapKubeconfigData := func(bootstrapKubeconfig *infrav1.BootstrapKubeconfig) string {
+		Expect(bootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef).NotTo(BeNil())
+		secret := &corev1.Secret{}
+		Expect(k8sClientUncached.Get(ctx, types.NamespacedName{
+			Name:      bootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef.Name,
+			Namespace: bootstrapKubeconfig.Namespace,
+		}, secret)).To(Succeed())
+		return string(secret.Data[infrav1.BootstrapKubeconfigSecretKey])
+	}
+
 	It("should ignore bootstrapkubeconfig if it is not found", func() {
 		_, err := bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{
 			NamespacedName: types.NamespacedName{
@@ -61,16 +79,23 @@ var _ = Describe("Controllers/BoottrapKubeconfigController", func() {
 			bootstrapKubeconfigLookupKey = types.NamespacedName{Name: bootstrapKubeConfig.Name, Namespace: bootstrapKubeConfig.Namespace}
 		})
 
-		It("should return empty result if BootstrapKubeconfigData is already present", func() {
+		It("should move the BootstrapKubeconfigData already present to a secret", func() {
 			helper, err := patch.NewHelper(bootstrapKubeConfig, k8sClientUncached)
 			Expect(err).NotTo(HaveOccurred())
 			bootstrapKubeConfig.Status.BootstrapKubeconfigData = &existingBootstrapKubeconfigData
 			Expect(helper.Patch(ctx, bootstrapKubeConfig)).NotTo(HaveOccurred())
 
-			res, err := bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{
-				NamespacedName: bootstrapKubeconfigLookupKey})
-			Expect(err).NotTo(HaveOccurred())
-			Expect(res).To(Equal(ctrl.Result{}))
+			migratedBootstrapKubeconfig := &infrav1.BootstrapKubeconfig{}
+			Eventually(func() *corev1.LocalObjectReference {
+				res, err := bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: bootstrapKubeconfigLookupKey})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res).To(Equal(ctrl.Result{}))
+				Expect(k8sClientUncached.Get(ctx, bootstrapKubeconfigLookupKey, migratedBootstrapKubeconfig)).To(Succeed())
+				return migratedBootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef
+			}).ShouldNot(BeNil())
+			Expect(migratedBootstrapKubeconfig.Status.BootstrapKubeconfigData).To(BeNil())
+			Expect(getBootstrapKubeconfigData(migratedBootstrapKubeconfig)).To(Equal(existingBootstrapKubeconfigData))
 		})
 
 		It("should generate the bootstrap kubeconfig data", func() {
@@ -82,10 +107,10 @@ var _ = Describe("Controllers/BoottrapKubeconfigController", func() {
 			err = k8sClientUncached.Get(ctx, bootstrapKubeconfigLookupKey, createdBootstrapKubeconfig)
 			Expect(err).ToNot(HaveOccurred())
 
-			kubeconfigData := createdBootstrapKubeconfig.Status.BootstrapKubeconfigData
-			Expect(kubeconfigData).ShouldNot(BeNil())
+			Expect(createdBootstrapKubeconfig.Status.BootstrapKubeconfigData).To(BeNil())
+			kubeconfigData := getBootstrapKubeconfigData(createdBootstrapKubeconfig)
 
-			bootstrapKubeconfigFileData, err := clientcmd.Load([]byte(*kubeconfigData))
+			bootstrapKubeconfigFileData, err := clientcmd.Load([]byte(kubeconfigData))
 			Expect(err).NotTo(HaveOccurred())
 
 			// assert Server and CertificateAuthorityData are the same as that we have passed
@@ -96,8 +121,183 @@ var _ = Describe("Controllers/BoottrapKubeconfigController", func() {
 
 		})
 
+		It("should write the bootstrap kubeconfig to a secret owned by the BootstrapKubeconfig", func() {
+			_, err := bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: bootstrapKubeconfigLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdBootstrapKubeconfig := &infrav1.BootstrapKubeconfig{}
+			Expect(k8sClientUncached.Get(ctx, bootstrapKubeconfigLookupKey, createdBootstrapKubeconfig)).To(Succeed())
+			Expect(createdBootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef).NotTo(BeNil())
+			secret := &corev1.Secret{}
+			Expect(k8sClientUncached.Get(ctx, types.NamespacedName{
+				Name:      createdBootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef.Name,
+				Namespace: createdBootstrapKubeconfig.Namespace,
+			}, secret)).To(Succeed())
+			Expect(secret.OwnerReferences).To(ConsistOf(*metav1.NewControllerRef(createdBootstrapKubeconfig, infrav1.GroupVersion.WithKind("BootstrapKubeconfig"))))
+		})
+
+		It("should annotate the token secret with the BootstrapKubeconfig", func() {
+			_, err := bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: bootstrapKubeconfigLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdBootstrapKubeconfig := &infrav1.BootstrapKubeconfig{}
+			Expect(k8sClientUncached.Get(ctx, bootstrapKubeconfigLookupKey, createdBootstrapKubeconfig)).To(Succeed())
+			bootstrapKubeconfigFileData, err := clientcmd.Load([]byte(getBootstrapKubeconfigData(createdBootstrapKubeconfig)))
+			Expect(err).NotTo(HaveOccurred())
+			tokenID, _, err := bootstraptoken.GetTokenIDSecretFromBootstrapToken(bootstrapKubeconfigFileData.AuthInfos[infrav1.DefaultAuth].Token)
+			Expect(err).NotTo(HaveOccurred())
+
+			tokenSecret := &corev1.Secret{}
+			Expect(k8sClientUncached.Get(ctx, types.NamespacedName{Name: bootstraputil.BootstrapTokenSecretName(tokenID), Namespace: metav1.NamespaceSystem}, tokenSecret)).To(Succeed())
+			Expect(tokenSecret.Annotations).To(Equal(map[string]string{
+				infrav1.BootstrapKubeconfigNameAnnotation:      bootstrapKubeConfig.Name,
+				infrav1.BootstrapKubeconfigNamespaceAnnotation: bootstrapKubeConfig.Namespace,
+			}))
+		})
+
+		It("should bind the token to the target namespace and TTL of the BootstrapKubeconfig", func() {
+			helper, err := patch.NewHelper(bootstrapKubeConfig, k8sClientUncached)
+			Expect(err).NotTo(HaveOccurred())
+			bootstrapKubeConfig.Spec.TargetNamespace = "byoh-pool"
+			bootstrapKubeConfig.Spec.TTL = &metav1.Duration{Duration: 2 * time.Hour}
+			Expect(helper.Patch(ctx, bootstrapKubeConfig)).To(Succeed())
+
+			_, err = bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: bootstrapKubeconfigLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdBootstrapKubeconfig := &infrav1.BootstrapKubeconfig{}
+			Expect(k8sClientUncached.Get(ctx, bootstrapKubeconfigLookupKey, createdBootstrapKubeconfig)).To(Succeed())
+			bootstrapKubeconfigFileData, err := clientcmd.Load([]byte(getBootstrapKubeconfigData(createdBootstrapKubeconfig)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bootstrapKubeconfigFileData.Contexts[infrav1.DefaultContext].Namespace).To(Equal("byoh-pool"))
+
+			tokenID, _, err := bootstraptoken.GetTokenIDSecretFromBootstrapToken(bootstrapKubeconfigFileData.AuthInfos[infrav1.DefaultAuth].Token)
+			Expect(err).NotTo(HaveOccurred())
+			tokenSecret := &corev1.Secret{}
+			Expect(k8sClientUncached.Get(ctx, types.NamespacedName{Name: bootstraputil.BootstrapTokenSecretName(tokenID), Namespace: metav1.NamespaceSystem}, tokenSecret)).To(Succeed())
+			expiration, err := time.Parse(time.RFC3339, string(tokenSecret.Data[bootstrapapi.BootstrapTokenExpirationKey]))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expiration).To(BeTemporally("~", time.Now().Add(2*time.Hour), time.Minute))
+		})
+
+		Context("When the bootstrap token was generated", func() {
+			var tokenSecretKey types.NamespacedName
+
+			getBootstrapKubeconfig := func() *infrav1.BootstrapKubeconfig {
+				updatedBootstrapKubeconfig := &infrav1.BootstrapKubeconfig{}
+				Expect(k8sClientUncached.Get(ctx, bootstrapKubeconfigLookupKey, updatedBootstrapKubeconfig)).To(Succeed())
+				return updatedBootstrapKubeconfig
+			}
+
+			// reconcileUntil reconciles until the cached BootstrapKubeconfig is up to date
+			reconcileUntil := func(matcher func(*infrav1.BootstrapKubeconfig) bool) *infrav1.BootstrapKubeconfig {
+				var updatedBootstrapKubeconfig *infrav1.BootstrapKubeconfig
+				Eventually(func() bool {
+					_, err := bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: bootstrapKubeconfigLookupKey})
+					Expect(err).NotTo(HaveOccurred())
+					updatedBootstrapKubeconfig = getBootstrapKubeconfig()
+					return matcher(updatedBootstrapKubeconfig)
+				}).Should(BeTrue())
+				return updatedBootstrapKubeconfig
+			}
+
+			BeforeEach(func() {
+				res, err := bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: bootstrapKubeconfigLookupKey})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.RequeueAfter).To(BeNumerically("~", 30*time.Minute, time.Minute))
+
+				bootstrapKubeConfig = getBootstrapKubeconfig()
+				tokenSecretKey = types.NamespacedName{
+					Name:      bootstraputil.BootstrapTokenSecretName(bootstrapKubeConfig.Status.TokenID),
+					Namespace: metav1.NamespaceSystem,
+				}
+			})
+
+			It("should set the validity and the expiration time of the token", func() {
+				Expect(bootstrapKubeConfig.Finalizers).To(ContainElement(infrav1.BootstrapKubeconfigFinalizer))
+				Expect(bootstrapKubeConfig.Status.TokenID).NotTo(BeEmpty())
+				Expect(conditions.IsTrue(bootstrapKubeConfig, infrav1.BootstrapTokenValid)).To(BeTrue())
+				Expect(bootstrapKubeConfig.Status.TokenExpirationTime.Time).To(BeTemporally("~", time.Now().Add(30*time.Minute), time.Minute))
+			})
+
+			It("should mark the token as expired", func() {
+				tokenSecret := &corev1.Secret{}
+				Expect(k8sClientUncached.Get(ctx, tokenSecretKey, tokenSecret)).To(Succeed())
+				tokenSecret.Data[bootstrapapi.BootstrapTokenExpirationKey] = []byte(time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+				Expect(k8sClientUncached.Update(ctx, tokenSecret)).To(Succeed())
+
+				updatedBootstrapKubeconfig := reconcileUntil(func(b *infrav1.BootstrapKubeconfig) bool {
+					return conditions.IsFalse(b, infrav1.BootstrapTokenValid)
+				})
+				Expect(conditions.GetReason(updatedBootstrapKubeconfig, infrav1.BootstrapTokenValid)).To(Equal(infrav1.BootstrapTokenExpiredReason))
+			})
+
+			It("should mark the token as not found if its secret was deleted", func() {
+				Expect(k8sClientUncached.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: tokenSecretKey.Name, Namespace: tokenSecretKey.Namespace}})).To(Succeed())
+
+				updatedBootstrapKubeconfig := reconcileUntil(func(b *infrav1.BootstrapKubeconfig) bool {
+					return conditions.IsFalse(b, infrav1.BootstrapTokenValid)
+				})
+				Expect(conditions.GetReason(updatedBootstrapKubeconfig, infrav1.BootstrapTokenValid)).To(Equal(infrav1.BootstrapTokenNotFoundReason))
+			})
+
+			It("should regenerate the token on request", func() {
+				helper, err := patch.NewHelper(bootstrapKubeConfig, k8sClientUncached)
+				Expect(err).NotTo(HaveOccurred())
+				bootstrapKubeConfig.Annotations = map[string]string{infrav1.RegenerateTokenAnnotation: ""}
+				Expect(helper.Patch(ctx, bootstrapKubeConfig)).To(Succeed())
+
+				previousTokenID := bootstrapKubeConfig.Status.TokenID
+				updatedBootstrapKubeconfig := reconcileUntil(func(b *infrav1.BootstrapKubeconfig) bool {
+					return b.Status.TokenID != previousTokenID
+				})
+				Expect(updatedBootstrapKubeconfig.Annotations).NotTo(HaveKey(infrav1.RegenerateTokenAnnotation))
+				Expect(conditions.IsTrue(updatedBootstrapKubeconfig, infrav1.BootstrapTokenValid)).To(BeTrue())
+				Expect(getBootstrapKubeconfigData(updatedBootstrapKubeconfig)).To(ContainSubstring(updatedBootstrapKubeconfig.Status.TokenID))
+				err = k8sClientUncached.Get(ctx, tokenSecretKey, &corev1.Secret{})
+				Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("should not count the hosts registered with the previous token towards the new one", func() {
+				previousTokenID := bootstrapKubeConfig.Status.TokenID
+				helper, err := patch.NewHelper(bootstrapKubeConfig, k8sClientUncached)
+				Expect(err).NotTo(HaveOccurred())
+				bootstrapKubeConfig.Annotations = map[string]string{infrav1.RegenerateTokenAnnotation: ""}
+				bootstrapKubeConfig.Status.RegisteredHosts = []infrav1.RegisteredHost{{HostName: "host1", TokenID: previousTokenID}}
+				Expect(helper.Patch(ctx, bootstrapKubeConfig)).To(Succeed())
+
+				updatedBootstrapKubeconfig := reconcileUntil(func(b *infrav1.BootstrapKubeconfig) bool {
+					return b.Status.TokenID != previousTokenID
+				})
+				Expect(updatedBootstrapKubeconfig.TokenUsages(updatedBootstrapKubeconfig.Status.TokenID)).To(BeZero())
+				// the host stays bound to the namespace of the BootstrapKubeconfig
+				Expect(updatedBootstrapKubeconfig.HasRegistered("host1")).To(BeTrue())
+			})
+
+			It("should delete the token secret when the BootstrapKubeconfig is deleted", func() {
+				Expect(k8sClientUncached.Delete(ctx, bootstrapKubeConfig)).To(Succeed())
+				Eventually(func() bool {
+					_, err := bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: bootstrapKubeconfigLookupKey})
+					Expect(err).NotTo(HaveOccurred())
+					return apierrors.IsNotFound(k8sClientUncached.Get(ctx, bootstrapKubeconfigLookupKey, &infrav1.BootstrapKubeconfig{}))
+				}).Should(BeTrue())
+				err := k8sClientUncached.Get(ctx, tokenSecretKey, &corev1.Secret{})
+				Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			})
+		})
+
 		AfterEach(func() {
-			Expect(k8sClientUncached.Delete(ctx, bootstrapKubeConfig)).ToNot(HaveOccurred())
+			Expect(client.IgnoreNotFound(k8sClientUncached.Delete(ctx, bootstrapKubeConfig))).ToNot(HaveOccurred())
+			// let the controller remove its finalizer
+			Eventually(func() bool {
+				_, err := bootstrapKubeconfigReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: bootstrapKubeconfigLookupKey})
+				Expect(err).NotTo(HaveOccurred())
+				return apierrors.IsNotFound(k8sClientUncached.Get(ctx, bootstrapKubeconfigLookupKey, &infrav1.BootstrapKubeconfig{}))
+			}).Should(BeTrue())
 		})
 	})
 })
@@ -5,28 +5,64 @@ package controllers
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"strings"
+	"time"
 
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
 	certv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+const (
+	// ByohCSRPrefix is the name prefix of the CSRs created by the BYOH agents
+	ByohCSRPrefix = "byoh-csr-"
+
+	// DefaultCSRMaxExpiration is the longest certificate lifetime a host can request by default,
+	// aligned with the one requested by the agent
+	DefaultCSRMaxExpiration = 365 * 24 * time.Hour
+
+	// CSRPolicyViolationReason is the reason of the CSRs denied by the ByoAdmission controller
+	// and of the events raised for them
+	CSRPolicyViolationReason = "ByohCSRPolicyViolation"
+
+	// CSRApprovedReason is the reason of the events raised for the approved CSRs
+	CSRApprovedReason = "ByohCSRApproved"
+
+	// CSRManualApprovalReason is the reason of the events raised for the CSRs left pending
+	// because a ByoHostAdmissionPolicy requires a manual approval
+	CSRManualApprovalReason = "ByohCSRManualApprovalRequired"
+)
+
 // ByoAdmissionReconciler reconciles a ByoAdmission object
 type ByoAdmissionReconciler struct {
+	// Client reads the ByoHostAdmissionPolicies and the ByoHosts
+	Client    client.Client
 	ClientSet clientset.Interface
+	Recorder  record.EventRecorder
+
+	// MaxExpiration is the longest certificate lifetime a host can request, DefaultCSRMaxExpiration if zero
+	MaxExpiration time.Duration
 }
 
 //+kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=create;get;list;watch
 //+kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests/approval,verbs=update
 //+kubebuilder:rbac:groups=certificates.k8s.io,resources=signers,resourceNames=kubernetes.io/kube-apiserver-client,verbs=approve
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohostadmissionpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=bootstrapkubeconfigs/status,verbs=get;update;patch
 
 // Reconcile continuosuly checks for CSRs and approves them
 func (r *ByoAdmissionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -57,25 +93,176 @@ func (r *ByoAdmissionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, nil
 	}
 
+	hostName, err := r.validateCSR(csr)
+	if err != nil {
+		return r.denyCSR(ctx, csr, err.Error())
+	}
+
+	source, err := r.csrSource(ctx, csr, hostName)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if message := checkTokenBinding(source); message != "" {
+		return r.denyCSR(ctx, csr, message)
+	}
+	message, err := r.checkHostIdentity(ctx, csr, source)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if message != "" {
+		return r.denyCSR(ctx, csr, message)
+	}
+
+	decision, err := r.evaluatePolicies(ctx, csr, source)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	switch {
+	case decision.denied != "":
+		return r.denyCSR(ctx, csr, decision.denied)
+	case decision.manualApprovalBy != "":
+		logger.Info("CSR left for manual approval", "CSR", csr.Name, "policy", decision.manualApprovalBy)
+		r.recordEvent(csr, corev1.EventTypeNormal, CSRManualApprovalReason,
+			"ByoHostAdmissionPolicy %s requires a manual approval of the CSR of host %s", decision.manualApprovalBy, hostName)
+		return ctrl.Result{}, nil
+	}
+
+	// record the host first, a failed approval is retried without counting the host twice
+	if err = r.recordRegistration(ctx, source); err != nil {
+		return reconcile.Result{}, err
+	}
+
 	// Update the CSR to the "Approved" condition
+	message = "Approved by ByoAdmission Controller"
+	if decision.approvedBy != "" {
+		message = fmt.Sprintf("Approved by ByoHostAdmissionPolicy %s", decision.approvedBy)
+	}
 	csr.Status.Conditions = append(csr.Status.Conditions, certv1.CertificateSigningRequestCondition{
-		Type:   certv1.CertificateApproved,
-		Status: corev1.ConditionTrue,
-		Reason: "Approved by ByoAdmission Controller",
+		Type:    certv1.CertificateApproved,
+		Status:  corev1.ConditionTrue,
+		Reason:  "Approved by ByoAdmission Controller",
+		Message: message,
 	})
 
 	// Approve the CSR
-	logger.Info("Approving CSR", "object", req.NamespacedName)
+	logger.Info("Approving CSR", "object", req.NamespacedName, "policy", decision.approvedBy)
 	_, err = r.ClientSet.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{})
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
 	logger.Info("CSR Approved", "object", req.NamespacedName)
+	r.recordEvent(csr, corev1.EventTypeNormal, CSRApprovedReason, "CSR of host %s: %s", hostName, message)
 
 	return ctrl.Result{}, nil
 }
 
+func (r *ByoAdmissionReconciler) recordEvent(csr *certv1.CertificateSigningRequest, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(csr, eventType, reason, messageFmt, args...)
+	}
+}
+
+// denyCSR updates the CSR to the "Denied" condition and raises an event for it
+func (r *ByoAdmissionReconciler) denyCSR(ctx context.Context, csr *certv1.CertificateSigningRequest, message string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	csr.Status.Conditions = append(csr.Status.Conditions, certv1.CertificateSigningRequestCondition{
+		Type:    certv1.CertificateDenied,
+		Status:  corev1.ConditionTrue,
+		Reason:  CSRPolicyViolationReason,
+		Message: message,
+	})
+
+	logger.Info("Denying CSR", "CSR", csr.Name, "requester", csr.Spec.Username, "reason", message)
+	_, err := r.ClientSet.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	r.recordEvent(csr, corev1.EventTypeWarning, CSRPolicyViolationReason, "CSR requested by %s denied: %s", csr.Spec.Username, message)
+	return ctrl.Result{}, nil
+}
+
+// validateCSR checks that the CSR requests a client certificate for the host it was created by,
+// and returns the name of the host. The first certificate of a host is requested with a bootstrap
+// token: the host name is the name of the CSR without its prefix. Registered hosts renew their
+// certificate with it: the host name is the one of the requester.
+func (r *ByoAdmissionReconciler) validateCSR(csr *certv1.CertificateSigningRequest) (string, error) {
+	var hostName string
+	switch {
+	case containsString(csr.Spec.Groups, infrastructurev1beta1.BootstrapTokenExtraGroups):
+		hostName = strings.TrimPrefix(csr.Name, ByohCSRPrefix)
+	case containsString(csr.Spec.Groups, infrastructurev1beta1.HostsGroup) &&
+		strings.HasPrefix(csr.Spec.Username, infrastructurev1beta1.HostUsernamePrefix):
+		hostName = strings.TrimPrefix(csr.Spec.Username, infrastructurev1beta1.HostUsernamePrefix)
+		if !strings.HasPrefix(csr.Name, ByohCSRPrefix+hostName+"-") {
+			return "", fmt.Errorf("%s can only request CSRs named %s%s-<suffix>", csr.Spec.Username, ByohCSRPrefix, hostName)
+		}
+	default:
+		return "", fmt.Errorf("requester %s is not in the %s group", csr.Spec.Username, infrastructurev1beta1.BootstrapTokenExtraGroups)
+	}
+	// the host name is the name of its ByoHost and of its node
+	if errs := validation.IsDNS1123Subdomain(hostName); len(errs) > 0 {
+		return "", fmt.Errorf("host name %q is not a valid ByoHost name: %s", hostName, strings.Join(errs, ", "))
+	}
+
+	if csr.Spec.SignerName != certv1.KubeAPIServerClientSignerName {
+		return "", fmt.Errorf("signer must be %s, got %s", certv1.KubeAPIServerClientSignerName, csr.Spec.SignerName)
+	}
+	if len(csr.Spec.Usages) != 1 || csr.Spec.Usages[0] != certv1.UsageClientAuth {
+		return "", fmt.Errorf("usages must only be %q, got %q", certv1.UsageClientAuth, csr.Spec.Usages)
+	}
+	maxExpiration := r.MaxExpiration
+	if maxExpiration == 0 {
+		maxExpiration = DefaultCSRMaxExpiration
+	}
+	if csr.Spec.ExpirationSeconds == nil {
+		return "", fmt.Errorf("expirationSeconds must be set, with a maximum of %d", int64(maxExpiration.Seconds()))
+	}
+	if time.Duration(*csr.Spec.ExpirationSeconds)*time.Second > maxExpiration {
+		return "", fmt.Errorf("expirationSeconds %d exceeds the maximum of %d", *csr.Spec.ExpirationSeconds, int64(maxExpiration.Seconds()))
+	}
+
+	request, err := parseCSR(csr.Spec.Request)
+	if err != nil {
+		return "", err
+	}
+	if cn := infrastructurev1beta1.HostUsernamePrefix + hostName; request.Subject.CommonName != cn {
+		return "", fmt.Errorf("common name must be %s, got %s", cn, request.Subject.CommonName)
+	}
+	if len(request.Subject.Organization) != 1 || request.Subject.Organization[0] != infrastructurev1beta1.HostsGroup {
+		return "", fmt.Errorf("organization must be %s, got %q", infrastructurev1beta1.HostsGroup, request.Subject.Organization)
+	}
+	if len(request.DNSNames) > 0 || len(request.IPAddresses) > 0 || len(request.EmailAddresses) > 0 || len(request.URIs) > 0 {
+		return "", fmt.Errorf("subject alternative names are not allowed")
+	}
+	return hostName, nil
+}
+
+// parseCSR decodes the PEM encoded request of a CSR and checks its signature
+func parseCSR(pemData []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("request is not a PEM encoded CERTIFICATE REQUEST")
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %v", err)
+	}
+	if err = request.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid request signature: %v", err)
+	}
+	return request, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // Check if the CSR has the given condition.
 func checkCSRCondition(conditions []certv1.CertificateSigningRequestCondition, conditionType certv1.RequestConditionType) bool {
 	for _, condition := range conditions {
@@ -93,10 +280,10 @@ func (r *ByoAdmissionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		// watch only BYOH created CSRs
 		predicate.Funcs{
 			CreateFunc: func(e event.CreateEvent) bool {
-				return strings.HasPrefix(e.Object.GetName(), "byoh-csr-")
+				return strings.HasPrefix(e.Object.GetName(), ByohCSRPrefix)
 			},
 			UpdateFunc: func(e event.UpdateEvent) bool {
-				return strings.HasPrefix(e.ObjectOld.GetName(), "byoh-csr-")
+				return strings.HasPrefix(e.ObjectOld.GetName(), ByohCSRPrefix)
 			}}).
 		Complete(r)
 }
@@ -5,9 +5,12 @@ package controllers_test
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	controllers "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/controllers/infrastructure"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/builder"
 	certv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -18,10 +21,55 @@ import (
 
 var _ = Describe("Controllers/ByoadmissionController", func() {
 	var (
-		err error
-		CSR *certv1.CertificateSigningRequest
+		err        error
+		CSR        *certv1.CertificateSigningRequest
+		csrName    string
+		csrBuilder *builder.CertificateSigningRequestBuilder
 	)
 
+	reconcileCSR := func() *certv1.CertificateSigningRequest {
+		_, err = clientSetFake.CertificatesV1().CertificateSigningRequests().Create(ctx, CSR, v1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		// Call Reconcile method
+		objectKey := types.NamespacedName{Name: csrName}
+		_, err = byoAdmissionReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: objectKey})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		// Fetch the updated CSR
+		var updatedCSR *certv1.CertificateSigningRequest
+		updatedCSR, err = clientSetFake.CertificatesV1().CertificateSigningRequests().Get(ctx, csrName, v1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return updatedCSR
+	}
+
+	expectApprovedBy := func(csr *certv1.CertificateSigningRequest, message string) {
+		Expect(csr.Status.Conditions).Should(ContainElement(certv1.CertificateSigningRequestCondition{
+			Type:    certv1.CertificateApproved,
+			Reason:  "Approved by ByoAdmission Controller",
+			Message: message,
+			Status:  corev1.ConditionTrue,
+		}))
+		Eventually(admissionRecorder.Events).Should(Receive(And(
+			HavePrefix("Normal "+controllers.CSRApprovedReason),
+			ContainSubstring(message))))
+	}
+
+	expectApproved := func(csr *certv1.CertificateSigningRequest) {
+		expectApprovedBy(csr, "Approved by ByoAdmission Controller")
+	}
+
+	expectDenied := func(csr *certv1.CertificateSigningRequest, message string) {
+		Expect(csr.Status.Conditions).To(HaveLen(1))
+		Expect(csr.Status.Conditions[0].Type).To(Equal(certv1.CertificateDenied))
+		Expect(csr.Status.Conditions[0].Status).To(Equal(corev1.ConditionTrue))
+		Expect(csr.Status.Conditions[0].Reason).To(Equal(controllers.CSRPolicyViolationReason))
+		Expect(csr.Status.Conditions[0].Message).To(ContainSubstring(message))
+		Eventually(admissionRecorder.Events).Should(Receive(And(
+			HavePrefix("Warning "+controllers.CSRPolicyViolationReason),
+			ContainSubstring(message))))
+	}
+
 	It("should return error for non-existent CSR", func() {
 		// Call Reconcile method for a non-existing CSR
 		objectKey := types.NamespacedName{Name: defaultByoHostName}
@@ -32,31 +80,21 @@ var _ = Describe("Controllers/ByoadmissionController", func() {
 	Context("When a CSR is created", func() {
 		BeforeEach(func() {
 			ctx = context.Background()
+			csrName = controllers.ByohCSRPrefix + defaultByoHostName
+
+			// A CSR of the host, requested with a bootstrap token
+			csrBuilder = builder.CertificateSigningRequest(csrName, infrastructurev1beta1.HostUsernamePrefix+defaultByoHostName, infrastructurev1beta1.HostsGroup, 2048).
+				WithRequester("system:bootstrap:abcdef", "system:bootstrappers", infrastructurev1beta1.BootstrapTokenExtraGroups).
+				WithExpirationSeconds(int32(controllers.DefaultCSRMaxExpiration.Seconds()))
+		})
 
-			// Create a CSR resource for each test
-			CSR, err = builder.CertificateSigningRequest(defaultByoHostName, "test-cn", "test-org", 2048).Build()
+		JustBeforeEach(func() {
+			CSR, err = csrBuilder.Build()
 			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("should approve the Byoh CSR", func() {
-			// Create a dummy CSR request
-			_, err = clientSetFake.CertificatesV1().CertificateSigningRequests().Create(ctx, CSR, v1.CreateOptions{})
-			Expect(err).ToNot(HaveOccurred())
-
-			// Call Reconcile method
-			objectKey := types.NamespacedName{Name: defaultByoHostName}
-			_, err = byoAdmissionReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: objectKey})
-			Expect(err).ShouldNot(HaveOccurred())
-
-			// Fetch the updated CSR
-			var updateByohCSR *certv1.CertificateSigningRequest
-			updateByohCSR, err = clientSetFake.CertificatesV1().CertificateSigningRequests().Get(ctx, defaultByoHostName, v1.GetOptions{})
-			Expect(err).ToNot(HaveOccurred())
-			Expect(updateByohCSR.Status.Conditions).Should(ContainElement(certv1.CertificateSigningRequestCondition{
-				Type:   certv1.CertificateApproved,
-				Reason: "Approved by ByoAdmission Controller",
-				Status: corev1.ConditionTrue,
-			}))
+			expectApproved(reconcileCSR())
 		})
 
 		It("should not approve a denied CSR", func() {
@@ -64,14 +102,7 @@ var _ = Describe("Controllers/ByoadmissionController", func() {
 			CSR.Status.Conditions = append(CSR.Status.Conditions, certv1.CertificateSigningRequestCondition{
 				Type: certv1.CertificateDenied,
 			})
-
-			_, err = clientSetFake.CertificatesV1().CertificateSigningRequests().Create(ctx, CSR, v1.CreateOptions{})
-			Expect(err).ToNot(HaveOccurred())
-
-			// Call Reconcile method
-			objectKey := types.NamespacedName{Name: defaultByoHostName}
-			_, err = byoAdmissionReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: objectKey})
-			Expect(err).To(BeNil())
+			Expect(reconcileCSR().Status.Conditions).To(HaveLen(1))
 		})
 
 		It("should not approve an already approved CSR", func() {
@@ -79,18 +110,420 @@ var _ = Describe("Controllers/ByoadmissionController", func() {
 			CSR.Status.Conditions = append(CSR.Status.Conditions, certv1.CertificateSigningRequestCondition{
 				Type: certv1.CertificateApproved,
 			})
+			Expect(reconcileCSR().Status.Conditions).To(HaveLen(1))
+		})
+
+		Context("When the requester is not a bootstrapping host", func() {
+			BeforeEach(func() {
+				csrBuilder.WithRequester("jane", "system:authenticated")
+			})
+
+			It("should deny the CSR", func() {
+				expectDenied(reconcileCSR(), "requester jane is not in the system:bootstrappers:byoh group")
+			})
+		})
+
+		Context("When the common name is not the one of the host", func() {
+			BeforeEach(func() {
+				csrBuilder = builder.CertificateSigningRequest(csrName, infrastructurev1beta1.HostUsernamePrefix+"other-host", infrastructurev1beta1.HostsGroup, 2048).
+					WithRequester("system:bootstrap:abcdef", infrastructurev1beta1.BootstrapTokenExtraGroups).
+					WithExpirationSeconds(3600)
+			})
+
+			It("should deny the CSR", func() {
+				expectDenied(reconcileCSR(), "common name must be byoh:host:my-host, got byoh:host:other-host")
+			})
+		})
+
+		Context("When the host name is not a DNS-1123 subdomain", func() {
+			BeforeEach(func() {
+				csrName = controllers.ByohCSRPrefix + "My_Host"
+				csrBuilder = builder.CertificateSigningRequest(csrName, infrastructurev1beta1.HostUsernamePrefix+"My_Host", infrastructurev1beta1.HostsGroup, 2048).
+					WithRequester("system:bootstrap:abcdef", infrastructurev1beta1.BootstrapTokenExtraGroups).
+					WithExpirationSeconds(3600)
+			})
+
+			It("should deny the CSR", func() {
+				expectDenied(reconcileCSR(), `host name "My_Host" is not a valid ByoHost name`)
+			})
+		})
+
+		Context("When the organization is not the hosts group", func() {
+			BeforeEach(func() {
+				csrBuilder = builder.CertificateSigningRequest(csrName, infrastructurev1beta1.HostUsernamePrefix+defaultByoHostName, "system:masters", 2048).
+					WithRequester("system:bootstrap:abcdef", infrastructurev1beta1.BootstrapTokenExtraGroups).
+					WithExpirationSeconds(3600)
+			})
+
+			It("should deny the CSR", func() {
+				expectDenied(reconcileCSR(), "organization must be byoh:hosts")
+			})
+		})
+
+		Context("When the CSR requests other usages than client auth", func() {
+			BeforeEach(func() {
+				csrBuilder.WithUsages(certv1.UsageClientAuth, certv1.UsageServerAuth)
+			})
+
+			It("should deny the CSR", func() {
+				expectDenied(reconcileCSR(), `usages must only be "client auth"`)
+			})
+		})
+
+		Context("When the CSR requests subject alternative names", func() {
+			BeforeEach(func() {
+				csrBuilder.WithDNSNames("kubernetes.default.svc")
+			})
+
+			It("should deny the CSR", func() {
+				expectDenied(reconcileCSR(), "subject alternative names are not allowed")
+			})
+		})
+
+		Context("When the CSR requests a longer expiration than allowed", func() {
+			BeforeEach(func() {
+				csrBuilder.WithExpirationSeconds(int32((controllers.DefaultCSRMaxExpiration + time.Hour).Seconds()))
+			})
+
+			It("should deny the CSR", func() {
+				expectDenied(reconcileCSR(), "exceeds the maximum of 31536000")
+			})
+		})
+
+		Context("When the CSR does not request an expiration", func() {
+			BeforeEach(func() {
+				csrBuilder = builder.CertificateSigningRequest(csrName, infrastructurev1beta1.HostUsernamePrefix+defaultByoHostName, infrastructurev1beta1.HostsGroup, 2048).
+					WithRequester("system:bootstrap:abcdef", infrastructurev1beta1.BootstrapTokenExtraGroups)
+			})
+
+			It("should deny the CSR", func() {
+				expectDenied(reconcileCSR(), "expirationSeconds must be set")
+			})
+		})
+
+		Context("When a registered host renews its certificate", func() {
+			BeforeEach(func() {
+				csrName = controllers.ByohCSRPrefix + defaultByoHostName + "-x7k2p"
+				csrBuilder = builder.CertificateSigningRequest(csrName, infrastructurev1beta1.HostUsernamePrefix+defaultByoHostName, infrastructurev1beta1.HostsGroup, 2048).
+					WithRequester(infrastructurev1beta1.HostUsernamePrefix+defaultByoHostName, infrastructurev1beta1.HostsGroup, "system:authenticated").
+					WithExpirationSeconds(3600)
+			})
+
+			It("should approve the CSR", func() {
+				expectApproved(reconcileCSR())
+			})
+		})
+
+		Context("When a registered host requests a certificate for another host", func() {
+			BeforeEach(func() {
+				csrName = controllers.ByohCSRPrefix + "other-host-x7k2p"
+				csrBuilder = builder.CertificateSigningRequest(csrName, infrastructurev1beta1.HostUsernamePrefix+"other-host", infrastructurev1beta1.HostsGroup, 2048).
+					WithRequester(infrastructurev1beta1.HostUsernamePrefix+defaultByoHostName, infrastructurev1beta1.HostsGroup).
+					WithExpirationSeconds(3600)
+			})
+
+			It("should deny the CSR", func() {
+				expectDenied(reconcileCSR(), "byoh:host:my-host can only request CSRs named byoh-csr-my-host-<suffix>")
+			})
+		})
+
+		Context("When the identity of the host was recorded", func() {
+			var byoHost *infrastructurev1beta1.ByoHost
+
+			BeforeEach(func() {
+				byoHost = builder.ByoHost(defaultNamespace, defaultByoHostName).Build()
+				byoHost.Name = defaultByoHostName
+				byoHost.Status.HostIdentity = &infrastructurev1beta1.HostIdentity{
+					MachineID:             "0123456789abcdef0123456789abcdef",
+					SSHHostKeyFingerprint: "SHA256:I7Y1v2kCSSsjfvybTCtS0E//Hc9jYtPOG7KE/BtXANI",
+				}
+				Expect(admissionClientFake.Create(ctx, byoHost)).To(Succeed())
+			})
 
-			_, err = clientSetFake.CertificatesV1().CertificateSigningRequests().Create(ctx, CSR, v1.CreateOptions{})
-			Expect(err).ToNot(HaveOccurred())
+			AfterEach(func() {
+				Expect(admissionClientFake.Delete(ctx, byoHost)).To(Succeed())
+			})
+
+			It("should approve the CSR of the recorded machine", func() {
+				csrBuilder.WithHostIdentity(byoHost.Status.HostIdentity)
+				CSR, err = csrBuilder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				expectApproved(reconcileCSR())
+			})
+
+			It("should deny the CSR of another machine", func() {
+				csrBuilder.WithHostIdentity(&infrastructurev1beta1.HostIdentity{MachineID: "fedcba9876543210fedcba9876543210"})
+				CSR, err = csrBuilder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				expectDenied(reconcileCSR(), "the identity of host my-host does not match the one recorded on ByoHost default/my-host")
+			})
+
+			It("should deny the CSR without identity", func() {
+				expectDenied(reconcileCSR(), "the identity of host my-host does not match the one recorded on ByoHost default/my-host")
+			})
+
+			It("should approve the CSR of another machine once accepted", func() {
+				byoHost.Annotations = map[string]string{infrastructurev1beta1.AcceptHostIdentityAnnotation: ""}
+				Expect(admissionClientFake.Update(ctx, byoHost)).To(Succeed())
+				csrBuilder.WithHostIdentity(&infrastructurev1beta1.HostIdentity{MachineID: "fedcba9876543210fedcba9876543210"})
+				CSR, err = csrBuilder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				expectApproved(reconcileCSR())
+			})
+		})
+
+		Context("When ByoHostAdmissionPolicies exist", func() {
+			var (
+				policies    []*infrastructurev1beta1.ByoHostAdmissionPolicy
+				tokenSecret *corev1.Secret
+			)
+
+			newPolicy := func(name string, spec infrastructurev1beta1.ByoHostAdmissionPolicySpec) *infrastructurev1beta1.ByoHostAdmissionPolicy {
+				policy := &infrastructurev1beta1.ByoHostAdmissionPolicy{
+					ObjectMeta: v1.ObjectMeta{Name: name},
+					Spec:       spec,
+				}
+				Expect(admissionClientFake.Create(ctx, policy)).To(Succeed())
+				policies = append(policies, policy)
+				return policy
+			}
+
+			BeforeEach(func() {
+				policies = nil
+				// the token was generated for a BootstrapKubeconfig of the byoh-pool namespace
+				tokenSecret = &corev1.Secret{
+					ObjectMeta: v1.ObjectMeta{
+						Name:      "bootstrap-token-abcdef",
+						Namespace: v1.NamespaceSystem,
+						Annotations: map[string]string{
+							infrastructurev1beta1.BootstrapKubeconfigNameAnnotation:      "bootstrap-kubeconfig",
+							infrastructurev1beta1.BootstrapKubeconfigNamespaceAnnotation: "byoh-pool",
+						},
+					},
+				}
+				_, err = clientSetFake.CoreV1().Secrets(v1.NamespaceSystem).Create(ctx, tokenSecret, v1.CreateOptions{})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				for _, policy := range policies {
+					Expect(admissionClientFake.Delete(ctx, policy)).To(Succeed())
+				}
+				Expect(clientSetFake.CoreV1().Secrets(v1.NamespaceSystem).Delete(ctx, tokenSecret.Name, v1.DeleteOptions{})).To(Succeed())
+			})
+
+			It("should record the policy that approved the CSR", func() {
+				newPolicy("web-hosts", infrastructurev1beta1.ByoHostAdmissionPolicySpec{HostNamePatterns: []string{"web-*"}})
+				newPolicy("my-hosts", infrastructurev1beta1.ByoHostAdmissionPolicySpec{HostNamePatterns: []string{"my-*"}})
+				expectApprovedBy(reconcileCSR(), "Approved by ByoHostAdmissionPolicy my-hosts")
+			})
+
+			It("should deny the CSR if no policy matches the host", func() {
+				newPolicy("web-hosts", infrastructurev1beta1.ByoHostAdmissionPolicySpec{HostNamePatterns: []string{"web-*"}})
+				expectDenied(reconcileCSR(), "no ByoHostAdmissionPolicy matches host my-host")
+			})
+
+			It("should match the namespace of the BootstrapKubeconfig of the token", func() {
+				newPolicy("other-pool", infrastructurev1beta1.ByoHostAdmissionPolicySpec{Namespaces: []string{"other-pool"}})
+				newPolicy("byoh-pool", infrastructurev1beta1.ByoHostAdmissionPolicySpec{Namespaces: []string{"byoh-pool"}})
+				expectApprovedBy(reconcileCSR(), "Approved by ByoHostAdmissionPolicy byoh-pool")
+			})
+
+			It("should only match the CSRs requested with the bootstrap token of the policy", func() {
+				newPolicy("other-token", infrastructurev1beta1.ByoHostAdmissionPolicySpec{BootstrapTokenID: "uvwxyz"})
+				expectDenied(reconcileCSR(), "no ByoHostAdmissionPolicy matches host my-host")
+			})
+
+			It("should leave the CSR pending if a matching policy requires a manual approval", func() {
+				newPolicy("all-hosts", infrastructurev1beta1.ByoHostAdmissionPolicySpec{})
+				newPolicy("manual", infrastructurev1beta1.ByoHostAdmissionPolicySpec{BootstrapTokenID: "abcdef", ManualApproval: true})
+				Expect(reconcileCSR().Status.Conditions).To(BeEmpty())
+				Eventually(admissionRecorder.Events).Should(Receive(Equal(
+					"Normal " + controllers.CSRManualApprovalReason + " ByoHostAdmissionPolicy manual requires a manual approval of the CSR of host my-host")))
+			})
+
+			It("should approve the CSR with a policy allowing the requested duration", func() {
+				newPolicy("a-short", infrastructurev1beta1.ByoHostAdmissionPolicySpec{MaxCertificateDuration: &v1.Duration{Duration: time.Hour}})
+				newPolicy("b-long", infrastructurev1beta1.ByoHostAdmissionPolicySpec{MaxCertificateDuration: &v1.Duration{Duration: controllers.DefaultCSRMaxExpiration}})
+				expectApprovedBy(reconcileCSR(), "Approved by ByoHostAdmissionPolicy b-long")
+			})
+
+			It("should deny the CSR if the requested duration exceeds the one of the matching policies", func() {
+				newPolicy("short", infrastructurev1beta1.ByoHostAdmissionPolicySpec{MaxCertificateDuration: &v1.Duration{Duration: time.Hour}})
+				expectDenied(reconcileCSR(), "exceeds the maxCertificateDuration of the ByoHostAdmissionPolicies short")
+			})
+
+			Context("When a registered host renews its certificate", func() {
+				var byoHost *infrastructurev1beta1.ByoHost
+
+				BeforeEach(func() {
+					csrName = controllers.ByohCSRPrefix + defaultByoHostName + "-x7k2p"
+					csrBuilder = builder.CertificateSigningRequest(csrName, infrastructurev1beta1.HostUsernamePrefix+defaultByoHostName, infrastructurev1beta1.HostsGroup, 2048).
+						WithRequester(infrastructurev1beta1.HostUsernamePrefix+defaultByoHostName, infrastructurev1beta1.HostsGroup).
+						WithExpirationSeconds(3600)
+					byoHost = builder.ByoHost("byoh-pool", defaultByoHostName).Build()
+					byoHost.Name = defaultByoHostName
+					Expect(admissionClientFake.Create(ctx, byoHost)).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(admissionClientFake.Delete(ctx, byoHost)).To(Succeed())
+				})
 
-			// Call Reconcile method
-			objectKey := types.NamespacedName{Name: defaultByoHostName}
-			_, err = byoAdmissionReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: objectKey})
-			Expect(err).To(BeNil())
+				It("should match the namespace of the ByoHost", func() {
+					newPolicy("byoh-pool", infrastructurev1beta1.ByoHostAdmissionPolicySpec{Namespaces: []string{"byoh-pool"}})
+					expectApprovedBy(reconcileCSR(), "Approved by ByoHostAdmissionPolicy byoh-pool")
+				})
+
+				It("should match a policy bound to a bootstrap token on the namespace of the ByoHost", func() {
+					newPolicy("token", infrastructurev1beta1.ByoHostAdmissionPolicySpec{
+						BootstrapTokenID: "abcdef",
+						Namespaces:       []string{"byoh-pool"},
+					})
+					expectApprovedBy(reconcileCSR(), "Approved by ByoHostAdmissionPolicy token")
+				})
+
+				It("should not match a policy of another namespace", func() {
+					newPolicy("token", infrastructurev1beta1.ByoHostAdmissionPolicySpec{
+						BootstrapTokenID: "abcdef",
+						Namespaces:       []string{"other-pool"},
+					})
+					expectDenied(reconcileCSR(), "no ByoHostAdmissionPolicy matches host my-host")
+				})
+			})
+		})
+
+		Context("When the bootstrap token was generated for a BootstrapKubeconfig", func() {
+			var (
+				bootstrapKubeconfig *infrastructurev1beta1.BootstrapKubeconfig
+				bootstrapBuilder    *builder.BootstrapKubeconfigBuilder
+				tokenSecret         *corev1.Secret
+			)
+
+			getBootstrapKubeconfig := func() *infrastructurev1beta1.BootstrapKubeconfig {
+				updated := &infrastructurev1beta1.BootstrapKubeconfig{}
+				Expect(admissionClientFake.Get(ctx, types.NamespacedName{Name: bootstrapKubeconfig.Name, Namespace: bootstrapKubeconfig.Namespace}, updated)).To(Succeed())
+				return updated
+			}
+
+			BeforeEach(func() {
+				bootstrapBuilder = builder.BootstrapKubeconfig("default", "bootstrap-kubeconfig")
+				tokenSecret = &corev1.Secret{
+					ObjectMeta: v1.ObjectMeta{
+						Name:      "bootstrap-token-abcdef",
+						Namespace: v1.NamespaceSystem,
+						Annotations: map[string]string{
+							infrastructurev1beta1.BootstrapKubeconfigNameAnnotation:      "bootstrap-kubeconfig",
+							infrastructurev1beta1.BootstrapKubeconfigNamespaceAnnotation: "default",
+						},
+					},
+				}
+				_, err = clientSetFake.CoreV1().Secrets(v1.NamespaceSystem).Create(ctx, tokenSecret, v1.CreateOptions{})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			JustBeforeEach(func() {
+				bootstrapKubeconfig = bootstrapBuilder.Build()
+				bootstrapKubeconfig.Name = "bootstrap-kubeconfig"
+				Expect(admissionClientFake.Create(ctx, bootstrapKubeconfig)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(admissionClientFake.Delete(ctx, bootstrapKubeconfig)).To(Succeed())
+				Expect(clientSetFake.CoreV1().Secrets(v1.NamespaceSystem).Delete(ctx, tokenSecret.Name, v1.DeleteOptions{})).To(Succeed())
+			})
+
+			It("should record the host registered with the token", func() {
+				expectApproved(reconcileCSR())
+				Expect(getBootstrapKubeconfig().Status.RegisteredHosts).To(ConsistOf(
+					infrastructurev1beta1.RegisteredHost{HostName: defaultByoHostName, TokenID: "abcdef"}))
+			})
+
+			Context("When the BootstrapKubeconfig has a target namespace", func() {
+				BeforeEach(func() {
+					bootstrapBuilder.WithTargetNamespace("byoh-pool")
+				})
+
+				It("should match the policies on the target namespace", func() {
+					policy := &infrastructurev1beta1.ByoHostAdmissionPolicy{
+						ObjectMeta: v1.ObjectMeta{Name: "byoh-pool"},
+						Spec:       infrastructurev1beta1.ByoHostAdmissionPolicySpec{Namespaces: []string{"byoh-pool"}},
+					}
+					Expect(admissionClientFake.Create(ctx, policy)).To(Succeed())
+					defer func() {
+						Expect(admissionClientFake.Delete(ctx, policy)).To(Succeed())
+					}()
+					expectApprovedBy(reconcileCSR(), "Approved by ByoHostAdmissionPolicy byoh-pool")
+				})
+			})
+
+			Context("When the host name does not match the host name patterns", func() {
+				BeforeEach(func() {
+					bootstrapBuilder.WithHostNamePatterns("web-*")
+				})
+
+				It("should deny the CSR", func() {
+					expectDenied(reconcileCSR(), "host name my-host does not match the hostNamePatterns")
+					Expect(getBootstrapKubeconfig().Status.RegisteredHosts).To(BeEmpty())
+				})
+			})
+
+			Context("When the token registered its maximum of hosts", func() {
+				BeforeEach(func() {
+					bootstrapBuilder.WithMaxUsages(1)
+				})
+
+				JustBeforeEach(func() {
+					bootstrapKubeconfig.Status.RegisteredHosts = []infrastructurev1beta1.RegisteredHost{{HostName: "other-host", TokenID: "abcdef"}}
+					Expect(admissionClientFake.Status().Update(ctx, bootstrapKubeconfig)).To(Succeed())
+				})
+
+				It("should deny the CSR of a new host", func() {
+					expectDenied(reconcileCSR(), "already registered its maximum of 1 hosts")
+				})
+			})
+
+			Context("When the hosts were registered with a previous token", func() {
+				BeforeEach(func() {
+					bootstrapBuilder.WithMaxUsages(1)
+				})
+
+				JustBeforeEach(func() {
+					bootstrapKubeconfig.Status.RegisteredHosts = []infrastructurev1beta1.RegisteredHost{
+						{HostName: "other-host", TokenID: "uvwxyz"},
+						{HostName: defaultByoHostName, TokenID: "uvwxyz"},
+					}
+					Expect(admissionClientFake.Status().Update(ctx, bootstrapKubeconfig)).To(Succeed())
+				})
+
+				It("should only count the hosts registered with the current token", func() {
+					expectApproved(reconcileCSR())
+					Expect(getBootstrapKubeconfig().Status.RegisteredHosts).To(ConsistOf(
+						infrastructurev1beta1.RegisteredHost{HostName: "other-host", TokenID: "uvwxyz"},
+						infrastructurev1beta1.RegisteredHost{HostName: defaultByoHostName, TokenID: "abcdef"}))
+				})
+			})
+
+			Context("When the token already registered the host", func() {
+				BeforeEach(func() {
+					bootstrapBuilder.WithMaxUsages(1)
+				})
+
+				JustBeforeEach(func() {
+					bootstrapKubeconfig.Status.RegisteredHosts = []infrastructurev1beta1.RegisteredHost{{HostName: defaultByoHostName, TokenID: "abcdef"}}
+					Expect(admissionClientFake.Status().Update(ctx, bootstrapKubeconfig)).To(Succeed())
+				})
+
+				It("should approve the CSR without counting the host twice", func() {
+					expectApproved(reconcileCSR())
+					Expect(getBootstrapKubeconfig().Status.RegisteredHosts).To(ConsistOf(
+						infrastructurev1beta1.RegisteredHost{HostName: defaultByoHostName, TokenID: "abcdef"}))
+				})
+			})
 		})
 
 		AfterEach(func() {
-			Expect(clientSetFake.CertificatesV1().CertificateSigningRequests().Delete(ctx, defaultByoHostName, v1.DeleteOptions{})).ShouldNot(HaveOccurred())
+			Expect(clientSetFake.CertificatesV1().CertificateSigningRequests().Delete(ctx, csrName, v1.DeleteOptions{})).ShouldNot(HaveOccurred())
 		})
 
 	})
@@ -0,0 +1,240 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/hostidentity"
+	certv1 "k8s.io/api/certificates/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	"sigs.k8s.io/cluster-api/util/patch"
+)
+
+// csrSource is what the ByoHostAdmissionPolicies match a CSR on
+type csrSource struct {
+	hostName string
+	// renewal is true for the CSRs of registered hosts renewing their certificate
+	renewal bool
+	// tokenID is the ID of the bootstrap token the CSR was requested with, empty for renewals
+	tokenID string
+	// bootstrapKubeconfig the token was generated for, if known
+	bootstrapKubeconfig *infrastructurev1beta1.BootstrapKubeconfig
+	// namespaces the host belongs to, unknown if empty
+	namespaces []string
+}
+
+// policyDecision is the outcome of the evaluation of the ByoHostAdmissionPolicies for a CSR.
+// The CSR is approved if neither denied nor left for a manual approval.
+type policyDecision struct {
+	approvedBy       string
+	manualApprovalBy string
+	denied           string
+}
+
+// evaluatePolicies decides what to do with a valid CSR of hostName. Without any
+// ByoHostAdmissionPolicy the CSR is approved. Otherwise a policy must match the host:
+// the CSR is left pending if a matching policy requires a manual approval, and approved by
+// the first matching policy, by name, that allows the requested certificate duration.
+func (r *ByoAdmissionReconciler) evaluatePolicies(ctx context.Context, csr *certv1.CertificateSigningRequest, source *csrSource) (policyDecision, error) {
+	policies := &infrastructurev1beta1.ByoHostAdmissionPolicyList{}
+	if err := r.Client.List(ctx, policies); err != nil {
+		return policyDecision{}, err
+	}
+	if len(policies.Items) == 0 {
+		return policyDecision{}, nil
+	}
+
+	sort.Slice(policies.Items, func(i, j int) bool {
+		return policies.Items[i].Name < policies.Items[j].Name
+	})
+	matching := make([]infrastructurev1beta1.ByoHostAdmissionPolicy, 0, len(policies.Items))
+	for i := range policies.Items {
+		if policyMatches(&policies.Items[i], source) {
+			matching = append(matching, policies.Items[i])
+		}
+	}
+	if len(matching) == 0 {
+		return policyDecision{denied: fmt.Sprintf("no ByoHostAdmissionPolicy matches host %s", source.hostName)}, nil
+	}
+
+	for i := range matching {
+		if matching[i].Spec.ManualApproval {
+			return policyDecision{manualApprovalBy: matching[i].Name}, nil
+		}
+	}
+	requested := time.Duration(*csr.Spec.ExpirationSeconds) * time.Second
+	names := make([]string, 0, len(matching))
+	for i := range matching {
+		maxDuration := matching[i].Spec.MaxCertificateDuration
+		if maxDuration == nil || requested <= maxDuration.Duration {
+			return policyDecision{approvedBy: matching[i].Name}, nil
+		}
+		names = append(names, matching[i].Name)
+	}
+	return policyDecision{denied: fmt.Sprintf("expirationSeconds %d exceeds the maxCertificateDuration of the ByoHostAdmissionPolicies %s",
+		*csr.Spec.ExpirationSeconds, strings.Join(names, ","))}, nil
+}
+
+// csrSource looks up the bootstrap token and the namespaces of the host that requested the CSR.
+// The namespace of a bootstrapping host is the target namespace of the BootstrapKubeconfig its
+// token was generated for, the namespaces of a registered host are the ones of its ByoHosts.
+func (r *ByoAdmissionReconciler) csrSource(ctx context.Context, csr *certv1.CertificateSigningRequest, hostName string) (*csrSource, error) {
+	source := &csrSource{hostName: hostName}
+	if !strings.HasPrefix(csr.Spec.Username, bootstrapapi.BootstrapUserPrefix) {
+		source.renewal = true
+		byoHosts := &infrastructurev1beta1.ByoHostList{}
+		if err := r.Client.List(ctx, byoHosts); err != nil {
+			return nil, err
+		}
+		for i := range byoHosts.Items {
+			if byoHosts.Items[i].Name == hostName {
+				source.namespaces = append(source.namespaces, byoHosts.Items[i].Namespace)
+			}
+		}
+		return source, nil
+	}
+
+	source.tokenID = strings.TrimPrefix(csr.Spec.Username, bootstrapapi.BootstrapUserPrefix)
+	tokenSecret, err := r.ClientSet.CoreV1().Secrets(metav1.NamespaceSystem).Get(ctx, bootstraputil.BootstrapTokenSecretName(source.tokenID), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// e.g. a token that was not generated from a BootstrapKubeconfig
+			return source, nil
+		}
+		return nil, err
+	}
+	name := tokenSecret.Annotations[infrastructurev1beta1.BootstrapKubeconfigNameAnnotation]
+	namespace := tokenSecret.Annotations[infrastructurev1beta1.BootstrapKubeconfigNamespaceAnnotation]
+	if name == "" || namespace == "" {
+		return source, nil
+	}
+	bootstrapKubeconfig := &infrastructurev1beta1.BootstrapKubeconfig{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, bootstrapKubeconfig)
+	switch {
+	case err == nil:
+		source.bootstrapKubeconfig = bootstrapKubeconfig
+		source.namespaces = []string{bootstrapKubeconfig.TokenNamespace()}
+	case apierrors.IsNotFound(err):
+		source.namespaces = []string{namespace}
+	default:
+		return nil, err
+	}
+	return source, nil
+}
+
+// checkTokenBinding returns why the host exceeds the limits of the BootstrapKubeconfig its
+// bootstrap token was generated for, or an empty string if it does not
+func checkTokenBinding(source *csrSource) string {
+	bootstrapKubeconfig := source.bootstrapKubeconfig
+	if bootstrapKubeconfig == nil {
+		return ""
+	}
+	if !bootstrapKubeconfig.AllowsHostName(source.hostName) {
+		return fmt.Sprintf("host name %s does not match the hostNamePatterns %q of BootstrapKubeconfig %s/%s",
+			source.hostName, bootstrapKubeconfig.Spec.HostNamePatterns, bootstrapKubeconfig.Namespace, bootstrapKubeconfig.Name)
+	}
+	maxUsages := bootstrapKubeconfig.Spec.MaxUsages
+	if maxUsages != nil && !bootstrapKubeconfig.HasRegisteredWithToken(source.hostName, source.tokenID) &&
+		bootstrapKubeconfig.TokenUsages(source.tokenID) >= int(*maxUsages) {
+		return fmt.Sprintf("the bootstrap token of BootstrapKubeconfig %s/%s already registered its maximum of %d hosts",
+			bootstrapKubeconfig.Namespace, bootstrapKubeconfig.Name, *maxUsages)
+	}
+	return ""
+}
+
+// checkHostIdentity returns why the identity presented in the CSR does not match the one recorded
+// on the ByoHosts of the host, or an empty string if it does. The ByoHosts with the
+// AcceptHostIdentityAnnotation accept any identity.
+func (r *ByoAdmissionReconciler) checkHostIdentity(ctx context.Context, csr *certv1.CertificateSigningRequest, source *csrSource) (string, error) {
+	request, err := parseCSR(csr.Spec.Request)
+	if err != nil {
+		return err.Error(), nil
+	}
+	identity, err := hostidentity.FromCertificateRequest(request)
+	if err != nil {
+		return err.Error(), nil
+	}
+	byoHosts := &infrastructurev1beta1.ByoHostList{}
+	if err = r.Client.List(ctx, byoHosts); err != nil {
+		return "", err
+	}
+	for i := range byoHosts.Items {
+		byoHost := &byoHosts.Items[i]
+		if byoHost.Name != source.hostName {
+			continue
+		}
+		if len(source.namespaces) > 0 && !containsString(source.namespaces, byoHost.Namespace) {
+			continue
+		}
+		if _, accepted := byoHost.Annotations[infrastructurev1beta1.AcceptHostIdentityAnnotation]; accepted {
+			continue
+		}
+		if !hostidentity.Matches(byoHost.Status.HostIdentity, identity) {
+			return fmt.Sprintf("the identity of host %s does not match the one recorded on ByoHost %s/%s, set the %s annotation on the ByoHost to accept it",
+				source.hostName, byoHost.Namespace, byoHost.Name, infrastructurev1beta1.AcceptHostIdentityAnnotation), nil
+		}
+	}
+	return "", nil
+}
+
+// recordRegistration adds the host to the hosts registered with the bootstrap token, so that
+// they count towards its maxUsages and the ByoHost webhook can enforce its target namespace.
+// A host registered with a previous token of the BootstrapKubeconfig is moved to the current one.
+func (r *ByoAdmissionReconciler) recordRegistration(ctx context.Context, source *csrSource) error {
+	bootstrapKubeconfig := source.bootstrapKubeconfig
+	if bootstrapKubeconfig == nil || bootstrapKubeconfig.HasRegisteredWithToken(source.hostName, source.tokenID) {
+		return nil
+	}
+	helper, err := patch.NewHelper(bootstrapKubeconfig, r.Client)
+	if err != nil {
+		return err
+	}
+	registered := infrastructurev1beta1.RegisteredHost{HostName: source.hostName, TokenID: source.tokenID}
+	hosts := make([]infrastructurev1beta1.RegisteredHost, 0, len(bootstrapKubeconfig.Status.RegisteredHosts)+1)
+	for _, host := range bootstrapKubeconfig.Status.RegisteredHosts {
+		if host.HostName != source.hostName {
+			hosts = append(hosts, host)
+		}
+	}
+	bootstrapKubeconfig.Status.RegisteredHosts = append(hosts, registered)
+	return helper.Patch(ctx, bootstrapKubeconfig)
+}
+
+// policyMatches returns true if the policy applies to the host that requested the CSR.
+// Renewals are not requested with a bootstrap token, they match on the namespaces of the
+// ByoHosts of the host only.
+func policyMatches(policy *infrastructurev1beta1.ByoHostAdmissionPolicy, source *csrSource) bool {
+	if !source.renewal && policy.Spec.BootstrapTokenID != "" && policy.Spec.BootstrapTokenID != source.tokenID {
+		return false
+	}
+	if len(policy.Spec.Namespaces) > 0 {
+		found := false
+		for _, namespace := range source.namespaces {
+			found = found || containsString(policy.Spec.Namespaces, namespace)
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(policy.Spec.HostNamePatterns) == 0 {
+		return true
+	}
+	for _, pattern := range policy.Spec.HostNamePatterns {
+		if matched, err := path.Match(pattern, source.hostName); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
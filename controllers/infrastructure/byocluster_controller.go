@@ -5,7 +5,9 @@ package controllers
 
 import (
 	"context"
+	"net"
 	"reflect"
+	"sort"
 	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -46,6 +48,11 @@ type ByoClusterReconciler struct {
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byoclusters/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byoclusters/finalizers,verbs=update
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohosts,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byomachines,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=ipam.cluster.x-k8s.io,resources=ipaddressclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=ipam.cluster.x-k8s.io,resources=ipaddresses,verbs=get;list;watch
 
 // Reconcile handles the byo cluster reconciliations
 func (r *ByoClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
@@ -104,7 +111,7 @@ func (r *ByoClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	// Handle non-deleted clusters
-	return r.reconcileNormal(ctx, byoCluster)
+	return r.reconcileNormal(ctx, cluster, byoCluster)
 }
 
 func patchByoCluster(ctx context.Context, patchHelper *patch.Helper, byoCluster *infrav1.ByoCluster) error {
@@ -120,6 +127,9 @@ func patchByoCluster(ctx context.Context, patchHelper *patch.Helper, byoCluster
 		byoCluster,
 		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
 			clusterv1.ReadyCondition,
+			infrav1.KubeVIPReady,
+			infrav1.LoadBalancerReady,
+			infrav1.IPAddressesClaimed,
 		}},
 	)
 }
@@ -161,13 +171,30 @@ func (r ByoClusterReconciler) reconcileDelete(ctx context.Context, byoCluster *i
 		logger.Info("Waiting for ByoMachines to be deleted", "count", len(byoMachines))
 		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
 	}
+
+	if byoCluster.Spec.LoadBalancer != nil {
+		lb, err := NewLoadBalancer(r.Client, byoCluster)
+		if err != nil {
+			logger.Info("Invalid load balancer configuration, not releasing the load balancer", "reason", err.Error())
+		} else if err = lb.Delete(ctx, byoCluster); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err,
+				"unable to release the load balancer of ByoCluster %s/%s", byoCluster.Namespace, byoCluster.Name)
+		}
+	}
+	if byoCluster.Spec.ControlPlaneEndpointIPPool != nil {
+		if err := releaseIPAddress(ctx, r.Client, byoCluster.Namespace, controlPlaneEndpointClaimName(byoCluster)); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
 	// Cluster is deleted so remove the finalizer.
 	controllerutil.RemoveFinalizer(byoCluster, infrav1.ClusterFinalizer)
 
 	return ctrl.Result{}, nil
 }
 
-func (r ByoClusterReconciler) reconcileNormal(ctx context.Context, byoCluster *infrav1.ByoCluster) (reconcile.Result, error) {
+func (r ByoClusterReconciler) reconcileNormal(ctx context.Context, cluster *clusterv1.Cluster, byoCluster *infrav1.ByoCluster) (reconcile.Result, error) {
+	logger := log.FromContext(ctx)
+
 	// If the ByoCluster doesn't have our finalizer, add it.
 	controllerutil.AddFinalizer(byoCluster, infrav1.ClusterFinalizer)
 
@@ -175,11 +202,193 @@ func (r ByoClusterReconciler) reconcileNormal(ctx context.Context, byoCluster *i
 		byoCluster.Spec.ControlPlaneEndpoint.Port = int32(DefaultAPIEndpointPort)
 	}
 
+	if byoCluster.Spec.ControlPlaneEndpointIPPool != nil && byoCluster.Spec.ControlPlaneEndpoint.Host == "" {
+		address, err := claimIPAddress(ctx, r.Client, byoCluster, cluster.Name, controlPlaneEndpointClaimName(byoCluster), *byoCluster.Spec.ControlPlaneEndpointIPPool)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if address == nil {
+			logger.Info("Waiting for the IP address of the control plane endpoint")
+			conditions.MarkFalse(byoCluster, infrav1.IPAddressesClaimed, infrav1.WaitingForIPAddressReason, clusterv1.ConditionSeverityInfo, "")
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+		byoCluster.Spec.ControlPlaneEndpoint.Host = address.Spec.Address
+		conditions.MarkTrue(byoCluster, infrav1.IPAddressesClaimed)
+	}
+
+	// the VIP is validated until the cluster infrastructure is ready, it is then held by the control plane hosts
+	if byoCluster.Spec.KubeVIP != nil && !byoCluster.Status.Ready {
+		if err := r.reconcileKubeVIP(ctx, cluster, byoCluster); err != nil {
+			return reconcile.Result{}, err
+		}
+		if !conditions.IsTrue(byoCluster, infrav1.KubeVIPReady) {
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+	}
+
+	// the load balancer backends are kept in sync with the control plane machines for the lifetime of the cluster
+	if byoCluster.Spec.LoadBalancer != nil {
+		if err := r.reconcileLoadBalancer(ctx, cluster, byoCluster); err != nil {
+			return reconcile.Result{}, err
+		}
+		if !conditions.IsTrue(byoCluster, infrav1.LoadBalancerReady) {
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+	}
+
 	byoCluster.Status.Ready = true
 
 	return reconcile.Result{}, nil
 }
 
+// controlPlaneEndpointClaimName returns the name of the IPAddressClaim of the control plane endpoint of the ByoCluster
+func controlPlaneEndpointClaimName(byoCluster *infrav1.ByoCluster) string {
+	return byoCluster.Name + "-control-plane-endpoint"
+}
+
+// reconcileKubeVIP validates the kube-vip configuration of the ByoCluster and checks that its VIP
+// is neither the control plane endpoint of another cluster nor an address of a host of another cluster
+func (r ByoClusterReconciler) reconcileKubeVIP(ctx context.Context, cluster *clusterv1.Cluster, byoCluster *infrav1.ByoCluster) error {
+	logger := log.FromContext(ctx)
+
+	if err := validateKubeVIP(byoCluster); err != nil {
+		logger.Info("Invalid kube-vip configuration", "reason", err.Error())
+		conditions.MarkFalse(byoCluster, infrav1.KubeVIPReady, infrav1.InvalidKubeVIPConfigReason, clusterv1.ConditionSeverityError, err.Error())
+		return nil
+	}
+	address := net.ParseIP(byoCluster.GetKubeVIPAddress())
+
+	byoClusters := &infrav1.ByoClusterList{}
+	if err := r.Client.List(ctx, byoClusters); err != nil {
+		return err
+	}
+	for i := range byoClusters.Items {
+		other := &byoClusters.Items[i]
+		if other.UID == byoCluster.UID {
+			continue
+		}
+		if sameIP(address, other.Spec.ControlPlaneEndpoint.Host) || sameIP(address, other.GetKubeVIPAddress()) {
+			conditions.MarkFalse(byoCluster, infrav1.KubeVIPReady, infrav1.KubeVIPAddressInUseReason, clusterv1.ConditionSeverityError,
+				"%s is the control plane endpoint of ByoCluster %s/%s", address, other.Namespace, other.Name)
+			return nil
+		}
+	}
+
+	byoHosts := &infrav1.ByoHostList{}
+	if err := r.Client.List(ctx, byoHosts); err != nil {
+		return err
+	}
+	for i := range byoHosts.Items {
+		host := &byoHosts.Items[i]
+		// kube-vip binds the VIP to a control plane host of the cluster itself
+		if host.Status.MachineRef != nil && host.Status.MachineRef.Namespace == cluster.Namespace &&
+			host.Labels[clusterv1.ClusterNameLabel] == cluster.Name {
+			continue
+		}
+		for _, network := range host.Status.Network {
+			for _, addr := range network.IPAddrs {
+				if sameIP(address, addr) {
+					conditions.MarkFalse(byoCluster, infrav1.KubeVIPReady, infrav1.KubeVIPAddressInUseReason, clusterv1.ConditionSeverityError,
+						"%s is an address of ByoHost %s/%s", address, host.Namespace, host.Name)
+					return nil
+				}
+			}
+		}
+	}
+
+	conditions.MarkTrue(byoCluster, infrav1.KubeVIPReady)
+	return nil
+}
+
+// reconcileLoadBalancer makes the load balancer of the ByoCluster serve its control plane hosts,
+// and sets the control plane endpoint to the address of the load balancer if it is not set
+func (r ByoClusterReconciler) reconcileLoadBalancer(ctx context.Context, cluster *clusterv1.Cluster, byoCluster *infrav1.ByoCluster) error {
+	logger := log.FromContext(ctx)
+
+	if byoCluster.Spec.KubeVIP != nil {
+		conditions.MarkFalse(byoCluster, infrav1.LoadBalancerReady, infrav1.InvalidLoadBalancerConfigReason, clusterv1.ConditionSeverityError,
+			"a load balancer cannot be set together with kube-vip")
+		return nil
+	}
+	lb, err := NewLoadBalancer(r.Client, byoCluster)
+	if err != nil {
+		logger.Info("Invalid load balancer configuration", "reason", err.Error())
+		conditions.MarkFalse(byoCluster, infrav1.LoadBalancerReady, infrav1.InvalidLoadBalancerConfigReason, clusterv1.ConditionSeverityError, err.Error())
+		return nil
+	}
+
+	backends, err := r.controlPlaneBackends(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	address, err := lb.Reconcile(ctx, cluster, byoCluster, backends)
+	if errors.Is(err, errNoLoadBalancerHost) {
+		logger.Info("No hosts found for the load balancer, waiting..")
+		conditions.MarkFalse(byoCluster, infrav1.LoadBalancerReady, infrav1.LoadBalancerHostsUnavailableReason, clusterv1.ConditionSeverityInfo, "")
+		return nil
+	}
+	if err != nil {
+		logger.Error(err, "failed to reconcile the load balancer")
+		conditions.MarkFalse(byoCluster, infrav1.LoadBalancerReady, infrav1.LoadBalancerFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return nil
+	}
+
+	if byoCluster.Spec.ControlPlaneEndpoint.Host == "" {
+		byoCluster.Spec.ControlPlaneEndpoint.Host = address
+	}
+	if byoCluster.Spec.ControlPlaneEndpoint.Host == "" {
+		conditions.MarkFalse(byoCluster, infrav1.LoadBalancerReady, infrav1.LoadBalancerFailedReason, clusterv1.ConditionSeverityWarning,
+			"the load balancer has no address")
+		return nil
+	}
+	conditions.MarkTrue(byoCluster, infrav1.LoadBalancerReady)
+	return nil
+}
+
+// controlPlaneBackends returns the load balancer backends of the control plane ByoMachines of the cluster,
+// i.e. the addresses of their ByoHosts. Machines being deleted are not served anymore.
+func (r ByoClusterReconciler) controlPlaneBackends(ctx context.Context, cluster *clusterv1.Cluster) ([]LoadBalancerBackend, error) {
+	byoMachines, err := GetByoMachinesInCluster(ctx, r.Client, cluster.Namespace, cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+	controlPlaneMachines := make(map[string]bool)
+	for _, byoMachine := range byoMachines {
+		if _, ok := byoMachine.Labels[clusterv1.MachineControlPlaneLabel]; ok && byoMachine.DeletionTimestamp.IsZero() {
+			controlPlaneMachines[byoMachine.Namespace+"."+byoMachine.Name] = true
+		}
+	}
+	backends := []LoadBalancerBackend{}
+	if len(controlPlaneMachines) == 0 {
+		return backends, nil
+	}
+
+	hostsList := &infrav1.ByoHostList{}
+	err = r.Client.List(ctx, hostsList, client.MatchingLabels{clusterv1.ClusterNameLabel: cluster.Name}, client.HasLabels{infrav1.AttachedByoMachineLabel})
+	if err != nil {
+		return nil, err
+	}
+	for i := range hostsList.Items {
+		host := &hostsList.Items[i]
+		address := hostAddress(host)
+		if !controlPlaneMachines[host.Labels[infrav1.AttachedByoMachineLabel]] || address == "" {
+			continue
+		}
+		backends = append(backends, LoadBalancerBackend{Name: host.Name, Address: address, Port: int32(DefaultAPIEndpointPort)})
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i].Name < backends[j].Name })
+	return backends, nil
+}
+
+// sameIP returns whether addr, an IP address or an IP address with its prefix length, is ip
+func sameIP(ip net.IP, addr string) bool {
+	other := net.ParseIP(addr)
+	if other == nil {
+		other, _, _ = net.ParseCIDR(addr)
+	}
+	return other != nil && other.Equal(ip)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ByoClusterReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -190,5 +399,54 @@ func (r *ByoClusterReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Ma
 			&source.Kind{Type: &clusterv1.Cluster{}},
 			handler.EnqueueRequestsFromMapFunc(clusterutilv1.ClusterToInfrastructureMapFunc(ctx, infrav1.GroupVersion.WithKind(clusterControlledTypeGVK.Kind), mgr.GetClient(), &infrav1.ByoCluster{})),
 		).
+		// Watch the control plane machines and their hosts to keep the load balancer backends in sync.
+		Watches(
+			&source.Kind{Type: &infrav1.ByoMachine{}},
+			handler.EnqueueRequestsFromMapFunc(r.ByoMachineToByoCluster),
+		).
+		Watches(
+			&source.Kind{Type: &infrav1.ByoHost{}},
+			handler.EnqueueRequestsFromMapFunc(r.ByoHostToByoCluster),
+		).
 		Complete(r)
 }
+
+// ByoMachineToByoCluster maps a control plane ByoMachine to the ByoCluster of its cluster
+// when the ByoCluster configures a load balancer
+func (r *ByoClusterReconciler) ByoMachineToByoCluster(o client.Object) []reconcile.Request {
+	if _, ok := o.GetLabels()[clusterv1.MachineControlPlaneLabel]; !ok {
+		return nil
+	}
+	return r.loadBalancedByoCluster(o.GetNamespace(), o.GetLabels()[clusterv1.ClusterNameLabel])
+}
+
+// ByoHostToByoCluster maps an attached ByoHost to the ByoCluster of its cluster
+// when the ByoCluster configures a load balancer
+func (r *ByoClusterReconciler) ByoHostToByoCluster(o client.Object) []reconcile.Request {
+	h, ok := o.(*infrav1.ByoHost)
+	if !ok || h.Status.MachineRef == nil {
+		return nil
+	}
+	return r.loadBalancedByoCluster(h.Status.MachineRef.Namespace, h.Labels[clusterv1.ClusterNameLabel])
+}
+
+// loadBalancedByoCluster returns a request for the ByoCluster of the cluster if it configures a load balancer
+func (r *ByoClusterReconciler) loadBalancedByoCluster(namespace, clusterName string) []reconcile.Request {
+	if clusterName == "" {
+		return nil
+	}
+	ctx := context.TODO()
+	cluster := &clusterv1.Cluster{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: clusterName}, cluster); err != nil {
+		return nil
+	}
+	ref := cluster.Spec.InfrastructureRef
+	if ref == nil || ref.Kind != clusterControlledTypeGVK.Kind {
+		return nil
+	}
+	byoCluster := &infrav1.ByoCluster{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, byoCluster); err != nil || byoCluster.Spec.LoadBalancer == nil {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: namespace, Name: ref.Name}}}
+}
@@ -5,16 +5,27 @@ package controllers_test
 
 import (
 	"context"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
 	controllers "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/controllers/infrastructure"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/builder"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1alpha1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -134,4 +145,443 @@ var _ = Describe("Controllers/ByoclusterController", func() {
 		Expect(createdByoCluster.Spec.ControlPlaneEndpoint.Port).To(Equal(int32(controllers.DefaultAPIEndpointPort)))
 	})
 
+	Context("When the ByoCluster configures kube-vip", func() {
+		var byoClusterLookupKey types.NamespacedName
+
+		BeforeEach(func() {
+			cluster = builder.Cluster(defaultNamespace, "byocluster-kube-vip").
+				Build()
+			Expect(k8sClientUncached.Create(ctx, cluster)).Should(Succeed())
+			WaitForObjectsToBePopulatedInCache(cluster)
+		})
+
+		createByoCluster := func(kubeVIP *infrastructurev1beta1.KubeVIPSpec) {
+			byoCluster = builder.ByoCluster(defaultNamespace, "byocluster-kube-vip").
+				WithOwnerCluster(cluster).
+				WithControlPlaneEndpoint("10.20.30.40", 6443).
+				WithKubeVIP(kubeVIP).
+				Build()
+			Expect(k8sClientUncached.Create(ctx, byoCluster)).Should(Succeed())
+			WaitForObjectsToBePopulatedInCache(byoCluster)
+			byoClusterLookupKey = types.NamespacedName{Name: byoCluster.Name, Namespace: byoCluster.Namespace}
+		}
+
+		reconcileAndGetCondition := func() (*infrastructurev1beta1.ByoCluster, *clusterv1.Condition) {
+			_, err := byoClusterReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoClusterLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdByoCluster := &infrastructurev1beta1.ByoCluster{}
+			Expect(k8sClientUncached.Get(ctx, byoClusterLookupKey, createdByoCluster)).Should(Succeed())
+			return createdByoCluster, conditions.Get(createdByoCluster, infrastructurev1beta1.KubeVIPReady)
+		}
+
+		AfterEach(func() {
+			Expect(k8sClientUncached.Get(ctx, byoClusterLookupKey, byoCluster)).Should(Succeed())
+			controllerutil.RemoveFinalizer(byoCluster, infrastructurev1beta1.ClusterFinalizer)
+			Expect(k8sClientUncached.Update(ctx, byoCluster)).Should(Succeed())
+			Expect(k8sClientUncached.Delete(ctx, byoCluster)).Should(Succeed())
+			Expect(k8sClientUncached.Delete(ctx, cluster)).Should(Succeed())
+		})
+
+		It("should be ready when the VIP is not in use", func() {
+			createByoCluster(&infrastructurev1beta1.KubeVIPSpec{Mode: infrastructurev1beta1.KubeVIPModeARP})
+
+			createdByoCluster, condition := reconcileAndGetCondition()
+			Expect(createdByoCluster.Status.Ready).To(BeTrue())
+			Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		})
+
+		It("should not be ready when the kube-vip configuration is invalid", func() {
+			createByoCluster(&infrastructurev1beta1.KubeVIPSpec{Mode: infrastructurev1beta1.KubeVIPModeBGP})
+
+			createdByoCluster, condition := reconcileAndGetCondition()
+			Expect(createdByoCluster.Status.Ready).To(BeFalse())
+			Expect(*condition).To(conditions.MatchCondition(clusterv1.Condition{
+				Type:     infrastructurev1beta1.KubeVIPReady,
+				Status:   corev1.ConditionFalse,
+				Reason:   infrastructurev1beta1.InvalidKubeVIPConfigReason,
+				Severity: clusterv1.ConditionSeverityError,
+				Message:  "kube-vip BGP peering is required in BGP mode",
+			}))
+		})
+
+		It("should not be ready when the VIP is the control plane endpoint of another cluster", func() {
+			otherByoCluster := builder.ByoCluster(defaultNamespace, "byocluster-same-endpoint").
+				WithControlPlaneEndpoint("10.20.30.40", 6443).
+				Build()
+			Expect(k8sClientUncached.Create(ctx, otherByoCluster)).Should(Succeed())
+			defer func() { Expect(k8sClientUncached.Delete(ctx, otherByoCluster)).Should(Succeed()) }()
+			WaitForObjectsToBePopulatedInCache(otherByoCluster)
+			createByoCluster(&infrastructurev1beta1.KubeVIPSpec{})
+
+			createdByoCluster, condition := reconcileAndGetCondition()
+			Expect(createdByoCluster.Status.Ready).To(BeFalse())
+			Expect(condition.Reason).To(Equal(infrastructurev1beta1.KubeVIPAddressInUseReason))
+			Expect(condition.Message).To(Equal(fmt.Sprintf("10.20.30.40 is the control plane endpoint of ByoCluster %s/%s", defaultNamespace, otherByoCluster.Name)))
+		})
+
+		It("should not be ready when the VIP is an address of a host", func() {
+			byoHost := builder.ByoHost(defaultNamespace, "host-with-vip").Build()
+			Expect(k8sClientUncached.Create(ctx, byoHost)).Should(Succeed())
+			defer func() { Expect(k8sClientUncached.Delete(ctx, byoHost)).Should(Succeed()) }()
+			ph, err := patch.NewHelper(byoHost, k8sClientUncached)
+			Expect(err).ShouldNot(HaveOccurred())
+			byoHost.Status.Network = []infrastructurev1beta1.NetworkStatus{{MACAddr: "00:50:56:a1:b2:c3", IPAddrs: []string{"10.20.30.40/24"}}}
+			Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+			WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+				return len(object.(*infrastructurev1beta1.ByoHost).Status.Network) > 0
+			})
+			createByoCluster(&infrastructurev1beta1.KubeVIPSpec{})
+
+			createdByoCluster, condition := reconcileAndGetCondition()
+			Expect(createdByoCluster.Status.Ready).To(BeFalse())
+			Expect(condition.Reason).To(Equal(infrastructurev1beta1.KubeVIPAddressInUseReason))
+			Expect(condition.Message).To(Equal(fmt.Sprintf("10.20.30.40 is an address of ByoHost %s/%s", defaultNamespace, byoHost.Name)))
+		})
+	})
+
+	Context("When the ByoCluster configures a load balancer", func() {
+		var byoClusterLookupKey types.NamespacedName
+
+		BeforeEach(func() {
+			cluster = builder.Cluster(defaultNamespace, "byocluster-load-balancer").
+				Build()
+			Expect(k8sClientUncached.Create(ctx, cluster)).Should(Succeed())
+			WaitForObjectsToBePopulatedInCache(cluster)
+		})
+
+		createNamedByoCluster := func(name string, loadBalancer *infrastructurev1beta1.LoadBalancerSpec) {
+			byoCluster = builder.ByoCluster(defaultNamespace, name).
+				WithOwnerCluster(cluster).
+				WithLoadBalancer(loadBalancer).
+				Build()
+			Expect(k8sClientUncached.Create(ctx, byoCluster)).Should(Succeed())
+			WaitForObjectsToBePopulatedInCache(byoCluster)
+			byoClusterLookupKey = types.NamespacedName{Name: byoCluster.Name, Namespace: byoCluster.Namespace}
+		}
+
+		createByoCluster := func(loadBalancer *infrastructurev1beta1.LoadBalancerSpec) {
+			createNamedByoCluster("byocluster-load-balancer", loadBalancer)
+		}
+
+		createByoHost := func(name, address string, hostLabels map[string]string) *infrastructurev1beta1.ByoHost {
+			byoHost := builder.ByoHost(defaultNamespace, name).WithLabels(hostLabels).Build()
+			Expect(k8sClientUncached.Create(ctx, byoHost)).Should(Succeed())
+			DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClientUncached.Delete(ctx, byoHost))).Should(Succeed()) })
+			ph, err := patch.NewHelper(byoHost, k8sClientUncached)
+			Expect(err).ShouldNot(HaveOccurred())
+			byoHost.Status.Network = []infrastructurev1beta1.NetworkStatus{{MACAddr: "00:50:56:a1:b2:c3", IPAddrs: []string{address + "/24"}, IsDefault: true}}
+			Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+			WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+				return len(object.(*infrastructurev1beta1.ByoHost).Status.Network) > 0
+			})
+			return byoHost
+		}
+
+		createControlPlaneHost := func(address string) *infrastructurev1beta1.ByoHost {
+			byoMachine := builder.ByoMachine(defaultNamespace, "control-plane-").WithClusterLabel(cluster.Name).Build()
+			byoMachine.Labels[clusterv1.MachineControlPlaneLabel] = ""
+			Expect(k8sClientUncached.Create(ctx, byoMachine)).Should(Succeed())
+			DeferCleanup(func() { Expect(k8sClientUncached.Delete(ctx, byoMachine)).Should(Succeed()) })
+			WaitForObjectsToBePopulatedInCache(byoMachine)
+			return createByoHost("control-plane-host-", address, map[string]string{
+				clusterv1.ClusterNameLabel:                    cluster.Name,
+				infrastructurev1beta1.AttachedByoMachineLabel: byoMachine.Namespace + "." + byoMachine.Name,
+			})
+		}
+
+		reconcileAndGetCondition := func() (*infrastructurev1beta1.ByoCluster, *clusterv1.Condition) {
+			_, err := byoClusterReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoClusterLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdByoCluster := &infrastructurev1beta1.ByoCluster{}
+			Expect(k8sClientUncached.Get(ctx, byoClusterLookupKey, createdByoCluster)).Should(Succeed())
+			return createdByoCluster, conditions.Get(createdByoCluster, infrastructurev1beta1.LoadBalancerReady)
+		}
+
+		deleteByoCluster := func() {
+			Expect(k8sClientUncached.Delete(ctx, byoCluster)).Should(Succeed())
+			WaitForObjectToBeUpdatedInCache(byoCluster, func(object client.Object) bool {
+				return !object.(*infrastructurev1beta1.ByoCluster).ObjectMeta.DeletionTimestamp.IsZero()
+			})
+			_, err := byoClusterReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoClusterLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		AfterEach(func() {
+			err := k8sClientUncached.Get(ctx, byoClusterLookupKey, byoCluster)
+			if err == nil {
+				controllerutil.RemoveFinalizer(byoCluster, infrastructurev1beta1.ClusterFinalizer)
+				Expect(k8sClientUncached.Update(ctx, byoCluster)).Should(Succeed())
+				Expect(client.IgnoreNotFound(k8sClientUncached.Delete(ctx, byoCluster))).Should(Succeed())
+			}
+			Expect(k8sClientUncached.Delete(ctx, cluster)).Should(Succeed())
+		})
+
+		Context("With HAProxy", func() {
+			haproxy := func(pool string) *infrastructurev1beta1.LoadBalancerSpec {
+				return &infrastructurev1beta1.LoadBalancerSpec{HAProxy: &infrastructurev1beta1.HAProxyLoadBalancerSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": pool}},
+				}}
+			}
+
+			It("should run the load balancer of the control plane machines on a host of the pool", func() {
+				loadBalancerHost := createByoHost("load-balancer-host-", "10.10.0.2", map[string]string{"pool": "load-balancers"})
+				controlPlaneHost := createControlPlaneHost("10.10.0.10")
+				createByoCluster(haproxy("load-balancers"))
+
+				createdByoCluster, condition := reconcileAndGetCondition()
+				Expect(createdByoCluster.Status.Ready).To(BeTrue())
+				Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+				Expect(createdByoCluster.Spec.ControlPlaneEndpoint.Host).To(Equal("10.10.0.2"))
+
+				claimedHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClientUncached.Get(ctx, client.ObjectKeyFromObject(loadBalancerHost), claimedHost)).Should(Succeed())
+				Expect(claimedHost.Labels).To(HaveKeyWithValue(infrastructurev1beta1.LoadBalancerHostLabel, defaultNamespace+".byocluster-load-balancer"))
+				Expect(claimedHost.Labels).To(HaveKeyWithValue(clusterv1.ClusterNameLabel, cluster.Name))
+				Expect(claimedHost.Spec.LoadBalancerSecret.Name).To(Equal("byocluster-load-balancer-haproxy"))
+
+				secret := &corev1.Secret{}
+				Expect(k8sClientUncached.Get(ctx, types.NamespacedName{Name: claimedHost.Spec.LoadBalancerSecret.Name, Namespace: defaultNamespace}, secret)).Should(Succeed())
+				config := string(secret.Data[infrastructurev1beta1.HAProxyConfigKey])
+				Expect(config).To(ContainSubstring("bind *:6443"))
+				Expect(config).To(ContainSubstring(fmt.Sprintf("server %s 10.10.0.10:6443 check", controlPlaneHost.Name)))
+			})
+
+			It("should release the load balancer host when the ByoCluster is deleted", func() {
+				loadBalancerHost := createByoHost("load-balancer-host-", "10.10.0.2", map[string]string{"pool": "released-load-balancers"})
+				createByoCluster(haproxy("released-load-balancers"))
+				_, condition := reconcileAndGetCondition()
+				Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+				WaitForObjectToBeUpdatedInCache(loadBalancerHost, func(object client.Object) bool {
+					return object.(*infrastructurev1beta1.ByoHost).Spec.LoadBalancerSecret != nil
+				})
+
+				deleteByoCluster()
+
+				releasedHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClientUncached.Get(ctx, client.ObjectKeyFromObject(loadBalancerHost), releasedHost)).Should(Succeed())
+				Expect(releasedHost.Labels).NotTo(HaveKey(infrastructurev1beta1.LoadBalancerHostLabel))
+				Expect(releasedHost.Labels).NotTo(HaveKey(clusterv1.ClusterNameLabel))
+				Expect(releasedHost.Spec.LoadBalancerSecret).To(BeNil())
+			})
+
+			It("should claim a host for a ByoCluster whose namespace and name do not fit in a label value", func() {
+				loadBalancerHost := createByoHost("load-balancer-host-", "10.10.0.2", map[string]string{"pool": "long-name-load-balancers"})
+				createNamedByoCluster("byocluster-"+strings.Repeat("long-name-", 6), haproxy("long-name-load-balancers"))
+
+				_, condition := reconcileAndGetCondition()
+				Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+				claimedHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClientUncached.Get(ctx, client.ObjectKeyFromObject(loadBalancerHost), claimedHost)).Should(Succeed())
+				Expect(claimedHost.Labels).To(HaveKey(infrastructurev1beta1.LoadBalancerHostLabel))
+				Expect(len(claimedHost.Labels[infrastructurev1beta1.LoadBalancerHostLabel])).To(BeNumerically("<=", 63))
+				WaitForObjectToBeUpdatedInCache(loadBalancerHost, func(object client.Object) bool {
+					return object.(*infrastructurev1beta1.ByoHost).Spec.LoadBalancerSecret != nil
+				})
+
+				// the claimed host is found again on the next reconcile
+				_, condition = reconcileAndGetCondition()
+				Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+			})
+
+			It("should not claim a host of another namespace", func() {
+				otherNamespace := builder.Namespace("tenant-b").Build()
+				Expect(client.IgnoreAlreadyExists(k8sClientUncached.Create(ctx, otherNamespace))).Should(Succeed())
+				otherHost := builder.ByoHost(otherNamespace.Name, "load-balancer-host-").WithLabels(map[string]string{"pool": "tenant-load-balancers"}).Build()
+				Expect(k8sClientUncached.Create(ctx, otherHost)).Should(Succeed())
+				DeferCleanup(func() { Expect(k8sClientUncached.Delete(ctx, otherHost)).Should(Succeed()) })
+				ph, err := patch.NewHelper(otherHost, k8sClientUncached)
+				Expect(err).ShouldNot(HaveOccurred())
+				otherHost.Status.Network = []infrastructurev1beta1.NetworkStatus{{MACAddr: "00:50:56:a1:b2:c4", IPAddrs: []string{"10.10.0.3/24"}, IsDefault: true}}
+				Expect(ph.Patch(ctx, otherHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+				WaitForObjectToBeUpdatedInCache(otherHost, func(object client.Object) bool {
+					return len(object.(*infrastructurev1beta1.ByoHost).Status.Network) > 0
+				})
+				createByoCluster(haproxy("tenant-load-balancers"))
+
+				_, condition := reconcileAndGetCondition()
+				Expect(condition.Reason).To(Equal(infrastructurev1beta1.LoadBalancerHostsUnavailableReason))
+				unclaimedHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClientUncached.Get(ctx, client.ObjectKeyFromObject(otherHost), unclaimedHost)).Should(Succeed())
+				Expect(unclaimedHost.Labels).NotTo(HaveKey(infrastructurev1beta1.LoadBalancerHostLabel))
+			})
+
+			It("should not be ready when no host is available", func() {
+				createByoCluster(haproxy("empty-pool"))
+
+				createdByoCluster, condition := reconcileAndGetCondition()
+				Expect(createdByoCluster.Status.Ready).To(BeFalse())
+				Expect(*condition).To(conditions.MatchCondition(clusterv1.Condition{
+					Type:     infrastructurev1beta1.LoadBalancerReady,
+					Status:   corev1.ConditionFalse,
+					Reason:   infrastructurev1beta1.LoadBalancerHostsUnavailableReason,
+					Severity: clusterv1.ConditionSeverityInfo,
+				}))
+			})
+		})
+
+		Context("With a webhook", func() {
+			var (
+				server   *httptest.Server
+				requests chan string
+			)
+
+			webhook := func() *infrastructurev1beta1.LoadBalancerSpec {
+				return &infrastructurev1beta1.LoadBalancerSpec{Webhook: &infrastructurev1beta1.WebhookLoadBalancerSpec{
+					URL:      server.URL,
+					CABundle: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+				}}
+			}
+
+			BeforeEach(func() {
+				requests = make(chan string, 10)
+				server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, _ := io.ReadAll(r.Body)
+					requests <- r.Method + " " + string(body)
+					if r.Method == http.MethodPost {
+						_, _ = w.Write([]byte(`{"host": "192.168.10.100"}`))
+					}
+				}))
+			})
+
+			AfterEach(func() {
+				server.Close()
+			})
+
+			It("should send the control plane machines to the webhook", func() {
+				controlPlaneHost := createControlPlaneHost("10.10.0.11")
+				createByoCluster(webhook())
+
+				createdByoCluster, condition := reconcileAndGetCondition()
+				Expect(createdByoCluster.Status.Ready).To(BeTrue())
+				Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+				Expect(createdByoCluster.Spec.ControlPlaneEndpoint.Host).To(Equal("192.168.10.100"))
+				Expect(<-requests).To(Equal(fmt.Sprintf(
+					`POST {"cluster":"%s/byocluster-load-balancer","controlPlaneEndpoint":{"host":"","port":6443},"backends":[{"name":"%s","address":"10.10.0.11","port":6443}]}`,
+					defaultNamespace, controlPlaneHost.Name)))
+			})
+
+			It("should release the load balancer when the ByoCluster is deleted", func() {
+				createByoCluster(webhook())
+				_, condition := reconcileAndGetCondition()
+				Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+				Expect(<-requests).To(HavePrefix("POST "))
+
+				deleteByoCluster()
+				Expect(<-requests).To(HavePrefix("DELETE "))
+			})
+
+			It("should not be ready when the webhook fails", func() {
+				server.Close()
+				createByoCluster(webhook())
+
+				createdByoCluster, condition := reconcileAndGetCondition()
+				Expect(createdByoCluster.Status.Ready).To(BeFalse())
+				Expect(condition.Reason).To(Equal(infrastructurev1beta1.LoadBalancerFailedReason))
+			})
+
+			It("should not send requests to an http URL", func() {
+				createByoCluster(&infrastructurev1beta1.LoadBalancerSpec{Webhook: &infrastructurev1beta1.WebhookLoadBalancerSpec{URL: "http://10.0.0.1/internal"}})
+
+				createdByoCluster, condition := reconcileAndGetCondition()
+				Expect(createdByoCluster.Status.Ready).To(BeFalse())
+				Expect(condition.Reason).To(Equal(infrastructurev1beta1.InvalidLoadBalancerConfigReason))
+				Expect(condition.Message).To(Equal("the load balancer webhook URL must be an https URL"))
+			})
+		})
+
+		It("should not be ready when kube-vip is configured too", func() {
+			byoCluster = builder.ByoCluster(defaultNamespace, "byocluster-load-balancer").
+				WithOwnerCluster(cluster).
+				WithControlPlaneEndpoint("10.20.30.50", 6443).
+				WithKubeVIP(&infrastructurev1beta1.KubeVIPSpec{}).
+				WithLoadBalancer(&infrastructurev1beta1.LoadBalancerSpec{Webhook: &infrastructurev1beta1.WebhookLoadBalancerSpec{URL: "https://lb.example.com"}}).
+				Build()
+			Expect(k8sClientUncached.Create(ctx, byoCluster)).Should(Succeed())
+			WaitForObjectsToBePopulatedInCache(byoCluster)
+			byoClusterLookupKey = types.NamespacedName{Name: byoCluster.Name, Namespace: byoCluster.Namespace}
+
+			createdByoCluster, condition := reconcileAndGetCondition()
+			Expect(createdByoCluster.Status.Ready).To(BeFalse())
+			Expect(condition.Reason).To(Equal(infrastructurev1beta1.InvalidLoadBalancerConfigReason))
+			Expect(condition.Message).To(Equal("a load balancer cannot be set together with kube-vip"))
+		})
+	})
+
+	Context("When the ByoCluster claims its control plane endpoint from an IP pool", func() {
+		var byoClusterLookupKey types.NamespacedName
+
+		BeforeEach(func() {
+			cluster = builder.Cluster(defaultNamespace, "byocluster-ip-pool").
+				Build()
+			Expect(k8sClientUncached.Create(ctx, cluster)).Should(Succeed())
+			WaitForObjectsToBePopulatedInCache(cluster)
+
+			byoCluster = builder.ByoCluster(defaultNamespace, "byocluster-ip-pool").
+				WithOwnerCluster(cluster).
+				WithControlPlaneEndpointIPPool(&corev1.TypedLocalObjectReference{
+					APIGroup: pointer.String("ipam.cluster.x-k8s.io"),
+					Kind:     "InClusterIPPool",
+					Name:     "control-plane-pool",
+				}).
+				Build()
+			Expect(k8sClientUncached.Create(ctx, byoCluster)).Should(Succeed())
+			WaitForObjectsToBePopulatedInCache(byoCluster)
+			byoClusterLookupKey = types.NamespacedName{Name: byoCluster.Name, Namespace: byoCluster.Namespace}
+		})
+
+		AfterEach(func() {
+			Expect(k8sClientUncached.Get(ctx, byoClusterLookupKey, byoCluster)).Should(Succeed())
+			controllerutil.RemoveFinalizer(byoCluster, infrastructurev1beta1.ClusterFinalizer)
+			Expect(k8sClientUncached.Update(ctx, byoCluster)).Should(Succeed())
+			Expect(k8sClientUncached.Delete(ctx, byoCluster)).Should(Succeed())
+			Expect(k8sClientUncached.Delete(ctx, cluster)).Should(Succeed())
+		})
+
+		It("should set the control plane endpoint once the IP address is allocated", func() {
+			_, err := byoClusterReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoClusterLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdByoCluster := &infrastructurev1beta1.ByoCluster{}
+			Expect(k8sClientUncached.Get(ctx, byoClusterLookupKey, createdByoCluster)).Should(Succeed())
+			Expect(createdByoCluster.Spec.ControlPlaneEndpoint.Host).To(BeEmpty())
+			Expect(*conditions.Get(createdByoCluster, infrastructurev1beta1.IPAddressesClaimed)).To(conditions.MatchCondition(clusterv1.Condition{
+				Type:     infrastructurev1beta1.IPAddressesClaimed,
+				Status:   corev1.ConditionFalse,
+				Reason:   infrastructurev1beta1.WaitingForIPAddressReason,
+				Severity: clusterv1.ConditionSeverityInfo,
+			}))
+
+			claim := &ipamv1.IPAddressClaim{}
+			claimLookupKey := types.NamespacedName{Name: byoCluster.Name + "-control-plane-endpoint", Namespace: byoCluster.Namespace}
+			Expect(k8sClientUncached.Get(ctx, claimLookupKey, claim)).Should(Succeed())
+			Expect(claim.Spec.PoolRef.Name).To(Equal("control-plane-pool"))
+
+			address := &ipamv1.IPAddress{
+				ObjectMeta: metav1.ObjectMeta{Name: claim.Name, Namespace: claim.Namespace},
+				Spec: ipamv1.IPAddressSpec{
+					ClaimRef: corev1.LocalObjectReference{Name: claim.Name},
+					PoolRef:  claim.Spec.PoolRef,
+					Address:  "10.20.30.60",
+					Prefix:   24,
+				},
+			}
+			Expect(k8sClientUncached.Create(ctx, address)).Should(Succeed())
+			defer func() { Expect(k8sClientUncached.Delete(ctx, address)).Should(Succeed()) }()
+			claim.Status.AddressRef = corev1.LocalObjectReference{Name: address.Name}
+			Expect(k8sClientUncached.Status().Update(ctx, claim)).Should(Succeed())
+			WaitForObjectToBeUpdatedInCache(claim, func(object client.Object) bool {
+				return object.(*ipamv1.IPAddressClaim).Status.AddressRef.Name != ""
+			})
+			WaitForObjectsToBePopulatedInCache(address)
+
+			_, err = byoClusterReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoClusterLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClientUncached.Get(ctx, byoClusterLookupKey, createdByoCluster)).Should(Succeed())
+			Expect(createdByoCluster.Spec.ControlPlaneEndpoint.Host).To(Equal("10.20.30.60"))
+			Expect(conditions.IsTrue(createdByoCluster, infrastructurev1beta1.IPAddressesClaimed)).To(BeTrue())
+		})
+	})
 })
@@ -5,10 +5,22 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api/util"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
@@ -24,19 +36,241 @@ type ByoHostReconciler struct {
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohosts/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohosts/finalizers,verbs=update
 //+kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=create;get;watch
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the ByoHost object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
+// Reconcile grants the agent of a ByoHost read access to exactly the bootstrap, installation and
+// load balancer secrets referenced on its ByoHost, in the namespace of the ByoHost. Only the secrets of
+// the ByoMachine the host is attached to and of the ByoCluster it runs the load balancer of are granted.
+// A Role limited to the secret names and a RoleBinding to the host user are maintained. They are
+// removed once the references are cleared or the ByoHost is deleted.
 func (r *ByoHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
-	_ = log.FromContext(ctx)
-	return ctrl.Result{}, nil
+	logger := log.FromContext(ctx)
+
+	byoHost := &infrastructurev1beta1.ByoHost{}
+	err := r.Client.Get(ctx, req.NamespacedName, byoHost)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		logger.Info("ByoHost not found, revoking its secret access")
+		return ctrl.Result{}, r.reconcileSecretAccess(ctx, req.NamespacedName, nil)
+	}
+
+	if !byoHost.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.reconcileSecretAccess(ctx, req.NamespacedName, nil)
+	}
+	secrets, err := r.hostSecrets(ctx, byoHost)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.reconcileSecretAccess(ctx, req.NamespacedName, secrets)
+}
+
+// hostSecrets returns the names of the secrets referenced on the ByoHost, by namespace. The references
+// to another namespace than the one of the ByoHost, or to other secrets than the ones the controller
+// manager sets, are ignored so that the host cannot be granted the secrets of others.
+func (r *ByoHostReconciler) hostSecrets(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) (map[string][]string, error) {
+	logger := log.FromContext(ctx)
+
+	bootstrapSecrets, installationSecrets, err := r.machineSecrets(ctx, byoHost)
+	if err != nil {
+		return nil, err
+	}
+	loadBalancerSecrets, err := r.loadBalancerSecrets(ctx, byoHost)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, secret := range []struct {
+		field   string
+		ref     *corev1.ObjectReference
+		allowed []string
+	}{
+		{"spec.bootstrapSecret", byoHost.Spec.BootstrapSecret, bootstrapSecrets},
+		{"spec.installationSecret", byoHost.Spec.InstallationSecret, installationSecrets},
+		{"spec.loadBalancerSecret", byoHost.Spec.LoadBalancerSecret, loadBalancerSecrets},
+	} {
+		if secret.ref == nil || secret.ref.Name == "" {
+			continue
+		}
+		if (secret.ref.Namespace != "" && secret.ref.Namespace != byoHost.Namespace) || !containsString(secret.allowed, secret.ref.Name) {
+			logger.Info("ignoring a secret reference not set by the controller manager", "field", secret.field,
+				"namespace", secret.ref.Namespace, "name", secret.ref.Name)
+			continue
+		}
+		names = append(names, secret.ref.Name)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+	return map[string][]string{byoHost.Namespace: names}, nil
+}
+
+// machineSecrets returns the names of the bootstrap and installation secrets of the ByoMachine the host is attached to
+func (r *ByoHostReconciler) machineSecrets(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) (bootstrapSecrets, installationSecrets []string, err error) {
+	ref := byoHost.Status.MachineRef
+	if ref == nil || ref.Namespace != byoHost.Namespace {
+		return nil, nil, nil
+	}
+	byoMachine := &infrastructurev1beta1.ByoMachine{}
+	if err = r.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, byoMachine); err != nil {
+		return nil, nil, client.IgnoreNotFound(err)
+	}
+	if ref.UID != "" && ref.UID != byoMachine.UID {
+		return nil, nil, nil
+	}
+
+	if byoHost.Status.EncryptionPublicKey != "" {
+		// a host publishing an encryption key only gets the bootstrap data encrypted to it, not the
+		// plaintext bootstrap secret of the machine which remains in the namespace
+		bootstrapSecrets = []string{encryptedBootstrapDataSecretName(byoMachine)}
+	} else {
+		bootstrapSecrets = []string{bootstrapDataSecretName(byoMachine)}
+		machine, err := util.GetOwnerMachine(ctx, r.Client, byoMachine.ObjectMeta)
+		if err != nil {
+			return nil, nil, client.IgnoreNotFound(err)
+		}
+		if machine != nil && machine.Spec.Bootstrap.DataSecretName != nil {
+			bootstrapSecrets = append(bootstrapSecrets, *machine.Spec.Bootstrap.DataSecretName)
+		}
+	}
+
+	if byoMachine.Spec.InstallerRef != nil {
+		installerConfig, err := getInstallerConfig(ctx, r.Client, byoMachine)
+		if err != nil {
+			return nil, nil, client.IgnoreNotFound(err)
+		}
+		if name, found, _ := unstructured.NestedString(installerConfig.Object, "status", "installationSecret", "name"); found {
+			installationSecrets = []string{name}
+		}
+	}
+	return bootstrapSecrets, installationSecrets, nil
+}
+
+// loadBalancerSecrets returns the name of the HAProxy configuration secret of the ByoCluster the host runs the load balancer of
+func (r *ByoHostReconciler) loadBalancerSecrets(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) ([]string, error) {
+	ref := byoHost.Spec.LoadBalancerSecret
+	if ref == nil || !strings.HasSuffix(ref.Name, haproxyConfigSecretSuffix) {
+		return nil, nil
+	}
+	byoCluster := &infrastructurev1beta1.ByoCluster{}
+	key := types.NamespacedName{Name: strings.TrimSuffix(ref.Name, haproxyConfigSecretSuffix), Namespace: byoHost.Namespace}
+	if err := r.Client.Get(ctx, key, byoCluster); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if byoHost.Labels[infrastructurev1beta1.LoadBalancerHostLabel] != loadBalancerHostLabelValue(byoCluster) {
+		return nil, nil
+	}
+	return []string{haproxyConfigSecretName(byoCluster)}, nil
+}
+
+// reconcileSecretAccess makes the Roles and RoleBindings of the host match the secrets it needs to read
+func (r *ByoHostReconciler) reconcileSecretAccess(ctx context.Context, host types.NamespacedName, secrets map[string][]string) error {
+	logger := log.FromContext(ctx)
+
+	roles := &rbacv1.RoleList{}
+	if err := r.Client.List(ctx, roles, client.HasLabels{infrastructurev1beta1.HostSecretReaderLabel}); err != nil {
+		return err
+	}
+	for i := range roles.Items {
+		role := &roles.Items[i]
+		if role.Annotations[infrastructurev1beta1.ByoHostAnnotation] != host.String() {
+			continue
+		}
+		// the roles of previous releases were named differently
+		if _, ok := secrets[role.Namespace]; ok && role.Name == SecretReaderName(host) {
+			continue
+		}
+		logger.Info("revoking secret access", "namespace", role.Namespace, "role", role.Name)
+		if err := r.revokeSecretAccess(ctx, role); err != nil {
+			return err
+		}
+	}
+
+	for namespace, names := range secrets {
+		if err := r.grantSecretAccess(ctx, host, namespace, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ByoHostReconciler) grantSecretAccess(ctx context.Context, host types.NamespacedName, namespace string, names []string) error {
+	objectMeta := metav1.ObjectMeta{
+		Name:      SecretReaderName(host),
+		Namespace: namespace,
+	}
+
+	role := &rbacv1.Role{ObjectMeta: objectMeta}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, role, func() error {
+		setSecretReaderMetadata(&role.ObjectMeta, host)
+		role.Rules = []rbacv1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: names,
+			Verbs:         []string{"get"},
+		}}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to grant %s access to secrets %v in namespace %s: %v", host, names, namespace, err)
+	}
+
+	roleBinding := &rbacv1.RoleBinding{ObjectMeta: objectMeta}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, roleBinding, func() error {
+		setSecretReaderMetadata(&roleBinding.ObjectMeta, host)
+		roleBinding.RoleRef = rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     role.Name,
+		}
+		roleBinding.Subjects = []rbacv1.Subject{{
+			APIGroup: rbacv1.GroupName,
+			Kind:     rbacv1.UserKind,
+			Name:     infrastructurev1beta1.HostUsernamePrefix + host.Name,
+		}}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to grant %s access to secrets %v in namespace %s: %v", host, names, namespace, err)
+	}
+	return nil
+}
+
+func (r *ByoHostReconciler) revokeSecretAccess(ctx context.Context, role *rbacv1.Role) error {
+	roleBinding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: role.Name, Namespace: role.Namespace}}
+	if err := r.Client.Delete(ctx, roleBinding); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete rolebinding %s/%s: %v", role.Namespace, role.Name, err)
+	}
+	if err := r.Client.Delete(ctx, role); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete role %s/%s: %v", role.Namespace, role.Name, err)
+	}
+	return nil
+}
+
+// maxSecretReaderHostNameLength caps the host name in the secret reader names below the 253 characters of object names
+const maxSecretReaderHostNameLength = 200
+
+// SecretReaderName returns the name of the Role and RoleBinding granting the host access to its secrets.
+// The hash of the namespaced name of the host keeps the names of different hosts apart.
+func SecretReaderName(host types.NamespacedName) string {
+	hash := sha256.Sum256([]byte(host.String()))
+	name := host.Name
+	if len(name) > maxSecretReaderHostNameLength {
+		name = name[:maxSecretReaderHostNameLength]
+	}
+	return fmt.Sprintf("byoh-host-%s-%x-secret-reader", name, hash[:5])
+}
+
+func setSecretReaderMetadata(objectMeta *metav1.ObjectMeta, host types.NamespacedName) {
+	if objectMeta.Labels == nil {
+		objectMeta.Labels = make(map[string]string)
+	}
+	objectMeta.Labels[infrastructurev1beta1.HostSecretReaderLabel] = ""
+	if objectMeta.Annotations == nil {
+		objectMeta.Annotations = make(map[string]string)
+	}
+	objectMeta.Annotations[infrastructurev1beta1.ByoHostAnnotation] = host.String()
 }
 
 // SetupWithManager sets up the controller with the Manager.
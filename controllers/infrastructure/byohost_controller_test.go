@@ -0,0 +1,234 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers_test
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	infrav1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	controllers "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/controllers/infrastructure"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/builder"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Controllers/ByoHostController", func() {
+	var (
+		ctx               = context.Background()
+		k8sClientUncached client.Client
+		byoHostReconciler *controllers.ByoHostReconciler
+		byoHost           *infrav1.ByoHost
+		byoHostLookupKey  types.NamespacedName
+		secretReaderKey   types.NamespacedName
+	)
+
+	reconcileByoHost := func() {
+		_, err := byoHostReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoHostLookupKey})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var clientErr error
+		k8sClientUncached, clientErr = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+		Expect(clientErr).NotTo(HaveOccurred())
+		// the uncached client lets the reconciler see the roles it just created
+		byoHostReconciler = &controllers.ByoHostReconciler{Client: k8sClientUncached}
+
+		byoHost = builder.ByoHost(defaultNamespace, "secret-access-host").Build()
+		byoHost.Name = "secret-access-host"
+		Expect(k8sClientUncached.Create(ctx, byoHost)).Should(Succeed())
+		byoHostLookupKey = types.NamespacedName{Name: byoHost.Name, Namespace: byoHost.Namespace}
+		secretReaderKey = types.NamespacedName{Name: controllers.SecretReaderName(byoHostLookupKey), Namespace: defaultNamespace}
+	})
+
+	AfterEach(func() {
+		Expect(client.IgnoreNotFound(k8sClientUncached.Delete(ctx, byoHost))).Should(Succeed())
+		reconcileByoHost()
+	})
+
+	It("should ignore the ByoHost if it is not found", func() {
+		_, err := byoHostReconciler.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      "non-existent-byohost",
+				Namespace: "non-existent-namespace"}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should not grant any secret access to a ByoHost without secrets", func() {
+		reconcileByoHost()
+
+		err := k8sClientUncached.Get(ctx, secretReaderKey, &rbacv1.Role{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should keep the secret reader names of different hosts apart", func() {
+		Expect(controllers.SecretReaderName(types.NamespacedName{Namespace: "a", Name: "b-c"})).
+			NotTo(Equal(controllers.SecretReaderName(types.NamespacedName{Namespace: "a-b", Name: "c"})))
+		Expect(len(controllers.SecretReaderName(types.NamespacedName{Namespace: defaultNamespace, Name: strings.Repeat("h", 253)}))).
+			To(BeNumerically("<=", 253))
+	})
+
+	Context("When the ByoHost references its secrets", func() {
+		var (
+			machine         *clusterv1.Machine
+			byoMachine      *infrav1.ByoMachine
+			installerConfig *infrav1.K8sInstallerConfig
+		)
+
+		BeforeEach(func() {
+			machine = builder.Machine(defaultNamespace, "secret-access-machine-").
+				WithClusterName(defaultClusterName).
+				WithClusterVersion("v1.23.5").
+				WithBootstrapDataSecret("bootstrap-secret").
+				Build()
+			Expect(k8sClientUncached.Create(ctx, machine)).Should(Succeed())
+			byoMachine = builder.ByoMachine(defaultNamespace, "secret-access-byomachine-").
+				WithOwnerMachine(machine).
+				Build()
+			byoMachine.Spec.InstallerRef = &corev1.ObjectReference{
+				Kind:       "K8sInstallerConfigTemplate",
+				Namespace:  defaultNamespace,
+				Name:       "secret-access-template",
+				APIVersion: infrav1.GroupVersion.String(),
+			}
+			Expect(k8sClientUncached.Create(ctx, byoMachine)).Should(Succeed())
+			installerConfig = builder.K8sInstallerConfig(defaultNamespace, "").WithName(byoMachine.Name).Build()
+			Expect(k8sClientUncached.Create(ctx, installerConfig)).Should(Succeed())
+			installerConfig.Status.InstallationSecret = &corev1.ObjectReference{Kind: "Secret", Name: "installation-secret", Namespace: defaultNamespace}
+			Expect(k8sClientUncached.Status().Update(ctx, installerConfig)).Should(Succeed())
+
+			byoHost.Spec.BootstrapSecret = &corev1.ObjectReference{Kind: "Secret", Name: "bootstrap-secret", Namespace: defaultNamespace}
+			byoHost.Spec.InstallationSecret = &corev1.ObjectReference{Kind: "Secret", Name: "installation-secret", Namespace: defaultNamespace}
+			Expect(k8sClientUncached.Update(ctx, byoHost)).Should(Succeed())
+			byoHost.Status.MachineRef = &corev1.ObjectReference{
+				Kind:       "ByoMachine",
+				APIVersion: infrav1.GroupVersion.String(),
+				Namespace:  byoMachine.Namespace,
+				Name:       byoMachine.Name,
+				UID:        byoMachine.UID,
+			}
+			Expect(k8sClientUncached.Status().Update(ctx, byoHost)).Should(Succeed())
+			reconcileByoHost()
+		})
+
+		AfterEach(func() {
+			Expect(k8sClientUncached.Delete(ctx, installerConfig)).Should(Succeed())
+			Expect(k8sClientUncached.Delete(ctx, byoMachine)).Should(Succeed())
+			Expect(k8sClientUncached.Delete(ctx, machine)).Should(Succeed())
+		})
+
+		It("should let the host read exactly these secrets", func() {
+			role := &rbacv1.Role{}
+			Expect(k8sClientUncached.Get(ctx, secretReaderKey, role)).Should(Succeed())
+			Expect(role.Labels).To(HaveKey(infrav1.HostSecretReaderLabel))
+			Expect(role.Annotations).To(HaveKeyWithValue(infrav1.ByoHostAnnotation, "default/secret-access-host"))
+			Expect(role.Rules).To(Equal([]rbacv1.PolicyRule{{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{"bootstrap-secret", "installation-secret"},
+				Verbs:         []string{"get"},
+			}}))
+
+			roleBinding := &rbacv1.RoleBinding{}
+			Expect(k8sClientUncached.Get(ctx, secretReaderKey, roleBinding)).Should(Succeed())
+			Expect(roleBinding.RoleRef.Name).To(Equal(role.Name))
+			Expect(roleBinding.Subjects).To(Equal([]rbacv1.Subject{{
+				APIGroup: rbacv1.GroupName,
+				Kind:     rbacv1.UserKind,
+				Name:     "byoh:host:secret-access-host",
+			}}))
+		})
+
+		It("should limit the access to the remaining secret once a reference is cleared", func() {
+			byoHost.Spec.InstallationSecret = nil
+			Expect(k8sClientUncached.Update(ctx, byoHost)).Should(Succeed())
+			reconcileByoHost()
+
+			role := &rbacv1.Role{}
+			Expect(k8sClientUncached.Get(ctx, secretReaderKey, role)).Should(Succeed())
+			Expect(role.Rules[0].ResourceNames).To(Equal([]string{"bootstrap-secret"}))
+		})
+
+		It("should revoke the access once the references are cleared", func() {
+			byoHost.Spec.BootstrapSecret = nil
+			byoHost.Spec.InstallationSecret = nil
+			Expect(k8sClientUncached.Update(ctx, byoHost)).Should(Succeed())
+			reconcileByoHost()
+
+			err := k8sClientUncached.Get(ctx, secretReaderKey, &rbacv1.Role{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			err = k8sClientUncached.Get(ctx, secretReaderKey, &rbacv1.RoleBinding{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should revoke the access once the ByoHost is deleted", func() {
+			Expect(k8sClientUncached.Delete(ctx, byoHost)).Should(Succeed())
+			reconcileByoHost()
+
+			err := k8sClientUncached.Get(ctx, secretReaderKey, &rbacv1.Role{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should not grant the secrets of another namespace", func() {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "secret-access-namespace"}}
+			Expect(client.IgnoreAlreadyExists(k8sClientUncached.Create(ctx, namespace))).Should(Succeed())
+			byoHost.Spec.BootstrapSecret.Namespace = namespace.Name
+			Expect(k8sClientUncached.Update(ctx, byoHost)).Should(Succeed())
+			reconcileByoHost()
+
+			role := &rbacv1.Role{}
+			Expect(k8sClientUncached.Get(ctx, secretReaderKey, role)).Should(Succeed())
+			Expect(role.Rules[0].ResourceNames).To(Equal([]string{"installation-secret"}))
+			err := k8sClientUncached.Get(ctx, types.NamespacedName{Name: secretReaderKey.Name, Namespace: namespace.Name}, &rbacv1.Role{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should not grant the secrets the controller manager did not set", func() {
+			byoHost.Spec.BootstrapSecret.Name = "another-bootstrap-secret"
+			byoHost.Spec.LoadBalancerSecret = &corev1.ObjectReference{Kind: "Secret", Name: "another-cluster-haproxy", Namespace: defaultNamespace}
+			Expect(k8sClientUncached.Update(ctx, byoHost)).Should(Succeed())
+			reconcileByoHost()
+
+			role := &rbacv1.Role{}
+			Expect(k8sClientUncached.Get(ctx, secretReaderKey, role)).Should(Succeed())
+			Expect(role.Rules[0].ResourceNames).To(Equal([]string{"installation-secret"}))
+		})
+
+		It("should only grant the encrypted bootstrap data to a host publishing an encryption key", func() {
+			byoHost.Status.EncryptionPublicKey = "public-key"
+			Expect(k8sClientUncached.Status().Update(ctx, byoHost)).Should(Succeed())
+			reconcileByoHost()
+
+			role := &rbacv1.Role{}
+			Expect(k8sClientUncached.Get(ctx, secretReaderKey, role)).Should(Succeed())
+			Expect(role.Rules[0].ResourceNames).To(Equal([]string{"installation-secret"}))
+
+			byoHost.Spec.BootstrapSecret.Name = byoMachine.Name + "-encrypted-bootstrap-data"
+			Expect(k8sClientUncached.Update(ctx, byoHost)).Should(Succeed())
+			reconcileByoHost()
+
+			Expect(k8sClientUncached.Get(ctx, secretReaderKey, role)).Should(Succeed())
+			Expect(role.Rules[0].ResourceNames).To(ConsistOf(byoMachine.Name+"-encrypted-bootstrap-data", "installation-secret"))
+		})
+
+		It("should revoke the access once the host is detached", func() {
+			byoHost.Status.MachineRef = nil
+			Expect(k8sClientUncached.Status().Update(ctx, byoHost)).Should(Succeed())
+			reconcileByoHost()
+
+			err := k8sClientUncached.Get(ctx, secretReaderKey, &rbacv1.Role{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+})
@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"regexp"
 	"strings"
@@ -17,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/cluster-api/controllers/external"
 	"sigs.k8s.io/cluster-api/controllers/remote"
@@ -27,18 +29,23 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/go-logr/logr"
 	infrav1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/encryption"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util/annotations"
 )
 
@@ -59,6 +66,8 @@ type ByoMachineReconciler struct {
 	Scheme   *runtime.Scheme
 	Tracker  *remote.ClusterCacheTracker
 	Recorder record.EventRecorder
+
+	controller controller.Controller
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byomachines,verbs=get;list;watch;create;update;patch;delete
@@ -70,7 +79,9 @@ type ByoMachineReconciler struct {
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;machines,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
-// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=ipam.cluster.x-k8s.io,resources=ipaddressclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=ipam.cluster.x-k8s.io,resources=ipaddresses,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -226,6 +237,11 @@ func (r *ByoMachineReconciler) reconcileDelete(ctx context.Context, machineScope
 		r.Recorder.Eventf(machineScope.ByoHost, corev1.EventTypeNormal, "ByoHostReleaseSucceeded", "ByoHost Released by %s", machineScope.ByoMachine.Name)
 		r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeNormal, "ByoHostReleaseSucceeded", "Released ByoHost %s", machineScope.ByoHost.Name)
 	}
+	for i := range machineScope.ByoMachine.Spec.SecondaryIPAddresses {
+		if err := releaseIPAddress(ctx, r.Client, machineScope.ByoMachine.Namespace, secondaryIPAddressClaimName(machineScope.ByoMachine, i)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
 	controllerutil.RemoveFinalizer(machineScope.ByoMachine, infrav1.MachineFinalizer)
 	return reconcile.Result{}, nil
@@ -267,8 +283,22 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 	// If there is not yet an byoHost for this byoMachine,
 	// then pick one from the host capacity pool
 	if machineScope.ByoHost == nil {
+		addresses, err := r.claimSecondaryIPAddresses(ctx, machineScope)
+		if err != nil {
+			logger.Error(err, "failed to claim the secondary IP addresses")
+			return ctrl.Result{}, err
+		}
+		if len(addresses) < len(machineScope.ByoMachine.Spec.SecondaryIPAddresses) {
+			logger.Info("Waiting for the secondary IP addresses")
+			conditions.MarkFalse(machineScope.ByoMachine, infrav1.IPAddressesClaimed, infrav1.WaitingForIPAddressReason, clusterv1.ConditionSeverityInfo, "")
+			return ctrl.Result{RequeueAfter: RequeueForbyohost}, nil
+		}
+		if len(addresses) > 0 {
+			conditions.MarkTrue(machineScope.ByoMachine, infrav1.IPAddressesClaimed)
+		}
+
 		logger.Info("Attempting host reservation")
-		if res, err := r.attachByoHost(ctx, machineScope); err != nil {
+		if res, err := r.attachByoHost(ctx, machineScope, addresses); err != nil {
 			return res, err
 		}
 		conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.InstallationSecretNotAvailableReason, clusterv1.ConditionSeverityInfo, "")
@@ -280,6 +310,19 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 		machineScope.ByoMachine.Status.HostInfo = machineScope.ByoHost.Status.HostDetails
 	}
 
+	addresses, err := machineAddresses(machineScope.ByoMachine, machineScope.ByoHost)
+	if err != nil {
+		logger.Error(err, "failed to get the addresses of the byohost")
+		return ctrl.Result{}, err
+	}
+	machineScope.ByoMachine.Status.Addresses = addresses
+
+	// the ByoHost watch reconciles the ByoMachine again once the agent recovers from a transient failure
+	if r.mirrorByoHostFailure(machineScope) {
+		logger.Info("ByoHost failed", "byohost", machineScope.ByoHost.Name)
+		return ctrl.Result{}, nil
+	}
+
 	if machineScope.ByoMachine.Spec.InstallerRef != nil && machineScope.ByoHost.Spec.InstallationSecret == nil {
 		res, err := r.setInstallationSecretForByoHost(ctx, machineScope)
 		if err != nil {
@@ -297,6 +340,11 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 
 func (r *ByoMachineReconciler) updateNodeProviderID(ctx context.Context, machineScope *byoMachineScope) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("cluster", machineScope.Cluster.Name)
+	if err := r.watchClusterNodes(ctx, machineScope.Cluster); err != nil {
+		logger.Error(err, "failed to watch the nodes of the workload cluster")
+		return ctrl.Result{}, err
+	}
+
 	remoteClient, err := r.getRemoteClient(ctx, machineScope.ByoMachine)
 	if err != nil {
 		logger.Error(err, "failed to get remote client")
@@ -304,9 +352,15 @@ func (r *ByoMachineReconciler) updateNodeProviderID(ctx context.Context, machine
 	}
 
 	providerID, err := r.setNodeProviderID(ctx, remoteClient, machineScope.ByoHost)
+	if apierrors.IsNotFound(err) {
+		// the node watch reconciles the ByoMachine again once the host registers its Node
+		logger.Info("Waiting for the Node of the byohost", "node", machineScope.ByoHost.Name)
+		conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.WaitingForNodeReason, clusterv1.ConditionSeverityInfo, "")
+		return ctrl.Result{}, nil
+	}
 	if err != nil {
 		logger.Error(err, "failed to set node providerID")
-		r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeWarning, "SetNodeProviderFailed", "Node %s does not exist", machineScope.ByoHost.Name)
+		r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeWarning, "SetNodeProviderFailed", "setting the providerID of Node %s failed: %v", machineScope.ByoHost.Name, err)
 		return ctrl.Result{}, err
 	}
 
@@ -327,11 +381,12 @@ func (r *ByoMachineReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Ma
 	logger := ctrl.LoggerFrom(ctx)
 	ClusterToByoMachines := r.ClusterToByoMachines(logger)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(controlledType).
 		Watches(
 			&source.Kind{Type: &infrav1.ByoHost{}},
-			handler.EnqueueRequestsFromMapFunc(ByoHostToByoMachineMapFunc(controlledTypeGVK)),
+			handler.EnqueueRequestsFromMapFunc(ByoHostToByoMachineMapFunc(r.Client, controlledTypeGVK)),
+			builder.WithPredicates(ByoHostAttachedOrAvailabilityChanged()),
 		).
 		// Watch the CAPI resource that owns this infrastructure resource
 		Watches(
@@ -343,7 +398,63 @@ func (r *ByoMachineReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Ma
 			handler.EnqueueRequestsFromMapFunc(ClusterToByoMachines),
 			builder.WithPredicates(predicates.ClusterUnpausedAndInfrastructureReady(ctrl.LoggerFrom(ctx))),
 		).
-		Complete(r)
+		Build(r)
+	if err != nil {
+		return err
+	}
+	r.controller = c
+	return nil
+}
+
+// watchClusterNodes watches the Nodes of the workload cluster through the ClusterCacheTracker, so that
+// a ByoMachine is reconciled as soon as the Node of its host registers instead of being requeued
+func (r *ByoMachineReconciler) watchClusterNodes(ctx context.Context, cluster *clusterv1.Cluster) error {
+	return r.Tracker.Watch(ctx, remote.WatchInput{
+		Name:         "byomachine-watchNodes",
+		Cluster:      util.ObjectKey(cluster),
+		Watcher:      r.controller,
+		Kind:         &corev1.Node{},
+		EventHandler: handler.EnqueueRequestsFromMapFunc(r.NodeToByoMachines(cluster)),
+		Predicates:   []predicate.Predicate{nodeWithoutProviderID()},
+	})
+}
+
+// nodeWithoutProviderID filters the Node events down to the creations and updates of Nodes
+// without a providerID, the only ones a ByoMachine waits for
+func nodeWithoutProviderID() predicate.Funcs {
+	withoutProviderID := func(o client.Object) bool {
+		node, ok := o.(*corev1.Node)
+		return ok && node.Spec.ProviderID == ""
+	}
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return withoutProviderID(e.Object) },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return withoutProviderID(e.ObjectNew) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+	}
+}
+
+// NodeToByoMachines is a handler.ToRequestsFunc to be used to enqueue requests for reconciliation
+// of the ByoMachines of cluster attached to the ByoHost named after the Node of that cluster
+func (r *ByoMachineReconciler) NodeToByoMachines(cluster *clusterv1.Cluster) handler.MapFunc {
+	return func(o client.Object) []ctrl.Request {
+		hostsList := &infrav1.ByoHostList{}
+		if err := r.Client.List(context.TODO(), hostsList, client.InNamespace(cluster.Namespace), client.MatchingLabels{clusterv1.ClusterNameLabel: cluster.Name}); err != nil {
+			return nil
+		}
+
+		var result []ctrl.Request
+		for _, host := range hostsList.Items {
+			if host.Name != o.GetName() || host.Status.MachineRef == nil || host.Status.MachineRef.Namespace != cluster.Namespace {
+				continue
+			}
+			result = append(result, ctrl.Request{NamespacedName: client.ObjectKey{
+				Namespace: host.Status.MachineRef.Namespace,
+				Name:      host.Status.MachineRef.Name,
+			}})
+		}
+		return result
+	}
 }
 
 // ClusterToByoMachines is a handler.ToRequestsFunc to be used to enqeue requests for reconciliation
@@ -476,7 +587,7 @@ func (r *ByoMachineReconciler) setInstallationSecretForByoHost(ctx context.Conte
 }
 
 func (r *ByoMachineReconciler) getInstallerConfigAndStatus(ctx context.Context, machineScope *byoMachineScope) (*unstructured.Unstructured, bool, error) {
-	installerConfig, err := r.getInstallerConfig(ctx, machineScope.ByoMachine)
+	installerConfig, err := getInstallerConfig(ctx, r.Client, machineScope.ByoMachine)
 	if err != nil {
 		return nil, false, err
 	}
@@ -487,7 +598,7 @@ func (r *ByoMachineReconciler) getInstallerConfigAndStatus(ctx context.Context,
 	return installerConfig, ready, nil
 }
 
-func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *byoMachineScope) (ctrl.Result, error) {
+func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *byoMachineScope, addresses []infrav1.HostIPAddress) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("cluster", machineScope.Cluster.Name)
 	var selector labels.Selector
 	var err error
@@ -510,19 +621,27 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 	byohostLabels, _ := labels.NewRequirement(clusterv1.ClusterNameLabel, selection.DoesNotExist, nil)
 	selector = selector.Add(*byohostLabels)
 
-	err = r.Client.List(ctx, hostsList, &client.ListOptions{LabelSelector: selector})
+	// only the hosts of the namespace of the ByoMachine can be attached to it
+	err = r.Client.List(ctx, hostsList, &client.ListOptions{LabelSelector: selector, Namespace: machineScope.ByoMachine.Namespace})
 	if err != nil {
 		logger.Error(err, "failed to list byohosts")
 		return ctrl.Result{RequeueAfter: RequeueForbyohost}, err
 	}
-	if len(hostsList.Items) == 0 {
+	// hosts being moved to another namespace are not available
+	hosts := hostsList.Items[:0]
+	for i := range hostsList.Items {
+		if _, moving := hostsList.Items[i].Annotations[infrav1.MoveToNamespaceAnnotation]; !moving {
+			hosts = append(hosts, hostsList.Items[i])
+		}
+	}
+	if len(hosts) == 0 {
 		logger.Info("No hosts found, waiting..")
 		r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeWarning, "ByoHostSelectionFailed", "No available ByoHost")
 		conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.BYOHostsUnavailableReason, clusterv1.ConditionSeverityInfo, "")
 		return ctrl.Result{RequeueAfter: RequeueForbyohost}, errors.New("no hosts found")
 	}
 	// TODO- Needs smarter logic
-	host := hostsList.Items[0]
+	host := hosts[0]
 
 	byohostHelper, err := patch.NewHelper(&host, r.Client)
 	if err != nil {
@@ -550,10 +669,22 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 		Namespace: machineScope.ByoMachine.Namespace,
 		Name:      *machineScope.Machine.Spec.Bootstrap.DataSecretName,
 	}
+	if len(addresses) > 0 {
+		host.Spec.SecondaryIPAddresses = addresses
+	}
+	if host.Status.EncryptionPublicKey != "" || needsKubeVIPManifest(machineScope) {
+		if host.Spec.BootstrapSecret, err = r.writeBootstrapData(ctx, machineScope, host.Status.EncryptionPublicKey); err != nil {
+			logger.Error(err, "failed to write bootstrap data", "byohost", host.Name)
+			return ctrl.Result{}, err
+		}
+	}
 	if host.Annotations == nil {
 		host.Annotations = make(map[string]string)
 	}
 	host.Annotations[infrav1.EndPointIPAnnotation] = machineScope.Cluster.Spec.ControlPlaneEndpoint.Host
+	if address := machineScope.ByoCluster.GetKubeVIPAddress(); address != "" {
+		host.Annotations[infrav1.EndPointIPAnnotation] = address
+	}
 	host.Annotations[infrav1.K8sVersionAnnotation] = strings.Split(*machineScope.Machine.Spec.Version, "+")[0]
 	host.Annotations[infrav1.BundleLookupBaseRegistryAnnotation] = machineScope.ByoCluster.Spec.BundleLookupBaseRegistry
 
@@ -567,17 +698,213 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 	return ctrl.Result{}, nil
 }
 
+// secondaryIPAddressClaimName returns the name of the IPAddressClaim of the i-th secondary IP address of the ByoMachine
+func secondaryIPAddressClaimName(byoMachine *infrav1.ByoMachine, i int) string {
+	return fmt.Sprintf("%s-%d", byoMachine.Name, i)
+}
+
+// claimSecondaryIPAddresses claims the secondary IP addresses of the ByoMachine from their IPAM pools
+// and returns the addresses allocated so far
+func (r *ByoMachineReconciler) claimSecondaryIPAddresses(ctx context.Context, machineScope *byoMachineScope) ([]infrav1.HostIPAddress, error) {
+	addresses := []infrav1.HostIPAddress{}
+	for i, spec := range machineScope.ByoMachine.Spec.SecondaryIPAddresses {
+		address, err := claimIPAddress(ctx, r.Client, machineScope.ByoMachine, machineScope.Cluster.Name, secondaryIPAddressClaimName(machineScope.ByoMachine, i), spec.PoolRef)
+		if err != nil {
+			return nil, err
+		}
+		if address != nil {
+			addresses = append(addresses, infrav1.HostIPAddress{
+				Address:   fmt.Sprintf("%s/%d", address.Spec.Address, address.Spec.Prefix),
+				Interface: spec.Interface,
+			})
+		}
+	}
+	return addresses, nil
+}
+
+// terminalHostFailureReasons are the reasons of the ByoHost conditions that fail the ByoMachine, the agent
+// gave up and the host needs to be fixed, so that the machine gets remediated
+var terminalHostFailureReasons = map[string]bool{
+	infrav1.K8sNodeBootstrapRetriesExhaustedReason: true,
+}
+
+// transientHostFailureReasons are the reasons of the ByoHost conditions that the agent retries
+var transientHostFailureReasons = map[string]bool{
+	infrav1.K8sComponentsInstallationFailedReason: true,
+	infrav1.CloudInitExecutionFailedReason:        true,
+	infrav1.CleanK8sDirectoriesFailedReason:       true,
+}
+
+// mirrorByoHostFailure mirrors the failures of the attached ByoHost on the ByoMachine, a terminal failure sets
+// its FailureReason and FailureMessage while a transient one only its BYOHostReady condition, and returns
+// whether the ByoHost failed
+func (r *ByoMachineReconciler) mirrorByoHostFailure(machineScope *byoMachineScope) bool {
+	if machineScope.ByoMachine.Status.FailureReason != nil {
+		return true
+	}
+	// the agent gives up on K8sNodeBootstrapSucceeded, also when the installation of the k8s components failed
+	for _, conditionType := range []clusterv1.ConditionType{infrav1.K8sNodeBootstrapSucceeded, infrav1.K8sComponentsInstallationSucceeded} {
+		condition := conditions.Get(machineScope.ByoHost, conditionType)
+		if condition == nil || condition.Status != corev1.ConditionFalse {
+			continue
+		}
+		message := fmt.Sprintf("ByoHost %s: %s is False with reason %s", machineScope.ByoHost.Name, condition.Type, condition.Reason)
+		if condition.Message != "" {
+			message += ": " + condition.Message
+		}
+		switch {
+		case terminalHostFailureReasons[condition.Reason]:
+			failureReason := capierrors.CreateMachineError
+			machineScope.ByoMachine.Status.FailureReason = &failureReason
+			machineScope.ByoMachine.Status.FailureMessage = &message
+			conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.ByoHostFailedReason, clusterv1.ConditionSeverityError, "%s", message)
+			r.Recorder.Event(machineScope.ByoMachine, corev1.EventTypeWarning, "ByoHostFailed", message)
+			return true
+		case transientHostFailureReasons[condition.Reason]:
+			conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.ByoHostDegradedReason, clusterv1.ConditionSeverityWarning, "%s", message)
+			return true
+		}
+	}
+	return false
+}
+
+// machineAddresses returns the addresses of the host published by the ByoMachine, the internal IPs
+// selected by its address policy followed by the host name
+func machineAddresses(byoMachine *infrav1.ByoMachine, byoHost *infrav1.ByoHost) (clusterv1.MachineAddresses, error) {
+	policy := byoMachine.Spec.AddressPolicy
+	if policy == nil {
+		policy = &infrav1.MachineAddressPolicy{}
+	}
+	cidrs := make([]*net.IPNet, 0, len(policy.CIDRs))
+	for _, cidr := range policy.CIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s in the address policy: %v", cidr, err)
+		}
+		cidrs = append(cidrs, ipNet)
+	}
+
+	addresses := clusterv1.MachineAddresses{}
+	for _, network := range byoHost.Status.Network {
+		if policy.Interface != "" && network.NetworkInterfaceName != policy.Interface {
+			continue
+		}
+		// without a policy, only the addresses of the default network interface are internal IPs
+		if policy.Interface == "" && len(cidrs) == 0 && !network.IsDefault {
+			continue
+		}
+		for _, addr := range network.IPAddrs {
+			ip := parseHostIP(addr)
+			if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || !inCIDRs(cidrs, ip) {
+				continue
+			}
+			addresses = append(addresses, clusterv1.MachineAddress{Type: clusterv1.MachineInternalIP, Address: ip.String()})
+		}
+	}
+	return append(addresses, clusterv1.MachineAddress{Type: clusterv1.MachineHostName, Address: byoHost.Name}), nil
+}
+
+// parseHostIP parses an address of the network status of a host, reported with or without its prefix length
+func parseHostIP(addr string) net.IP {
+	if ip, _, err := net.ParseCIDR(addr); err == nil {
+		return ip
+	}
+	return net.ParseIP(addr)
+}
+
+// inCIDRs returns whether ip is within one of cidrs, any ip being when there are no cidrs
+func inCIDRs(cidrs []*net.IPNet, ip net.IP) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	for _, cidr := range cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsKubeVIPManifest returns whether the kube-vip manifest is added to the bootstrap data of the machine,
+// i.e. the machine is a control plane machine of a ByoCluster configuring kube-vip
+func needsKubeVIPManifest(machineScope *byoMachineScope) bool {
+	return machineScope.ByoCluster.Spec.KubeVIP != nil && util.IsControlPlaneMachine(machineScope.Machine)
+}
+
+// writeBootstrapData writes the bootstrap data of the machine, with the kube-vip manifest of the control plane
+// machines and encrypted to the public key of the host when it is set, in a secret owned by the ByoMachine
+// and returns a reference to this secret
+func (r *ByoMachineReconciler) writeBootstrapData(ctx context.Context, machineScope *byoMachineScope, publicKey string) (*corev1.ObjectReference, error) {
+	bootstrapSecret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: *machineScope.Machine.Spec.Bootstrap.DataSecretName, Namespace: machineScope.ByoMachine.Namespace}, bootstrapSecret)
+	if err != nil {
+		return nil, err
+	}
+	bootstrapData := bootstrapSecret.Data["value"]
+	if needsKubeVIPManifest(machineScope) {
+		manifest, err := kubeVIPManifest(machineScope.ByoCluster)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render the kube-vip manifest: %v", err)
+		}
+		if bootstrapData, err = addKubeVIPManifest(bootstrapData, manifest); err != nil {
+			return nil, fmt.Errorf("failed to add the kube-vip manifest to bootstrap secret %s: %v", bootstrapSecret.Name, err)
+		}
+	}
+
+	name, dataKey := bootstrapDataSecretName(machineScope.ByoMachine), "value"
+	if publicKey != "" {
+		if bootstrapData, err = encryption.Encrypt(publicKey, bootstrapData); err != nil {
+			return nil, fmt.Errorf("failed to encrypt bootstrap secret %s: %v", bootstrapSecret.Name, err)
+		}
+		name, dataKey = encryptedBootstrapDataSecretName(machineScope.ByoMachine), infrav1.EncryptedBootstrapDataKey
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: machineScope.ByoMachine.Namespace,
+		},
+	}
+	if _, err = controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		if secret.Labels == nil {
+			secret.Labels = make(map[string]string)
+		}
+		secret.Labels[clusterv1.ClusterNameLabel] = machineScope.Cluster.Name
+		secret.Type = clusterv1.ClusterSecretType
+		secret.Data = map[string][]byte{dataKey: bootstrapData}
+		return controllerutil.SetControllerReference(machineScope.ByoMachine, secret, r.Client.Scheme())
+	}); err != nil {
+		return nil, err
+	}
+	return &corev1.ObjectReference{
+		Kind:      "Secret",
+		Namespace: secret.Namespace,
+		Name:      secret.Name,
+	}, nil
+}
+
+// bootstrapDataSecretName returns the name of the secret holding the bootstrap data of the ByoMachine with the kube-vip manifest
+func bootstrapDataSecretName(byoMachine *infrav1.ByoMachine) string {
+	return fmt.Sprintf("%s-bootstrap-data", byoMachine.Name)
+}
+
+// encryptedBootstrapDataSecretName returns the name of the secret holding the encrypted bootstrap data of the ByoMachine
+func encryptedBootstrapDataSecretName(byoMachine *infrav1.ByoMachine) string {
+	return fmt.Sprintf("%s-encrypted-bootstrap-data", byoMachine.Name)
+}
+
 // ByoHostToByoMachineMapFunc returns a handler.ToRequestsFunc that watches for
-// Machine events and returns reconciliation requests for an infrastructure provider object
-func ByoHostToByoMachineMapFunc(gvk schema.GroupVersionKind) handler.MapFunc {
+// Machine events and returns reconciliation requests for an infrastructure provider object.
+// The events of an available ByoHost enqueue the ByoMachines of its namespace without providerID,
+// which may be waiting for a host.
+func ByoHostToByoMachineMapFunc(c client.Client, gvk schema.GroupVersionKind) handler.MapFunc {
 	return func(o client.Object) []reconcile.Request {
 		h, ok := o.(*infrav1.ByoHost)
 		if !ok {
 			return nil
 		}
 		if h.Status.MachineRef == nil {
-			// TODO, we can enqueue byomachine which providerID is nil to get better performance than requeue
-			return nil
+			return byoMachinesWithoutProviderID(c, h.Namespace)
 		}
 
 		gk := gvk.GroupKind()
@@ -598,6 +925,48 @@ func ByoHostToByoMachineMapFunc(gvk schema.GroupVersionKind) handler.MapFunc {
 	}
 }
 
+// ByoHostAttachedOrAvailabilityChanged filters the ByoHost events down to the ones that matter to the ByoMachines:
+// the changes of an attached ByoHost, whose status the ByoMachine mirrors, its detachment and the changes of the
+// labels and annotations of an idle ByoHost that may make it available. The status updates of idle ByoHosts would
+// otherwise enqueue every ByoMachine without providerID of the namespace.
+func ByoHostAttachedOrAvailabilityChanged() predicate.Funcs {
+	attached := func(o client.Object) bool {
+		h, ok := o.(*infrav1.ByoHost)
+		return ok && h.Status.MachineRef != nil
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return true },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if attached(e.ObjectOld) || attached(e.ObjectNew) {
+				return true
+			}
+			_, oldMoving := e.ObjectOld.GetAnnotations()[infrav1.MoveToNamespaceAnnotation]
+			_, newMoving := e.ObjectNew.GetAnnotations()[infrav1.MoveToNamespaceAnnotation]
+			return oldMoving != newMoving || !reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return attached(e.Object) },
+		GenericFunc: func(e event.GenericEvent) bool { return true },
+	}
+}
+
+// byoMachinesWithoutProviderID returns reconciliation requests for the ByoMachines of the namespace
+// that have no providerID yet and are not being deleted
+func byoMachinesWithoutProviderID(c client.Client, namespace string) []reconcile.Request {
+	machineList := &infrav1.ByoMachineList{}
+	if err := c.List(context.TODO(), machineList, client.InNamespace(namespace)); err != nil {
+		return nil
+	}
+
+	var result []reconcile.Request
+	for i := range machineList.Items {
+		if machineList.Items[i].Spec.ProviderID != "" || !machineList.Items[i].DeletionTimestamp.IsZero() {
+			continue
+		}
+		result = append(result, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&machineList.Items[i])})
+	}
+	return result
+}
+
 func (r *ByoMachineReconciler) markHostForCleanup(ctx context.Context, machineScope *byoMachineScope) error {
 	helper, _ := patch.NewHelper(machineScope.ByoHost, r.Client)
 
@@ -610,7 +979,8 @@ func (r *ByoMachineReconciler) markHostForCleanup(ctx context.Context, machineSc
 	return helper.Patch(ctx, machineScope.ByoHost)
 }
 
-func (r *ByoMachineReconciler) getInstallerConfig(ctx context.Context, byoMachine *infrav1.ByoMachine) (*unstructured.Unstructured, error) {
+// getInstallerConfig returns the installer config created from the InstallerRef template of the ByoMachine
+func getInstallerConfig(ctx context.Context, c client.Reader, byoMachine *infrav1.ByoMachine) (*unstructured.Unstructured, error) {
 	installerConfig := &unstructured.Unstructured{}
 	gvk := byoMachine.Spec.InstallerRef.GroupVersionKind()
 	gvk.Kind = strings.Replace(gvk.Kind, "Template", "", -1)
@@ -619,7 +989,7 @@ func (r *ByoMachineReconciler) getInstallerConfig(ctx context.Context, byoMachin
 		Namespace: byoMachine.Namespace,
 		Name:      byoMachine.Name,
 	}
-	if err := r.Client.Get(ctx, installerConfigName, installerConfig); err != nil {
+	if err := c.Get(ctx, installerConfigName, installerConfig); err != nil {
 		return nil, err
 	}
 	return installerConfig, nil
@@ -631,7 +1001,7 @@ func (r *ByoMachineReconciler) createInstallerConfig(ctx context.Context, machin
 		installerConfig *unstructured.Unstructured
 		err             error
 	)
-	_, err = r.getInstallerConfig(ctx, machineScope.ByoMachine)
+	_, err = getInstallerConfig(ctx, r.Client, machineScope.ByoMachine)
 	if err != nil && apierrors.IsNotFound(err) {
 		template := &unstructured.Unstructured{}
 		template.SetGroupVersionKind(machineScope.ByoMachine.Spec.InstallerRef.GroupVersionKind())
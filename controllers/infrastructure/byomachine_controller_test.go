@@ -5,25 +5,32 @@ package controllers_test
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/encryption"
 	controllers "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/controllers/infrastructure"
 	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/builder"
 	eventutils "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/test/utils/events"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1alpha1"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/annotations"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -117,14 +124,26 @@ var _ = Describe("Controllers/ByomachineController", func() {
 			})
 		})
 
-		It("should return error when node is not available", func() {
+		It("should wait for the node when it is not available", func() {
 			byoHost = builder.ByoHost(defaultNamespace, "host-with-node-missing").Build()
 			Expect(k8sClientUncached.Create(ctx, byoHost)).Should(Succeed())
 
 			WaitForObjectsToBePopulatedInCache(byoHost)
 
-			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
-			Expect(err).To(MatchError("nodes \"" + byoHost.Name + "\" not found"))
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{}))
+
+			createdByoMachine := &infrastructurev1beta1.ByoMachine{}
+			Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, createdByoMachine)).Should(Succeed())
+			Expect(createdByoMachine.Spec.ProviderID).To(BeEmpty())
+			Expect(*conditions.Get(createdByoMachine, infrastructurev1beta1.BYOHostReady)).To(conditions.MatchCondition(clusterv1.Condition{
+				Type:     infrastructurev1beta1.BYOHostReady,
+				Status:   corev1.ConditionFalse,
+				Reason:   infrastructurev1beta1.WaitingForNodeReason,
+				Severity: clusterv1.ConditionSeverityInfo,
+			}))
+			Expect(eventutils.CollectEvents(recorder.Events)).NotTo(ContainElement(HavePrefix("Warning SetNodeProviderFailed")))
 		})
 
 		Context("When node.Spec.ProviderID is already set", func() {
@@ -182,6 +201,31 @@ var _ = Describe("Controllers/ByomachineController", func() {
 				}))
 			})
 
+			It("should not select a host being moved to another namespace", func() {
+				movingHost := builder.ByoHost(defaultNamespace, "moving-host").Build()
+				movingHost.Annotations = map[string]string{infrastructurev1beta1.MoveToNamespaceAnnotation: "tenant-a"}
+				Expect(k8sClientUncached.Create(ctx, movingHost)).Should(Succeed())
+				defer func() { Expect(k8sClientUncached.Delete(ctx, movingHost)).Should(Succeed()) }()
+				WaitForObjectToBeUpdatedInCache(movingHost, func(object client.Object) bool {
+					return object.GetAnnotations()[infrastructurev1beta1.MoveToNamespaceAnnotation] == "tenant-a"
+				})
+
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+				Expect(err).To(MatchError("no hosts found"))
+			})
+
+			It("should not select a host of another namespace", func() {
+				otherNamespace := builder.Namespace("tenant-b").Build()
+				Expect(client.IgnoreAlreadyExists(k8sClientUncached.Create(ctx, otherNamespace))).Should(Succeed())
+				otherHost := builder.ByoHost(otherNamespace.Name, "other-host").Build()
+				Expect(k8sClientUncached.Create(ctx, otherHost)).Should(Succeed())
+				defer func() { Expect(k8sClientUncached.Delete(ctx, otherHost)).Should(Succeed()) }()
+				WaitForObjectsToBePopulatedInCache(otherHost)
+
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+				Expect(err).To(MatchError("no hosts found"))
+			})
+
 			It("should add MachineFinalizer on ByoMachine", func() {
 				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
 				Expect(err).To(HaveOccurred())
@@ -278,6 +322,225 @@ var _ = Describe("Controllers/ByomachineController", func() {
 				Expect(node.Spec.ProviderID).To(ContainSubstring(controllers.ProviderIDPrefix))
 			})
 
+			It("should enqueue the byomachines without providerID when the byohost is available", func() {
+				mapFunc := controllers.ByoHostToByoMachineMapFunc(k8sClientUncached, infrastructurev1beta1.GroupVersion.WithKind("ByoMachine"))
+				Expect(mapFunc(byoHost)).To(ContainElement(reconcile.Request{NamespacedName: byoMachineLookupKey}))
+			})
+
+			It("should only enqueue the byomachines for the byohost updates that may make it available", func() {
+				hostPredicate := controllers.ByoHostAttachedOrAvailabilityChanged()
+				updated := byoHost.DeepCopy()
+				conditions.MarkFalse(updated, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.WaitingForMachineRefReason, clusterv1.ConditionSeverityInfo, "")
+				Expect(hostPredicate.Update(event.UpdateEvent{ObjectOld: byoHost, ObjectNew: updated})).To(BeFalse())
+
+				relabeled := byoHost.DeepCopy()
+				relabeled.Labels = map[string]string{"site": "edge"}
+				Expect(hostPredicate.Update(event.UpdateEvent{ObjectOld: byoHost, ObjectNew: relabeled})).To(BeTrue())
+
+				moving := byoHost.DeepCopy()
+				moving.Annotations = map[string]string{infrastructurev1beta1.MoveToNamespaceAnnotation: "tenant-b"}
+				Expect(hostPredicate.Update(event.UpdateEvent{ObjectOld: moving, ObjectNew: byoHost})).To(BeTrue())
+
+				attached := byoHost.DeepCopy()
+				attached.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: byoMachine.Namespace, Name: byoMachine.Name}
+				attachedUpdated := attached.DeepCopy()
+				conditions.MarkTrue(attachedUpdated, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+				Expect(hostPredicate.Update(event.UpdateEvent{ObjectOld: byoHost, ObjectNew: attached})).To(BeTrue())
+				Expect(hostPredicate.Update(event.UpdateEvent{ObjectOld: attached, ObjectNew: attachedUpdated})).To(BeTrue())
+				Expect(hostPredicate.Update(event.UpdateEvent{ObjectOld: attached, ObjectNew: byoHost})).To(BeTrue())
+
+				Expect(hostPredicate.Delete(event.DeleteEvent{Object: byoHost})).To(BeFalse())
+				Expect(hostPredicate.Delete(event.DeleteEvent{Object: attached})).To(BeTrue())
+			})
+
+			Context("When the ByoHost publishes an encryption public key", func() {
+				var (
+					encryptionKey       *rsa.PrivateKey
+					bootstrapDataSecret *corev1.Secret
+				)
+
+				BeforeEach(func() {
+					bootstrapDataSecret = builder.Secret(defaultNamespace, "encrypted-bootstrap-source").
+						WithData("kubeadm join").
+						Build()
+					Expect(k8sClientUncached.Create(ctx, bootstrapDataSecret)).Should(Succeed())
+
+					ph, err := patch.NewHelper(machine, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					machine.Spec.Bootstrap.DataSecretName = &bootstrapDataSecret.Name
+					Expect(ph.Patch(ctx, machine)).Should(Succeed())
+
+					encryptionKey, err = encryption.GenerateKey()
+					Expect(err).ShouldNot(HaveOccurred())
+					ph, err = patch.NewHelper(byoHost, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					byoHost.Status.EncryptionPublicKey, err = encryption.EncodePublicKey(encryptionKey)
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+
+					WaitForObjectToBeUpdatedInCache(machine, func(object client.Object) bool {
+						return *object.(*clusterv1.Machine).Spec.Bootstrap.DataSecretName == bootstrapDataSecret.Name
+					})
+					WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+						return object.(*infrastructurev1beta1.ByoHost).Status.EncryptionPublicKey != ""
+					})
+				})
+
+				AfterEach(func() {
+					Expect(k8sClientUncached.Delete(ctx, bootstrapDataSecret)).Should(Succeed())
+				})
+
+				It("should attach the host with the bootstrap data encrypted to its key", func() {
+					_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					createdByoHost := &infrastructurev1beta1.ByoHost{}
+					Expect(k8sClientUncached.Get(ctx, byoHostLookupKey, createdByoHost)).Should(Succeed())
+					Expect(createdByoHost.Spec.BootstrapSecret.Name).To(Equal(byoMachine.Name + "-encrypted-bootstrap-data"))
+
+					encryptedSecret := &corev1.Secret{}
+					Expect(k8sClientUncached.Get(ctx, types.NamespacedName{
+						Name:      createdByoHost.Spec.BootstrapSecret.Name,
+						Namespace: createdByoHost.Spec.BootstrapSecret.Namespace,
+					}, encryptedSecret)).Should(Succeed())
+					Expect(encryptedSecret.Data).NotTo(HaveKey("value"))
+					Expect(metav1.IsControlledBy(encryptedSecret, byoMachine)).To(BeTrue())
+
+					decrypted, err := encryption.Decrypt(encryptionKey, encryptedSecret.Data[infrastructurev1beta1.EncryptedBootstrapDataKey])
+					Expect(err).ToNot(HaveOccurred())
+					Expect(string(decrypted)).To(Equal("kubeadm join"))
+				})
+			})
+
+			Context("When the ByoCluster configures kube-vip", func() {
+				var bootstrapDataSecret *corev1.Secret
+
+				BeforeEach(func() {
+					bootstrapDataSecret = builder.Secret(defaultNamespace, "kube-vip-bootstrap-source").
+						WithData("## template: jinja\n#cloud-config\nrunCmd:\n- kubeadm init\n").
+						Build()
+					Expect(k8sClientUncached.Create(ctx, bootstrapDataSecret)).Should(Succeed())
+
+					ph, err := patch.NewHelper(machine, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					machine.Spec.Bootstrap.DataSecretName = &bootstrapDataSecret.Name
+					machine.Labels = map[string]string{clusterv1.MachineControlPlaneLabel: ""}
+					Expect(ph.Patch(ctx, machine)).Should(Succeed())
+
+					ph, err = patch.NewHelper(byoCluster, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					byoCluster.Spec.KubeVIP = &infrastructurev1beta1.KubeVIPSpec{Address: "10.10.10.10"}
+					Expect(ph.Patch(ctx, byoCluster)).Should(Succeed())
+
+					WaitForObjectToBeUpdatedInCache(machine, func(object client.Object) bool {
+						return *object.(*clusterv1.Machine).Spec.Bootstrap.DataSecretName == bootstrapDataSecret.Name
+					})
+					WaitForObjectToBeUpdatedInCache(byoCluster, func(object client.Object) bool {
+						return object.(*infrastructurev1beta1.ByoCluster).Spec.KubeVIP != nil
+					})
+				})
+
+				AfterEach(func() {
+					ph, err := patch.NewHelper(byoCluster, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					byoCluster.Spec.KubeVIP = nil
+					Expect(ph.Patch(ctx, byoCluster)).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(byoCluster, func(object client.Object) bool {
+						return object.(*infrastructurev1beta1.ByoCluster).Spec.KubeVIP == nil
+					})
+					Expect(k8sClientUncached.Delete(ctx, bootstrapDataSecret)).Should(Succeed())
+				})
+
+				It("should add the kube-vip manifest to the bootstrap data of the control plane host", func() {
+					_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					createdByoHost := &infrastructurev1beta1.ByoHost{}
+					Expect(k8sClientUncached.Get(ctx, byoHostLookupKey, createdByoHost)).Should(Succeed())
+					Expect(createdByoHost.Spec.BootstrapSecret.Name).To(Equal(byoMachine.Name + "-bootstrap-data"))
+					Expect(createdByoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.EndPointIPAnnotation, "10.10.10.10"))
+
+					bootstrapData := &corev1.Secret{}
+					Expect(k8sClientUncached.Get(ctx, types.NamespacedName{
+						Name:      createdByoHost.Spec.BootstrapSecret.Name,
+						Namespace: createdByoHost.Spec.BootstrapSecret.Namespace,
+					}, bootstrapData)).Should(Succeed())
+					Expect(metav1.IsControlledBy(bootstrapData, byoMachine)).To(BeTrue())
+					value := string(bootstrapData.Data["value"])
+					Expect(value).To(HavePrefix("## template: jinja\n#cloud-config\n"))
+					Expect(value).To(ContainSubstring("kubeadm init"))
+					Expect(value).To(ContainSubstring(controllers.KubeVIPManifestPath))
+					Expect(value).To(ContainSubstring("10.10.10.10"))
+					Expect(value).To(ContainSubstring("{{ .DefaultNetworkInterfaceName }}"))
+				})
+			})
+
+			Context("When the ByoMachine claims secondary IP addresses", func() {
+				BeforeEach(func() {
+					ph, err := patch.NewHelper(byoMachine, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					byoMachine.Spec.SecondaryIPAddresses = []infrastructurev1beta1.SecondaryIPAddressSpec{{
+						PoolRef: corev1.TypedLocalObjectReference{
+							APIGroup: pointer.String("ipam.cluster.x-k8s.io"),
+							Kind:     "InClusterIPPool",
+							Name:     "storage-pool",
+						},
+						Interface: "eth1",
+					}}
+					Expect(ph.Patch(ctx, byoMachine)).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(byoMachine, func(object client.Object) bool {
+						return len(object.(*infrastructurev1beta1.ByoMachine).Spec.SecondaryIPAddresses) > 0
+					})
+				})
+
+				It("should attach the host once the IP addresses are allocated", func() {
+					_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					createdByoHost := &infrastructurev1beta1.ByoHost{}
+					Expect(k8sClientUncached.Get(ctx, byoHostLookupKey, createdByoHost)).Should(Succeed())
+					Expect(createdByoHost.Status.MachineRef).To(BeNil())
+					createdByoMachine := &infrastructurev1beta1.ByoMachine{}
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, createdByoMachine)).Should(Succeed())
+					Expect(*conditions.Get(createdByoMachine, infrastructurev1beta1.IPAddressesClaimed)).To(conditions.MatchCondition(clusterv1.Condition{
+						Type:     infrastructurev1beta1.IPAddressesClaimed,
+						Status:   corev1.ConditionFalse,
+						Reason:   infrastructurev1beta1.WaitingForIPAddressReason,
+						Severity: clusterv1.ConditionSeverityInfo,
+					}))
+
+					claim := &ipamv1.IPAddressClaim{}
+					Expect(k8sClientUncached.Get(ctx, types.NamespacedName{Name: byoMachine.Name + "-0", Namespace: defaultNamespace}, claim)).Should(Succeed())
+					Expect(metav1.IsControlledBy(claim, byoMachine)).To(BeTrue())
+					address := &ipamv1.IPAddress{
+						ObjectMeta: metav1.ObjectMeta{Name: claim.Name, Namespace: claim.Namespace},
+						Spec: ipamv1.IPAddressSpec{
+							ClaimRef: corev1.LocalObjectReference{Name: claim.Name},
+							PoolRef:  claim.Spec.PoolRef,
+							Address:  "10.10.20.5",
+							Prefix:   24,
+						},
+					}
+					Expect(k8sClientUncached.Create(ctx, address)).Should(Succeed())
+					defer func() { Expect(k8sClientUncached.Delete(ctx, address)).Should(Succeed()) }()
+					claim.Status.AddressRef = corev1.LocalObjectReference{Name: address.Name}
+					Expect(k8sClientUncached.Status().Update(ctx, claim)).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(claim, func(object client.Object) bool {
+						return object.(*ipamv1.IPAddressClaim).Status.AddressRef.Name != ""
+					})
+					WaitForObjectsToBePopulatedInCache(address)
+
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(k8sClientUncached.Get(ctx, byoHostLookupKey, createdByoHost)).Should(Succeed())
+					Expect(createdByoHost.Status.MachineRef).NotTo(BeNil())
+					Expect(createdByoHost.Spec.SecondaryIPAddresses).To(Equal([]infrastructurev1beta1.HostIPAddress{{Address: "10.10.20.5/24", Interface: "eth1"}}))
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, createdByoMachine)).Should(Succeed())
+					Expect(conditions.IsTrue(createdByoMachine, infrastructurev1beta1.IPAddressesClaimed)).To(BeTrue())
+				})
+			})
+
 			Context("When ByoMachine is attached to a host", func() {
 				BeforeEach(func() {
 					ph, err := patch.NewHelper(byoHost, k8sClientUncached)
@@ -377,6 +640,178 @@ var _ = Describe("Controllers/ByomachineController", func() {
 
 				})
 
+				Context("When the node of the byohost registers", func() {
+					BeforeEach(func() {
+						ph, err := patch.NewHelper(byoHost, k8sClientUncached)
+						Expect(err).ShouldNot(HaveOccurred())
+						byoHost.Labels[clusterv1.ClusterNameLabel] = capiCluster.Name
+						Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+						WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+							return object.(*infrastructurev1beta1.ByoHost).Labels[clusterv1.ClusterNameLabel] == capiCluster.Name
+						})
+					})
+
+					It("should enqueue the byomachine when the node registers in its cluster", func() {
+						Expect(reconciler.NodeToByoMachines(capiCluster)(node)).To(ConsistOf(reconcile.Request{NamespacedName: byoMachineLookupKey}))
+					})
+
+					It("should not enqueue the byomachine when a node of the same name registers in another cluster", func() {
+						otherCluster := builder.Cluster(defaultNamespace, "other-cluster").Build()
+						Expect(reconciler.NodeToByoMachines(otherCluster)(node)).To(BeEmpty())
+
+						otherNamespaceCluster := builder.Cluster("tenant-b", capiCluster.Name).Build()
+						Expect(reconciler.NodeToByoMachines(otherNamespaceCluster)(node)).To(BeEmpty())
+					})
+				})
+
+				It("should fail the byomachine when the agent gives up bootstrapping the node", func() {
+					ph, err := patch.NewHelper(byoHost, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.K8sNodeBootstrapRetriesExhaustedReason, clusterv1.ConditionSeverityError,
+						"CloudInitExecutionFailed 5 times in a row")
+					Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+						return conditions.Has(object.(*infrastructurev1beta1.ByoHost), infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+					})
+
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					message := fmt.Sprintf("ByoHost %s: K8sNodeBootstrapSucceeded is False with reason K8sNodeBootstrapRetriesExhausted: CloudInitExecutionFailed 5 times in a row", byoHost.Name)
+					patchedByoMachine := &infrastructurev1beta1.ByoMachine{}
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, patchedByoMachine)).Should(Succeed())
+					Expect(patchedByoMachine.Spec.ProviderID).To(BeEmpty())
+					Expect(*patchedByoMachine.Status.FailureReason).To(Equal(capierrors.CreateMachineError))
+					Expect(*patchedByoMachine.Status.FailureMessage).To(Equal(message))
+					Expect(*conditions.Get(patchedByoMachine, infrastructurev1beta1.BYOHostReady)).To(conditions.MatchCondition(clusterv1.Condition{
+						Type:     infrastructurev1beta1.BYOHostReady,
+						Status:   corev1.ConditionFalse,
+						Reason:   infrastructurev1beta1.ByoHostFailedReason,
+						Severity: clusterv1.ConditionSeverityError,
+						Message:  message,
+					}))
+					Expect(eventutils.CollectEvents(recorder.Events)).To(ContainElement("Warning ByoHostFailed " + message))
+				})
+
+				It("should fail the byomachine when the agent gives up installing the k8s components", func() {
+					ph, err := patch.NewHelper(byoHost, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded, infrastructurev1beta1.K8sComponentsInstallationFailedReason, clusterv1.ConditionSeverityInfo, "")
+					conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.K8sNodeBootstrapRetriesExhaustedReason, clusterv1.ConditionSeverityError,
+						"K8sComponentsInstallationFailed 5 times in a row")
+					Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+						return conditions.Has(object.(*infrastructurev1beta1.ByoHost), infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+					})
+
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					patchedByoMachine := &infrastructurev1beta1.ByoMachine{}
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, patchedByoMachine)).Should(Succeed())
+					Expect(*patchedByoMachine.Status.FailureReason).To(Equal(capierrors.CreateMachineError))
+					Expect(*patchedByoMachine.Status.FailureMessage).To(Equal(fmt.Sprintf(
+						"ByoHost %s: K8sNodeBootstrapSucceeded is False with reason K8sNodeBootstrapRetriesExhausted: K8sComponentsInstallationFailed 5 times in a row", byoHost.Name)))
+				})
+
+				It("should not fail the byomachine when the byohost fails to install the k8s components", func() {
+					ph, err := patch.NewHelper(byoHost, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded, infrastructurev1beta1.K8sComponentsInstallationFailedReason, clusterv1.ConditionSeverityInfo, "")
+					Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+						return conditions.Has(object.(*infrastructurev1beta1.ByoHost), infrastructurev1beta1.K8sComponentsInstallationSucceeded)
+					})
+
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					patchedByoMachine := &infrastructurev1beta1.ByoMachine{}
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, patchedByoMachine)).Should(Succeed())
+					Expect(patchedByoMachine.Status.FailureReason).To(BeNil())
+					Expect(patchedByoMachine.Status.FailureMessage).To(BeNil())
+					Expect(*conditions.Get(patchedByoMachine, infrastructurev1beta1.BYOHostReady)).To(conditions.MatchCondition(clusterv1.Condition{
+						Type:     infrastructurev1beta1.BYOHostReady,
+						Status:   corev1.ConditionFalse,
+						Reason:   infrastructurev1beta1.ByoHostDegradedReason,
+						Severity: clusterv1.ConditionSeverityWarning,
+						Message:  fmt.Sprintf("ByoHost %s: K8sComponentsInstallationSucceeded is False with reason K8sComponentsInstallationFailed", byoHost.Name),
+					}))
+				})
+
+				It("should recover the byomachine when the byohost bootstraps the node after a failure", func() {
+					ph, err := patch.NewHelper(byoHost, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.CloudInitExecutionFailedReason, clusterv1.ConditionSeverityError, "")
+					Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+						return conditions.GetReason(object.(*infrastructurev1beta1.ByoHost), infrastructurev1beta1.K8sNodeBootstrapSucceeded) == infrastructurev1beta1.CloudInitExecutionFailedReason
+					})
+
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					patchedByoMachine := &infrastructurev1beta1.ByoMachine{}
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, patchedByoMachine)).Should(Succeed())
+					Expect(patchedByoMachine.Status.FailureReason).To(BeNil())
+					Expect(conditions.GetReason(patchedByoMachine, infrastructurev1beta1.BYOHostReady)).To(Equal(infrastructurev1beta1.ByoHostDegradedReason))
+
+					// the agent retries and bootstraps the node
+					ph, err = patch.NewHelper(byoHost, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+					Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+						return conditions.IsTrue(object.(*infrastructurev1beta1.ByoHost), infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+					})
+
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, patchedByoMachine)).Should(Succeed())
+					Expect(patchedByoMachine.Status.FailureReason).To(BeNil())
+					Expect(patchedByoMachine.Status.FailureMessage).To(BeNil())
+					Expect(conditions.GetReason(patchedByoMachine, infrastructurev1beta1.BYOHostReady)).NotTo(Equal(infrastructurev1beta1.ByoHostDegradedReason))
+				})
+
+				It("should publish the addresses of the byohost selected by the address policy", func() {
+					ph, err := patch.NewHelper(byoHost, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					byoHost.Status.Network = []infrastructurev1beta1.NetworkStatus{
+						{NetworkInterfaceName: "eth0", MACAddr: "00:50:56:a1:b2:c3", IPAddrs: []string{"10.10.10.5/24", "fe80::250:56ff:fea1:b2c3/64"}, IsDefault: true},
+						{NetworkInterfaceName: "eth1", MACAddr: "00:50:56:a1:b2:c4", IPAddrs: []string{"192.168.10.5/24"}},
+					}
+					Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+						return len(object.(*infrastructurev1beta1.ByoHost).Status.Network) > 0
+					})
+
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+					patchedByoMachine := &infrastructurev1beta1.ByoMachine{}
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, patchedByoMachine)).Should(Succeed())
+					Expect(patchedByoMachine.Status.Addresses).To(Equal(clusterv1.MachineAddresses{
+						{Type: clusterv1.MachineInternalIP, Address: "10.10.10.5"},
+						{Type: clusterv1.MachineHostName, Address: byoHost.Name},
+					}))
+
+					ph, err = patch.NewHelper(patchedByoMachine, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					patchedByoMachine.Spec.AddressPolicy = &infrastructurev1beta1.MachineAddressPolicy{CIDRs: []string{"192.168.0.0/16"}}
+					Expect(ph.Patch(ctx, patchedByoMachine)).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(patchedByoMachine, func(object client.Object) bool {
+						return object.(*infrastructurev1beta1.ByoMachine).Spec.AddressPolicy != nil
+					})
+
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, patchedByoMachine)).Should(Succeed())
+					Expect(patchedByoMachine.Status.Addresses).To(Equal(clusterv1.MachineAddresses{
+						{Type: clusterv1.MachineInternalIP, Address: "192.168.10.5"},
+						{Type: clusterv1.MachineHostName, Address: byoHost.Name},
+					}))
+				})
+
 				Context("When ByoMachine is deleted", func() {
 					BeforeEach(func() {
 						ph, err := patch.NewHelper(byoMachine, k8sClientUncached)
@@ -588,11 +1023,23 @@ var _ = Describe("Controllers/ByomachineController", func() {
 			})
 
 			It("should mark BYOHostReady condition as False when the InstallationSecret is not available", func() {
-				// making the node unavailable by deleting it so that the reason persists
-				Expect(clientFake.Delete(ctx, node)).Should(Succeed())
+				// pointing the byomachine to an installer config that is not ready so that the reason persists
+				ph, err := patch.NewHelper(byoMachine, k8sClientUncached)
+				Expect(err).ShouldNot(HaveOccurred())
+				byoMachine.Spec.InstallerRef = &corev1.ObjectReference{
+					Kind:       "K8sInstallerConfigTemplate",
+					Namespace:  k8sInstallerConfigTemplate.Namespace,
+					Name:       k8sInstallerConfigTemplate.Name,
+					APIVersion: infrastructurev1beta1.GroupVersion.String(),
+				}
+				Expect(ph.Patch(ctx, byoMachine, patch.WithStatusObservedGeneration{})).Should(Succeed())
+				WaitForObjectToBeUpdatedInCache(byoMachine, func(object client.Object) bool {
+					return object.(*infrastructurev1beta1.ByoMachine).Spec.InstallerRef != nil
+				})
 
-				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
-				Expect(err).Should(MatchError(fmt.Sprintf("nodes %q not found", byoHost.Name)))
+				res, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(res.RequeueAfter).To(Equal(controllers.RequeueInstallerConfigTime))
 
 				createdByoMachine := &infrastructurev1beta1.ByoMachine{}
 				err = k8sClientUncached.Get(ctx, byoMachineLookupKey, createdByoMachine)
@@ -605,6 +1052,10 @@ var _ = Describe("Controllers/ByomachineController", func() {
 					Reason:   infrastructurev1beta1.InstallationSecretNotAvailableReason,
 					Severity: clusterv1.ConditionSeverityInfo,
 				}))
+
+				createdK8sInstallerConfig := &infrastructurev1beta1.K8sInstallerConfig{}
+				Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, createdK8sInstallerConfig)).Should(Succeed())
+				Expect(k8sClientUncached.Delete(ctx, createdK8sInstallerConfig)).Should(Succeed())
 			})
 		})
 
@@ -0,0 +1,66 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// claimIPAddress creates the IPAddressClaim name in the namespace of owner, claiming an address from pool,
+// and returns the IPAddress allocated to it, nil until the IPAM provider allocates it. The claim is owned
+// by owner so that it is garbage collected with it.
+func claimIPAddress(ctx context.Context, c client.Client, owner client.Object, clusterName, name string, pool corev1.TypedLocalObjectReference) (*ipamv1.IPAddress, error) {
+	claim := &ipamv1.IPAddressClaim{}
+	err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: owner.GetNamespace()}, claim)
+	if apierrors.IsNotFound(err) {
+		claim = &ipamv1.IPAddressClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: owner.GetNamespace(),
+				Labels:    map[string]string{clusterv1.ClusterNameLabel: clusterName},
+			},
+			Spec: ipamv1.IPAddressClaimSpec{PoolRef: pool},
+		}
+		if err = controllerutil.SetControllerReference(owner, claim, c.Scheme()); err != nil {
+			return nil, err
+		}
+		err = c.Create(ctx, claim)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim an IP address from %s %s: %v", pool.Kind, pool.Name, err)
+	}
+	if claim.Status.AddressRef.Name == "" {
+		return nil, nil
+	}
+
+	address := &ipamv1.IPAddress{}
+	err = c.Get(ctx, types.NamespacedName{Name: claim.Status.AddressRef.Name, Namespace: claim.Namespace}, address)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return address, err
+}
+
+// releaseIPAddress deletes the IPAddressClaim name, so that the IPAM provider releases its address
+func releaseIPAddress(ctx context.Context, c client.Client, namespace, name string) error {
+	claim := &ipamv1.IPAddressClaim{}
+	err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, claim)
+	if err == nil {
+		err = c.Delete(ctx, claim)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to release the IP address of IPAddressClaim %s: %v", name, err)
+	}
+	return nil
+}
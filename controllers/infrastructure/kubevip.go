@@ -0,0 +1,156 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	infrav1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// KubeVIPManifestPath is the path of the kube-vip static pod manifest on the control plane hosts
+	KubeVIPManifestPath = "/etc/kubernetes/manifests/kube-vip.yaml"
+
+	// defaultInterfaceTemplate is resolved by the host agent to the default network interface of the host
+	defaultInterfaceTemplate = "{{ .DefaultNetworkInterfaceName }}"
+	kubeconfigPath           = "/etc/kubernetes/admin.conf"
+)
+
+// validateKubeVIP validates the kube-vip configuration of the ByoCluster
+func validateKubeVIP(byoCluster *infrav1.ByoCluster) error {
+	kubeVIP := byoCluster.Spec.KubeVIP
+	if net.ParseIP(byoCluster.GetKubeVIPAddress()) == nil {
+		return fmt.Errorf("kube-vip address %q is not an IP address", byoCluster.GetKubeVIPAddress())
+	}
+	switch kubeVIP.Mode {
+	case "", infrav1.KubeVIPModeARP:
+		if kubeVIP.BGP != nil {
+			return fmt.Errorf("kube-vip BGP peering is only used in BGP mode")
+		}
+	case infrav1.KubeVIPModeBGP:
+		if kubeVIP.BGP == nil {
+			return fmt.Errorf("kube-vip BGP peering is required in BGP mode")
+		}
+		if net.ParseIP(kubeVIP.BGP.PeerAddress) == nil {
+			return fmt.Errorf("kube-vip BGP peer address %q is not an IP address", kubeVIP.BGP.PeerAddress)
+		}
+	default:
+		return fmt.Errorf("unknown kube-vip mode %q", kubeVIP.Mode)
+	}
+	return nil
+}
+
+// kubeVIPManifest renders the kube-vip static pod manifest of the control plane hosts of the ByoCluster
+func kubeVIPManifest(byoCluster *infrav1.ByoCluster) ([]byte, error) {
+	kubeVIP := byoCluster.Spec.KubeVIP
+	image := kubeVIP.Image
+	if image == "" {
+		image = infrav1.DefaultKubeVIPImage
+	}
+	vipInterface := kubeVIP.Interface
+	if vipInterface == "" {
+		vipInterface = defaultInterfaceTemplate
+	}
+	port := byoCluster.Spec.ControlPlaneEndpoint.Port
+	if port == 0 {
+		port = int32(DefaultAPIEndpointPort)
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "cp_enable", Value: "true"},
+		{Name: "vip_address", Value: byoCluster.GetKubeVIPAddress()},
+		{Name: "vip_interface", Value: vipInterface},
+		{Name: "port", Value: strconv.Itoa(int(port))},
+	}
+	if kubeVIP.Mode == infrav1.KubeVIPModeBGP {
+		env = append(env,
+			corev1.EnvVar{Name: "bgp_enable", Value: "true"},
+			corev1.EnvVar{Name: "bgp_routerinterface", Value: vipInterface},
+			corev1.EnvVar{Name: "bgp_as", Value: strconv.FormatUint(uint64(kubeVIP.BGP.AS), 10)},
+			corev1.EnvVar{Name: "bgp_peeraddress", Value: kubeVIP.BGP.PeerAddress},
+			corev1.EnvVar{Name: "bgp_peeras", Value: strconv.FormatUint(uint64(kubeVIP.BGP.PeerAS), 10)},
+		)
+	} else {
+		env = append(env,
+			corev1.EnvVar{Name: "vip_arp", Value: "true"},
+			corev1.EnvVar{Name: "vip_leaderelection", Value: "true"},
+			corev1.EnvVar{Name: "vip_leaseduration", Value: "15"},
+			corev1.EnvVar{Name: "vip_renewdeadline", Value: "10"},
+			corev1.EnvVar{Name: "vip_retryperiod", Value: "2"},
+		)
+	}
+
+	hostPathType := corev1.HostPathFileOrCreate
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kube-vip",
+			Namespace: metav1.NamespaceSystem,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:            "kube-vip",
+				Image:           image,
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				Args:            []string{"manager"},
+				Env:             env,
+				SecurityContext: &corev1.SecurityContext{
+					Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN", "NET_RAW"}},
+				},
+				VolumeMounts: []corev1.VolumeMount{{Name: "kubeconfig", MountPath: kubeconfigPath}},
+			}},
+			HostNetwork: true,
+			HostAliases: []corev1.HostAlias{{IP: "127.0.0.1", Hostnames: []string{"kubernetes"}}},
+			Volumes: []corev1.Volume{{
+				Name: "kubeconfig",
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{Path: kubeconfigPath, Type: &hostPathType},
+				},
+			}},
+		},
+	}
+	return yaml.Marshal(pod)
+}
+
+// addKubeVIPManifest adds the kube-vip static pod manifest to the write_files of the cloud-config bootstrap data.
+// The bootstrap data is returned unchanged if it already writes a kube-vip manifest, e.g. from the KubeadmConfig files.
+func addKubeVIPManifest(bootstrapData, manifest []byte) ([]byte, error) {
+	cloudConfig := map[string]interface{}{}
+	if err := yaml.Unmarshal(bootstrapData, &cloudConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse the bootstrap data: %v", err)
+	}
+	writeFiles, _ := cloudConfig["write_files"].([]interface{})
+	for _, file := range writeFiles {
+		if f, ok := file.(map[string]interface{}); ok && f["path"] == KubeVIPManifestPath {
+			return bootstrapData, nil
+		}
+	}
+	cloudConfig["write_files"] = append(writeFiles, map[string]interface{}{
+		"path":        KubeVIPManifestPath,
+		"owner":       "root:root",
+		"permissions": "0644",
+		"content":     string(manifest),
+	})
+	data, err := yaml.Marshal(cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the header comments of the bootstrap data, e.g. #cloud-config
+	var header strings.Builder
+	for _, line := range strings.SplitAfter(string(bootstrapData), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		header.WriteString(line)
+	}
+	return append([]byte(header.String()), data...), nil
+}
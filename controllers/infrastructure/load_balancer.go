@@ -0,0 +1,372 @@
+// Copyright 2023 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	infrav1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// webhookLoadBalancerTimeout is the timeout of the requests to a webhook load balancer service
+const webhookLoadBalancerTimeout = 30 * time.Second
+
+// errNoLoadBalancerHost is returned when no ByoHost is available to run the HAProxy load balancer
+var errNoLoadBalancerHost = errors.New("no ByoHost available for the load balancer")
+
+// LoadBalancerBackend is a control plane host served by the load balancer
+type LoadBalancerBackend struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Port    int32  `json:"port"`
+}
+
+// LoadBalancer configures the load balancer of the control plane endpoint of a ByoCluster
+type LoadBalancer interface {
+	// Reconcile makes the load balancer serve the backends and returns the address of the load balancer,
+	// empty if the load balancer does not choose its address
+	Reconcile(ctx context.Context, cluster *clusterv1.Cluster, byoCluster *infrav1.ByoCluster, backends []LoadBalancerBackend) (string, error)
+
+	// Delete releases the load balancer of the ByoCluster
+	Delete(ctx context.Context, byoCluster *infrav1.ByoCluster) error
+}
+
+// NewLoadBalancer returns the load balancer provider configured in the ByoCluster
+func NewLoadBalancer(c client.Client, byoCluster *infrav1.ByoCluster) (LoadBalancer, error) {
+	spec := byoCluster.Spec.LoadBalancer
+	switch {
+	case spec.HAProxy != nil && spec.Webhook != nil:
+		return nil, fmt.Errorf("only one load balancer provider can be set")
+	case spec.HAProxy != nil:
+		if _, err := metav1.LabelSelectorAsSelector(spec.HAProxy.Selector); err != nil {
+			return nil, fmt.Errorf("invalid HAProxy host selector: %v", err)
+		}
+		return &haproxyLoadBalancer{client: c}, nil
+	case spec.Webhook != nil:
+		return newWebhookLoadBalancer(spec.Webhook)
+	default:
+		return nil, fmt.Errorf("a load balancer provider must be set")
+	}
+}
+
+// haproxyLoadBalancer runs HAProxy on a ByoHost claimed from the pool. The HAProxy configuration
+// is rendered into a secret referenced by the host, the host agent applies it.
+type haproxyLoadBalancer struct {
+	client client.Client
+}
+
+var haproxyConfigTemplate = template.Must(template.New("haproxy.cfg").Parse(`global
+  log stdout format raw local0
+  maxconn 4096
+
+defaults
+  log global
+  mode tcp
+  option tcplog
+  timeout connect 10s
+  timeout client 1m
+  timeout server 1m
+
+frontend control-plane
+  bind *:{{ .Port }}
+  default_backend control-plane
+
+backend control-plane
+  option httpchk GET /healthz
+  http-check expect status 200
+  balance roundrobin
+{{- range .Backends }}
+  server {{ .Name }} {{ .Address }}:{{ .Port }} check check-ssl verify none
+{{- end }}
+`))
+
+// haproxyConfigSecretSuffix is appended to the name of the ByoCluster to name its HAProxy configuration secret
+const haproxyConfigSecretSuffix = "-haproxy"
+
+// haproxyConfigSecretName returns the name of the secret holding the HAProxy configuration of the ByoCluster
+func haproxyConfigSecretName(byoCluster *infrav1.ByoCluster) string {
+	return byoCluster.Name + haproxyConfigSecretSuffix
+}
+
+// loadBalancerHostLabelValue returns the value of the LoadBalancerHostLabel of the load balancer host of the ByoCluster,
+// namespace.name when it fits in a label value, else its prefix followed by a hash of namespace.name
+func loadBalancerHostLabelValue(byoCluster *infrav1.ByoCluster) string {
+	value := byoCluster.Namespace + "." + byoCluster.Name
+	if len(value) <= validation.LabelValueMaxLength {
+		return value
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(value)))[:10]
+	return value[:validation.LabelValueMaxLength-len(hash)-1] + "-" + hash
+}
+
+func (lb *haproxyLoadBalancer) Reconcile(ctx context.Context, cluster *clusterv1.Cluster, byoCluster *infrav1.ByoCluster, backends []LoadBalancerBackend) (string, error) {
+	logger := log.FromContext(ctx)
+
+	host, err := lb.claimedHost(ctx, byoCluster)
+	if err != nil {
+		return "", err
+	}
+	if host == nil {
+		if host, err = lb.claimHost(ctx, cluster, byoCluster); err != nil {
+			return "", err
+		}
+		logger.Info("Claimed the load balancer host", "byohost", host.Name)
+	}
+
+	var config bytes.Buffer
+	err = haproxyConfigTemplate.Execute(&config, struct {
+		Port     int32
+		Backends []LoadBalancerBackend
+	}{byoCluster.Spec.ControlPlaneEndpoint.Port, backends})
+	if err != nil {
+		return "", err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      haproxyConfigSecretName(byoCluster),
+			Namespace: byoCluster.Namespace,
+		},
+	}
+	_, err = controllerutil.CreateOrPatch(ctx, lb.client, secret, func() error {
+		secret.Data = map[string][]byte{infrav1.HAProxyConfigKey: config.Bytes()}
+		return controllerutil.SetControllerReference(byoCluster, secret, lb.client.Scheme())
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write the HAProxy configuration: %v", err)
+	}
+
+	if host.Spec.LoadBalancerSecret == nil || host.Spec.LoadBalancerSecret.Name != secret.Name {
+		helper, err := patch.NewHelper(host, lb.client)
+		if err != nil {
+			return "", err
+		}
+		host.Spec.LoadBalancerSecret = &corev1.ObjectReference{Kind: "Secret", Namespace: secret.Namespace, Name: secret.Name}
+		if err = helper.Patch(ctx, host); err != nil {
+			return "", err
+		}
+	}
+
+	address := hostAddress(host)
+	if address == "" {
+		return "", fmt.Errorf("load balancer host %s/%s has no address", host.Namespace, host.Name)
+	}
+	return address, nil
+}
+
+// claimedHost returns the ByoHost running the load balancer of the ByoCluster, nil if no host is claimed yet
+func (lb *haproxyLoadBalancer) claimedHost(ctx context.Context, byoCluster *infrav1.ByoCluster) (*infrav1.ByoHost, error) {
+	hostsList := &infrav1.ByoHostList{}
+	err := lb.client.List(ctx, hostsList, client.InNamespace(byoCluster.Namespace),
+		client.MatchingLabels{infrav1.LoadBalancerHostLabel: loadBalancerHostLabelValue(byoCluster)})
+	if err != nil || len(hostsList.Items) == 0 {
+		return nil, err
+	}
+	return &hostsList.Items[0], nil
+}
+
+// claimHost labels an available ByoHost of the namespace of the ByoCluster matching the HAProxy selector as its load balancer host.
+// The cluster label keeps the host from being attached to a ByoMachine.
+func (lb *haproxyLoadBalancer) claimHost(ctx context.Context, cluster *clusterv1.Cluster, byoCluster *infrav1.ByoCluster) (*infrav1.ByoHost, error) {
+	selector, err := metav1.LabelSelectorAsSelector(byoCluster.Spec.LoadBalancer.HAProxy.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if byoCluster.Spec.LoadBalancer.HAProxy.Selector == nil {
+		selector = labels.NewSelector()
+	}
+	byohostLabels, _ := labels.NewRequirement(clusterv1.ClusterNameLabel, selection.DoesNotExist, nil)
+	selector = selector.Add(*byohostLabels)
+
+	hostsList := &infrav1.ByoHostList{}
+	if err = lb.client.List(ctx, hostsList, &client.ListOptions{LabelSelector: selector, Namespace: byoCluster.Namespace}); err != nil {
+		return nil, err
+	}
+	for i := range hostsList.Items {
+		host := &hostsList.Items[i]
+		if _, moving := host.Annotations[infrav1.MoveToNamespaceAnnotation]; moving || host.Status.MachineRef != nil || hostAddress(host) == "" {
+			continue
+		}
+
+		helper, err := patch.NewHelper(host, lb.client)
+		if err != nil {
+			return nil, err
+		}
+		if host.Labels == nil {
+			host.Labels = make(map[string]string)
+		}
+		host.Labels[clusterv1.ClusterNameLabel] = cluster.Name
+		host.Labels[infrav1.LoadBalancerHostLabel] = loadBalancerHostLabelValue(byoCluster)
+		if err = helper.Patch(ctx, host); err != nil {
+			return nil, err
+		}
+		return host, nil
+	}
+	return nil, errNoLoadBalancerHost
+}
+
+func (lb *haproxyLoadBalancer) Delete(ctx context.Context, byoCluster *infrav1.ByoCluster) error {
+	host, err := lb.claimedHost(ctx, byoCluster)
+	if err != nil {
+		return err
+	}
+	if host != nil {
+		helper, err := patch.NewHelper(host, lb.client)
+		if err != nil {
+			return err
+		}
+		delete(host.Labels, clusterv1.ClusterNameLabel)
+		delete(host.Labels, infrav1.LoadBalancerHostLabel)
+		host.Spec.LoadBalancerSecret = nil
+		if err = helper.Patch(ctx, host); err != nil {
+			return err
+		}
+	}
+
+	secret := &corev1.Secret{}
+	err = lb.client.Get(ctx, types.NamespacedName{Name: haproxyConfigSecretName(byoCluster), Namespace: byoCluster.Namespace}, secret)
+	if err == nil {
+		err = lb.client.Delete(ctx, secret)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// webhookLoadBalancer delegates the load balancer to an external service. The backends are sent
+// on every reconciliation, the service is expected to apply them idempotently.
+type webhookLoadBalancer struct {
+	url        string
+	httpClient *http.Client
+}
+
+// webhookLoadBalancerRequest is the body of the requests to a webhook load balancer service
+type webhookLoadBalancerRequest struct {
+	Cluster              string                `json:"cluster"`
+	ControlPlaneEndpoint infrav1.APIEndpoint   `json:"controlPlaneEndpoint"`
+	Backends             []LoadBalancerBackend `json:"backends"`
+}
+
+// webhookLoadBalancerResponse is the optional body of the responses of a webhook load balancer service
+type webhookLoadBalancerResponse struct {
+	// Host is the address of the load balancer chosen by the service
+	Host string `json:"host,omitempty"`
+}
+
+func newWebhookLoadBalancer(spec *infrav1.WebhookLoadBalancerSpec) (*webhookLoadBalancer, error) {
+	if spec.URL == "" {
+		return nil, fmt.Errorf("the load balancer webhook URL is required")
+	}
+	if parsedURL, err := url.Parse(spec.URL); err != nil || parsedURL.Scheme != infrav1.LoadBalancerWebhookURLScheme {
+		return nil, fmt.Errorf("the load balancer webhook URL must be an https URL")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(spec.CABundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(spec.CABundle) {
+			return nil, fmt.Errorf("the load balancer webhook CA bundle has no PEM certificate")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &webhookLoadBalancer{
+		url:        spec.URL,
+		httpClient: &http.Client{Transport: transport, Timeout: webhookLoadBalancerTimeout},
+	}, nil
+}
+
+func (lb *webhookLoadBalancer) Reconcile(ctx context.Context, cluster *clusterv1.Cluster, byoCluster *infrav1.ByoCluster, backends []LoadBalancerBackend) (string, error) {
+	body, err := lb.send(ctx, http.MethodPost, byoCluster, backends)
+	if err != nil {
+		return "", err
+	}
+	response := &webhookLoadBalancerResponse{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err = json.Unmarshal(body, response); err != nil {
+			return "", fmt.Errorf("invalid response of the load balancer webhook: %v", err)
+		}
+	}
+	return response.Host, nil
+}
+
+func (lb *webhookLoadBalancer) Delete(ctx context.Context, byoCluster *infrav1.ByoCluster) error {
+	_, err := lb.send(ctx, http.MethodDelete, byoCluster, []LoadBalancerBackend{})
+	return err
+}
+
+// send sends the backends of the ByoCluster to the webhook and returns the body of the response
+func (lb *webhookLoadBalancer) send(ctx context.Context, method string, byoCluster *infrav1.ByoCluster, backends []LoadBalancerBackend) ([]byte, error) {
+	data, err := json.Marshal(webhookLoadBalancerRequest{
+		Cluster:              byoCluster.Namespace + "/" + byoCluster.Name,
+		ControlPlaneEndpoint: byoCluster.Spec.ControlPlaneEndpoint,
+		Backends:             backends,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, lb.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := lb.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("load balancer webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// a load balancer already released is not an error
+	if method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+		return body, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("load balancer webhook returned %s", resp.Status)
+	}
+	return body, nil
+}
+
+// hostAddress returns the IP address of the default network interface of the ByoHost, empty if it is unknown
+func hostAddress(host *infrav1.ByoHost) string {
+	for _, network := range host.Status.Network {
+		if !network.IsDefault {
+			continue
+		}
+		for _, addr := range network.IPAddrs {
+			if ip, _, err := net.ParseCIDR(addr); err == nil {
+				return ip.String()
+			}
+			if ip := net.ParseIP(addr); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	return ""
+}
@@ -31,6 +31,7 @@ import (
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/remote"
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -47,6 +48,8 @@ var (
 	k8sInstallerConfigReconciler          *controllers.K8sInstallerConfigReconciler
 	bootstrapKubeconfigReconciler         *controllers.BootstrapKubeconfigReconciler
 	recorder                              *record.FakeRecorder
+	admissionRecorder                     *record.FakeRecorder
+	admissionClientFake                   client.Client
 	byoCluster                            *infrastructurev1beta1.ByoCluster
 	capiCluster                           *clusterv1.Cluster
 	defaultClusterName                    = "my-cluster"
@@ -100,6 +103,9 @@ var _ = BeforeSuite(func() {
 	err = bootstrapv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = ipamv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:scheme
 
 	k8sManager, err = ctrl.NewManager(cfg, ctrl.Options{
@@ -126,7 +132,7 @@ var _ = BeforeSuite(func() {
 	recorder = record.NewFakeRecorder(32)
 	reconciler = &controllers.ByoMachineReconciler{
 		Client:   k8sManager.GetClient(),
-		Tracker:  remote.NewTestClusterCacheTracker(logr.New(logf.NullLogSink{}), clientFake, scheme.Scheme, client.ObjectKey{Name: capiCluster.Name, Namespace: capiCluster.Namespace}),
+		Tracker:  remote.NewTestClusterCacheTracker(logr.New(logf.NullLogSink{}), clientFake, scheme.Scheme, client.ObjectKey{Name: capiCluster.Name, Namespace: capiCluster.Namespace}, "byomachine-watchNodes"),
 		Recorder: recorder,
 	}
 	err = reconciler.SetupWithManager(context.TODO(), k8sManager)
@@ -138,8 +144,12 @@ var _ = BeforeSuite(func() {
 	err = byoClusterReconciler.SetupWithManager(context.TODO(), k8sManager)
 	Expect(err).NotTo(HaveOccurred())
 
+	admissionRecorder = record.NewFakeRecorder(32)
+	admissionClientFake = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
 	byoAdmissionReconciler = &controllers.ByoAdmissionReconciler{
+		Client:    admissionClientFake,
 		ClientSet: clientSetFake,
+		Recorder:  admissionRecorder,
 	}
 	err = byoAdmissionReconciler.SetupWithManager(k8sManager)
 	Expect(err).NotTo(HaveOccurred())
@@ -8,6 +8,12 @@ import (
 	"k8s.io/component-base/featuregate"
 )
 
+const (
+	// CertificateRotation renews the client certificate of the host agent before it expires,
+	// using the current certificate, and hot swaps it in the running agent.
+	CertificateRotation featuregate.Feature = "CertificateRotation"
+)
+
 var (
 	MutableGates featuregate.MutableFeatureGate = featuregate.NewFeatureGate()
 	Gates        featuregate.FeatureGate        = MutableGates
@@ -19,4 +25,6 @@ func init() {
 
 // defaultClusterAPIBYOHFeatureGates consists of all known cluster-api-byoh feature keys.
 // To add a new feature, define a key for it above and add it here.
-var defaultClusterAPIBYOHFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{}
+var defaultClusterAPIBYOHFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	CertificateRotation: {Default: false, PreRelease: featuregate.Alpha},
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -30,6 +31,7 @@ import (
 	//+kubebuilder:scaffold:imports
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/remote"
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 )
 
@@ -39,6 +41,8 @@ var (
 	metricsAddr          string
 	enableLeaderElection bool
 	probeAddr            string
+	csrMaxExpiration     time.Duration
+	managerSA            string
 )
 
 func init() {
@@ -52,6 +56,7 @@ func init() {
 
 	utilruntime.Must(clusterv1.AddToScheme(scheme))
 	utilruntime.Must(admissionv1beta1.AddToScheme(scheme))
+	utilruntime.Must(ipamv1.AddToScheme(scheme))
 }
 
 func setFlags() {
@@ -59,6 +64,10 @@ func setFlags() {
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.DurationVar(&csrMaxExpiration, "csr-max-expiration", byohcontrollers.DefaultCSRMaxExpiration,
+		"The longest certificate lifetime a host can request, the ByoAdmission controller denies the CSRs requesting more.")
+	flag.StringVar(&managerSA, "manager-service-account", infrastructurev1beta1.DefaultManagerServiceAccount,
+		"The username of the service account of the controller manager, the only one allowed to update any ByoHost. Set it when the manager is not deployed in byoh-system.")
 	flag.Parse()
 }
 
@@ -134,7 +143,10 @@ func main() {
 	// Set 'MANUAL_CSR_APPROVAL=enable' to disable ByoAdmission controller. Now CSRs should be approved manually.
 	if os.Getenv("MANUAL_CSR_APPROVAL") != "enable" {
 		if err = (&byohcontrollers.ByoAdmissionReconciler{
-			ClientSet: clientset.NewForConfigOrDie(ctrl.GetConfigOrDie()),
+			Client:        mgr.GetClient(),
+			ClientSet:     clientset.NewForConfigOrDie(ctrl.GetConfigOrDie()),
+			Recorder:      mgr.GetEventRecorderFor("byoadmission-controller"),
+			MaxExpiration: csrMaxExpiration,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "ByoAdmission")
 			os.Exit(1)
@@ -145,7 +157,8 @@ func main() {
 		os.Exit(1)
 	}
 
-	mgr.GetWebhookServer().Register("/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost", &webhook.Admission{Handler: &infrastructurev1beta1.ByoHostValidator{}})
+	mgr.GetWebhookServer().Register("/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost", &webhook.Admission{Handler: &infrastructurev1beta1.ByoHostValidator{Client: mgr.GetClient(), APIReader: mgr.GetAPIReader(), ManagerServiceAccount: managerSA}})
+	mgr.GetWebhookServer().Register("/mutate-infrastructure-cluster-x-k8s-io-v1beta1-byohost", &webhook.Admission{Handler: &infrastructurev1beta1.ByoHostDefaulter{}})
 
 	if err = (&byohcontrollers.BootstrapKubeconfigReconciler{
 		Client: mgr.GetClient(),
@@ -158,6 +171,10 @@ func main() {
 		setupLog.Error(err, "unable to create webhook", "webhook", "BootstrapKubeconfig")
 		os.Exit(1)
 	}
+	if err = (&infrastructurev1beta1.ByoCluster{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ByoCluster")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
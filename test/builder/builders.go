@@ -9,8 +9,10 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"time"
 
 	infrastructurev1beta1 "github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/common/hostidentity"
 	certv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -135,6 +137,7 @@ type MachineBuilder struct {
 	cluster             string
 	version             string
 	bootstrapDataSecret string
+	controlPlane        bool
 }
 
 // ByoClusterBuilder holds the variables and objects required to build an infrastructurev1beta1.ByoCluster
@@ -144,6 +147,10 @@ type ByoClusterBuilder struct {
 	bundleRegistry string
 	bundleTag      string
 	cluster        *clusterv1.Cluster
+	endpoint       infrastructurev1beta1.APIEndpoint
+	kubeVIP        *infrastructurev1beta1.KubeVIPSpec
+	loadBalancer   *infrastructurev1beta1.LoadBalancerSpec
+	endpointIPPool *corev1.TypedLocalObjectReference
 }
 
 // ByoCluster returns a ByoClusterBuilder with the given name and namespace
@@ -172,6 +179,30 @@ func (c *ByoClusterBuilder) WithBundleTag(tag string) *ByoClusterBuilder {
 	return c
 }
 
+// WithControlPlaneEndpoint adds the passed control plane endpoint to the ByoClusterBuilder
+func (c *ByoClusterBuilder) WithControlPlaneEndpoint(host string, port int32) *ByoClusterBuilder {
+	c.endpoint = infrastructurev1beta1.APIEndpoint{Host: host, Port: port}
+	return c
+}
+
+// WithKubeVIP adds the passed kube-vip configuration to the ByoClusterBuilder
+func (c *ByoClusterBuilder) WithKubeVIP(kubeVIP *infrastructurev1beta1.KubeVIPSpec) *ByoClusterBuilder {
+	c.kubeVIP = kubeVIP
+	return c
+}
+
+// WithLoadBalancer adds the passed load balancer configuration to the ByoClusterBuilder
+func (c *ByoClusterBuilder) WithLoadBalancer(loadBalancer *infrastructurev1beta1.LoadBalancerSpec) *ByoClusterBuilder {
+	c.loadBalancer = loadBalancer
+	return c
+}
+
+// WithControlPlaneEndpointIPPool adds the passed IP pool of the control plane endpoint to the ByoClusterBuilder
+func (c *ByoClusterBuilder) WithControlPlaneEndpointIPPool(pool *corev1.TypedLocalObjectReference) *ByoClusterBuilder {
+	c.endpointIPPool = pool
+	return c
+}
+
 // Build returns a Cluster with the attributes added to the ByoClusterBuilder
 func (c *ByoClusterBuilder) Build() *infrastructurev1beta1.ByoCluster {
 	cluster := &infrastructurev1beta1.ByoCluster{
@@ -183,7 +214,12 @@ func (c *ByoClusterBuilder) Build() *infrastructurev1beta1.ByoCluster {
 			Name:      c.name,
 			Namespace: c.namespace,
 		},
-		Spec: infrastructurev1beta1.ByoClusterSpec{},
+		Spec: infrastructurev1beta1.ByoClusterSpec{
+			ControlPlaneEndpoint:       c.endpoint,
+			ControlPlaneEndpointIPPool: c.endpointIPPool,
+			KubeVIP:                    c.kubeVIP,
+			LoadBalancer:               c.loadBalancer,
+		},
 	}
 
 	if c.cluster != nil {
@@ -230,6 +266,12 @@ func (m *MachineBuilder) WithBootstrapDataSecret(secret string) *MachineBuilder
 	return m
 }
 
+// WithControlPlaneLabel marks the Machine built by the MachineBuilder as a control plane machine
+func (m *MachineBuilder) WithControlPlaneLabel() *MachineBuilder {
+	m.controlPlane = true
+	return m
+}
+
 // Build returns a Machine with the attributes added to the MachineBuilder
 func (m *MachineBuilder) Build() *clusterv1.Machine {
 	machine := &clusterv1.Machine{
@@ -251,6 +293,9 @@ func (m *MachineBuilder) Build() *clusterv1.Machine {
 			DataSecretName: &m.bootstrapDataSecret,
 		}
 	}
+	if m.controlPlane {
+		machine.Labels = map[string]string{clusterv1.MachineControlPlaneLabel: ""}
+	}
 
 	return machine
 }
@@ -425,10 +470,16 @@ func (n *NamespaceBuilder) Build() *corev1.Namespace {
 
 // CertificateSigningRequestBuilder hold the variables and objects required to build a certv1.CertificateSigningRequest
 type CertificateSigningRequestBuilder struct {
-	name        string
-	cn          string
-	org         string
-	privKeySize int
+	name              string
+	cn                string
+	org               string
+	privKeySize       int
+	username          string
+	groups            []string
+	usages            []certv1.KeyUsage
+	expirationSeconds *int32
+	dnsNames          []string
+	hostIdentity      *infrastructurev1beta1.HostIdentity
 }
 
 // CertificateSigningRequest returns a CertificateSigningRequestBuilder with the given name, cn, org and privKeySize
@@ -441,6 +492,37 @@ func CertificateSigningRequest(name, cn, org string, privKeySize int) *Certifica
 	}
 }
 
+// WithRequester adds the username and groups of the requester to the CertificateSigningRequestBuilder
+func (csrb *CertificateSigningRequestBuilder) WithRequester(username string, groups ...string) *CertificateSigningRequestBuilder {
+	csrb.username = username
+	csrb.groups = groups
+	return csrb
+}
+
+// WithUsages adds the given usages to the CertificateSigningRequestBuilder, client auth if not set
+func (csrb *CertificateSigningRequestBuilder) WithUsages(usages ...certv1.KeyUsage) *CertificateSigningRequestBuilder {
+	csrb.usages = usages
+	return csrb
+}
+
+// WithExpirationSeconds adds the requested expiration to the CertificateSigningRequestBuilder
+func (csrb *CertificateSigningRequestBuilder) WithExpirationSeconds(expirationSeconds int32) *CertificateSigningRequestBuilder {
+	csrb.expirationSeconds = &expirationSeconds
+	return csrb
+}
+
+// WithDNSNames adds subject alternative names to the request of the CertificateSigningRequestBuilder
+func (csrb *CertificateSigningRequestBuilder) WithDNSNames(dnsNames ...string) *CertificateSigningRequestBuilder {
+	csrb.dnsNames = dnsNames
+	return csrb
+}
+
+// WithHostIdentity adds the identity of the host to the request of the CertificateSigningRequestBuilder
+func (csrb *CertificateSigningRequestBuilder) WithHostIdentity(identity *infrastructurev1beta1.HostIdentity) *CertificateSigningRequestBuilder {
+	csrb.hostIdentity = identity
+	return csrb
+}
+
 // Build returns a certv1.CertificateSigningRequest with the attributes added to the CertificateSigningRequestBuilder
 func (csrb *CertificateSigningRequestBuilder) Build() (*certv1.CertificateSigningRequest, error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, csrb.privKeySize)
@@ -453,6 +535,14 @@ func (csrb *CertificateSigningRequestBuilder) Build() (*certv1.CertificateSignin
 			Organization: []string{csrb.org},
 			CommonName:   csrb.cn,
 		},
+		DNSNames: csrb.dnsNames,
+	}
+	if csrb.hostIdentity != nil {
+		extension, err := hostidentity.Extension(csrb.hostIdentity)
+		if err != nil {
+			return nil, err
+		}
+		csrTemplate.ExtraExtensions = []pkix.Extension{extension}
 	}
 
 	// Generate the CSR bytes
@@ -468,11 +558,17 @@ func (csrb *CertificateSigningRequestBuilder) Build() (*certv1.CertificateSignin
 			Annotations: map[string]string{},
 		},
 		Spec: certv1.CertificateSigningRequestSpec{
-			Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrData}),
-			SignerName: certv1.KubeAPIServerClientSignerName,
-			Usages:     []certv1.KeyUsage{certv1.UsageClientAuth},
+			Request:           pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrData}),
+			SignerName:        certv1.KubeAPIServerClientSignerName,
+			Usages:            []certv1.KeyUsage{certv1.UsageClientAuth},
+			ExpirationSeconds: csrb.expirationSeconds,
+			Username:          csrb.username,
+			Groups:            csrb.groups,
 		},
 	}
+	if csrb.usages != nil {
+		csr.Spec.Usages = csrb.usages
+	}
 	return csr, nil
 }
 
@@ -615,11 +711,15 @@ func (b *K8sInstallerConfigTemplateBuilder) Build() *infrastructurev1beta1.K8sIn
 
 // K8sInstallerConfigTemplateBuilder holds the variables and objects required to build an infrastructurev1beta1.K8sInstallerConfigTemplate
 type BootstrapKubeconfigBuilder struct {
-	namespace     string
-	name          string
-	server        string
-	skipTLSVerify bool
-	caData        string
+	namespace        string
+	name             string
+	server           string
+	skipTLSVerify    bool
+	caData           string
+	targetNamespace  string
+	hostNamePatterns []string
+	maxUsages        *int32
+	ttl              *metav1.Duration
 }
 
 func BootstrapKubeconfig(namespace, name string) *BootstrapKubeconfigBuilder {
@@ -647,6 +747,30 @@ func (b *BootstrapKubeconfigBuilder) WithCAData(caData string) *BootstrapKubecon
 	return b
 }
 
+// WithTargetNamespace adds the namespace the hosts register in to the BootstrapKubeconfigBuilder
+func (b *BootstrapKubeconfigBuilder) WithTargetNamespace(namespace string) *BootstrapKubeconfigBuilder {
+	b.targetNamespace = namespace
+	return b
+}
+
+// WithHostNamePatterns adds the allowed host name patterns to the BootstrapKubeconfigBuilder
+func (b *BootstrapKubeconfigBuilder) WithHostNamePatterns(patterns ...string) *BootstrapKubeconfigBuilder {
+	b.hostNamePatterns = patterns
+	return b
+}
+
+// WithMaxUsages adds the number of hosts the token can bootstrap to the BootstrapKubeconfigBuilder
+func (b *BootstrapKubeconfigBuilder) WithMaxUsages(maxUsages int32) *BootstrapKubeconfigBuilder {
+	b.maxUsages = &maxUsages
+	return b
+}
+
+// WithTTL adds the time to live of the token to the BootstrapKubeconfigBuilder
+func (b *BootstrapKubeconfigBuilder) WithTTL(ttl time.Duration) *BootstrapKubeconfigBuilder {
+	b.ttl = &metav1.Duration{Duration: ttl}
+	return b
+}
+
 // Build returns a BootstrapKubeconfig with the attributes added to the BootstrapKubeconfigBuilder
 func (b *BootstrapKubeconfigBuilder) Build() *infrastructurev1beta1.BootstrapKubeconfig {
 	bootstrapKubeconfig := &infrastructurev1beta1.BootstrapKubeconfig{
@@ -662,6 +786,10 @@ func (b *BootstrapKubeconfigBuilder) Build() *infrastructurev1beta1.BootstrapKub
 			APIServer:                b.server,
 			InsecureSkipTLSVerify:    b.skipTLSVerify,
 			CertificateAuthorityData: b.caData,
+			TargetNamespace:          b.targetNamespace,
+			HostNamePatterns:         b.hostNamePatterns,
+			MaxUsages:                b.maxUsages,
+			TTL:                      b.ttl,
 		},
 		Status: infrastructurev1beta1.BootstrapKubeconfigStatus{},
 	}
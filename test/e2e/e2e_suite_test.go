@@ -296,13 +296,18 @@ func generateBootstrapKubeconfig(ctx context.Context, clusterProxy framework.Clu
 		Namespace: bootstrapKubeconfigCRD.Namespace,
 	}
 	createdBootstrapKubeconfig := &infraproviderv1.BootstrapKubeconfig{}
-	Eventually(func() *string {
+	Eventually(func() *corev1.LocalObjectReference {
 		err := clusterProxy.GetClient().Get(ctx, bootstrapKubeconfigLookupKey, createdBootstrapKubeconfig)
 		if err != nil {
 			return nil
 		}
-		return createdBootstrapKubeconfig.Status.BootstrapKubeconfigData
+		return createdBootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef
 	}).ShouldNot(BeNil())
 
-	return *createdBootstrapKubeconfig.Status.BootstrapKubeconfigData
+	bootstrapKubeconfigSecret := &corev1.Secret{}
+	Expect(clusterProxy.GetClient().Get(ctx, types.NamespacedName{
+		Name:      createdBootstrapKubeconfig.Status.BootstrapKubeconfigSecretRef.Name,
+		Namespace: createdBootstrapKubeconfig.Namespace,
+	}, bootstrapKubeconfigSecret)).To(Succeed(), "failed to get the bootstrap kubeconfig secret")
+	return string(bootstrapKubeconfigSecret.Data[infraproviderv1.BootstrapKubeconfigSecretKey])
 }